@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// accessLogLine matches the nginx and Apache common and combined log formats:
+// 127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326 ...
+var accessLogLine = regexp.MustCompile(`^\S+ \S+ \S+ \[([^\]]+)\] "([A-Z]+) (\S+)(?: [^"]*)?" \d{3} `)
+
+const accessLogTime = "02/Jan/2006:15:04:05 -0700"
+
+// loadAccessLog reads the requests of an access log and points them at
+// target. Lines that are malformed, such as requests that were never parsed
+// by the server, are skipped and counted.
+func loadAccessLog(path string, target *url.URL) (*replayLog, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	type line struct {
+		at   time.Time
+		spec requestSpec
+	}
+	var lines []line
+	skipped := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		m := accessLogLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			skipped++
+			continue
+		}
+		at, err := time.Parse(accessLogTime, m[1])
+		if err != nil || !strings.HasPrefix(m[3], "/") {
+			skipped++
+			continue
+		}
+		spec := requestSpec{
+			Name:   fmt.Sprintf("line-%d", n),
+			Method: m[2],
+			URL:    target.Scheme + "://" + target.Host + m[3],
+		}
+		spec.endpoint = spec.method() + " " + strings.SplitN(m[3], "?", 2)[0]
+		// recorded paths may contain anything, including {{
+		if spec.compile() != nil {
+			skipped++
+			continue
+		}
+		lines = append(lines, line{at, spec})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(lines) == 0 {
+		return nil, skipped, fmt.Errorf("%s: no requests in common or combined log format", path)
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].at.Before(lines[j].at) })
+	r := &replayLog{}
+	for _, l := range lines {
+		r.add(l.spec, l.at)
+	}
+	return r, skipped, nil
+}
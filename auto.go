@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"dos/internal/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// autoSearch finds the highest request rate the target sustains. It runs
+// steps of a fixed duration, doubling the rate while steps pass, then
+// narrows the range between the last passing and the first failing rate by
+// bisection until it is within autoPrecision.
+type autoSearch struct {
+	maxErrorRate float64
+	maxP99       time.Duration
+	stepDuration time.Duration
+
+	current atomic.Pointer[autoStep]
+
+	// mu guards the result, which report reads while the search may still
+	// be running. good is the highest passing rate, bad the lowest failing
+	// one; 0 means none yet.
+	mu        sync.Mutex
+	good, bad float64
+	steps     int
+	converged bool
+}
+
+type autoStep struct {
+	rate   float64
+	hist   *metrics.Histogram
+	errors atomic.Uint64
+}
+
+const (
+	autoPrecision = 0.05
+	autoMaxSteps  = 20
+	// autoMinAchieved is the fraction of the target rate a step must reach.
+	// Below it the client or the target can't keep up, e.g. because all
+	// goroutines are waiting for slow responses.
+	autoMinAchieved = 0.9
+)
+
+func newAutoSearch(maxErrorRate float64, maxP99, stepDuration time.Duration) *autoSearch {
+	return &autoSearch{maxErrorRate: maxErrorRate, maxP99: maxP99, stepDuration: stepDuration}
+}
+
+func (a *autoSearch) record(res *Result) {
+	s := a.current.Load()
+	if s == nil {
+		return
+	}
+	s.hist.Record(res.duration)
+	if isFailure(res) {
+		s.errors.Add(1)
+	}
+}
+
+// run drives limiter through the search, starting at startRPS once warm-up
+// ends at from, and cancels the run once the capacity is found.
+func (a *autoSearch) run(ctx context.Context, cancel context.CancelFunc, startRPS float64, from time.Time) {
+	defer crashes.handlePanic("auto", func(error) { cancel() })
+	if wait := time.Until(from); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+
+	rps := startRPS
+	for step := 1; step <= autoMaxSteps; step++ {
+		s := &autoStep{rate: rps, hist: metrics.NewHistogram()}
+		a.current.Store(s)
+		limiter.SetLimit(rate.Limit(rps))
+		events.emit(eventRateChanged, map[string]any{"rps": rps})
+
+		timer := time.NewTimer(a.stepDuration)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		requests := s.hist.Count()
+		achieved := float64(requests) / a.stepDuration.Seconds()
+		var errorRate float64
+		if requests > 0 {
+			errorRate = float64(s.errors.Load()) / float64(requests)
+		}
+		p99 := s.hist.Quantile(0.99)
+		passed := requests > 0 && errorRate <= a.maxErrorRate && p99 <= a.maxP99 && achieved >= rps*autoMinAchieved
+		log.Info().Timestamp().Int("step", step).Float64("rps", rps).Float64("achieved_rps", achieved).Float64("error_rate", errorRate).Dur("p99", p99).Bool("passed", passed).Msg("Auto step finished")
+
+		var done bool
+		if rps, done = a.next(rps, passed); done {
+			break
+		}
+	}
+	a.current.Store(nil)
+	cancel()
+}
+
+// next records the outcome of a step at rps and returns the rate of the
+// next step, or done once the search has converged or can't go lower.
+func (a *autoSearch) next(rps float64, passed bool) (float64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.steps++
+	if passed {
+		a.good = rps
+	} else {
+		a.bad = rps
+	}
+	switch {
+	case a.bad > 0 && a.bad-a.good <= a.bad*autoPrecision:
+		a.converged = true
+	case a.bad == 0:
+		rps *= 2
+	default:
+		rps = (a.good + a.bad) / 2
+	}
+	return rps, a.converged || rps < 1
+}
+
+// report logs the result of the search.
+func (a *autoSearch) report() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	evt := log.Info()
+	if !a.converged {
+		evt = log.Warn()
+	}
+	evt.Timestamp().Float64("max_sustainable_rps", a.good).Float64("first_failing_rps", a.bad).Int("steps", a.steps).Bool("converged", a.converged).Msg("Auto capacity search finished")
+	events.emit(eventCapacityFound, map[string]any{"max_sustainable_rps": a.good, "first_failing_rps": a.bad, "steps": a.steps, "converged": a.converged})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestAutoSearchNext(t *testing.T) {
+	tests := []struct {
+		name      string
+		passes    []bool
+		rates     []float64
+		done      bool
+		good, bad float64
+		converged bool
+	}{
+		{
+			name:   "doubles while passing",
+			passes: []bool{true, true, true},
+			rates:  []float64{200, 400, 800},
+			good:   400,
+		},
+		{
+			name:   "bisects after a failure",
+			passes: []bool{true, true, false, true},
+			rates:  []float64{200, 400, 300, 350},
+			good:   300, bad: 400,
+		},
+		{
+			name:   "converges within the precision",
+			passes: []bool{true, false, true, true, false, true},
+			rates:  []float64{200, 150, 175, 187.5, 181.25, 181.25},
+			done:   true,
+			good:   181.25, bad: 187.5, converged: true,
+		},
+		{
+			name:   "gives up below 1 rps",
+			passes: []bool{false, false, false, false, false, false, false},
+			rates:  []float64{50, 25, 12.5, 6.25, 3.125, 1.5625, 0.78125},
+			done:   true,
+			bad:    1.5625,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAutoSearch(0.01, time.Second, time.Second)
+			rps := 100.0
+			for i, passed := range tt.passes {
+				next, done := a.next(rps, passed)
+				if next != tt.rates[i] {
+					t.Fatalf("step %d: next rate = %v, want %v", i+1, next, tt.rates[i])
+				}
+				if want := tt.done && i == len(tt.passes)-1; done != want {
+					t.Fatalf("step %d: done = %v, want %v", i+1, done, want)
+				}
+				rps = next
+			}
+			if a.good != tt.good || a.bad != tt.bad || a.converged != tt.converged {
+				t.Errorf("good, bad, converged = %v, %v, %v, want %v, %v, %v", a.good, a.bad, a.converged, tt.good, tt.bad, tt.converged)
+			}
+		})
+	}
+}
+
+// run with -race: report may be called while the search is still running,
+// e.g. when the run is interrupted.
+func TestAutoSearchReportWhileRunning(t *testing.T) {
+	defer func(l *rate.Limiter) { limiter = l }(limiter)
+	limiter = rate.NewLimiter(rate.Inf, 1)
+
+	a := newAutoSearch(0.01, time.Second, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.run(ctx, cancel, 100, time.Now())
+	}()
+	for ctx.Err() == nil {
+		a.report()
+	}
+	<-done
+	a.report()
+	if a.steps == 0 {
+		t.Error("no steps were run")
+	}
+}
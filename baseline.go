@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"dos/internal/metrics"
+	"fmt"
+)
+
+// baselineSummary describes the unloaded requests sent before the run.
+// Latency only covers the requests that succeeded.
+type baselineSummary struct {
+	Requests int             `json:"requests"`
+	Failures int             `json:"failures"`
+	Latency  *latencySummary `json:"latency,omitempty"`
+}
+
+// measureBaseline sends n requests one after another, before any load, to
+// check that the target answers and to measure its latency when idle. It
+// fails if none of the requests succeeded; failed requests and 5xx
+// responses count as failures like for -abort_on_error_rate.
+func measureBaseline(ctx context.Context, n int) (*baselineSummary, error) {
+	h := metrics.NewHistogram()
+	sum := &baselineSummary{}
+	var last *Result
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		res := doRecovered(ctx, nil)
+		sum.Requests++
+		if isFailure(res) {
+			sum.Failures++
+			last = res
+			log.Debug().Timestamp().Err(res.err).Int("status", res.status).Msg("Baseline request failed")
+			continue
+		}
+		h.Record(res.duration)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if sum.Failures == sum.Requests {
+		if last.err != nil {
+			return nil, fmt.Errorf("all %d baseline requests failed, last with: %w", n, last.err)
+		}
+		return nil, fmt.Errorf("all %d baseline requests failed, last with status %d", n, last.status)
+	}
+	sum.Latency = newLatencySummary(h)
+	if replay != nil {
+		// the load starts with the first recorded request again
+		replay.rewind()
+	}
+	return sum, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"dos/internal/metrics"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// circuitBreaker stops the run when the error rate over a sliding window
+// reaches a threshold, so an unattended run against a target that is down
+// doesn't keep going. Failed requests and 5xx responses count as errors.
+type circuitBreaker struct {
+	threshold   float64
+	minRequests uint64
+	rolling     *metrics.Rolling
+	tripped     atomic.Bool
+}
+
+func newCircuitBreaker(rate string, window time.Duration, minRequests uint64) (*circuitBreaker, error) {
+	v, err := parseErrorRate(rate)
+	if err != nil {
+		return nil, err
+	}
+	if v == 0 {
+		return nil, fmt.Errorf("error rate %q must be above 0%%", rate)
+	}
+	return &circuitBreaker{threshold: v, minRequests: minRequests, rolling: metrics.NewRolling(window)}, nil
+}
+
+// parseErrorRate parses a percentage such as "50%" or a fraction such as
+// "0.5".
+func parseErrorRate(rate string) (float64, error) {
+	s := strings.TrimSpace(rate)
+	percent := strings.HasSuffix(s, "%")
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid error rate %q", rate)
+	}
+	if percent {
+		v /= 100
+	}
+	if v < 0 || v > 1 {
+		return 0, fmt.Errorf("error rate %q must be between 0%% and 100%%", rate)
+	}
+	return v, nil
+}
+
+// isFailure reports whether res counts as an error for error rate thresholds.
+func isFailure(res *Result) bool {
+	return res.err != nil || res.status >= 500
+}
+
+func (b *circuitBreaker) record(at time.Time, res *Result) {
+	b.rolling.Record(at, res.duration, isFailure(res))
+}
+
+// watch checks the error rate every second and cancels the run once it
+// reaches the threshold.
+func (b *circuitBreaker) watch(ctx context.Context, cancel context.CancelFunc) {
+	defer crashes.handlePanic("circuit_breaker", nil)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			snap := b.rolling.Snapshot()
+			if snap.Requests < b.minRequests || snap.ErrorRate < b.threshold {
+				continue
+			}
+			b.tripped.Store(true)
+			log.Error().Timestamp().Float64("error_rate", snap.ErrorRate).Float64("threshold", b.threshold).Uint64("requests", snap.Requests).Msg("Error rate circuit breaker tripped, stopping the run")
+			events.emit(eventCircuitBreakerTripped, map[string]any{"error_rate": snap.ErrorRate, "threshold": b.threshold, "requests": snap.Requests})
+			cancel()
+			return
+		}
+	}
+}
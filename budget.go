@@ -0,0 +1,154 @@
+package main
+
+import (
+	"dos/internal/config"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// errorBudget tracks how much of an SLO's error budget the run has consumed.
+// A request counts against the budget if it failed or, when latency is set,
+// took longer than latency.
+type errorBudget struct {
+	allowed float64
+	latency time.Duration
+	// serverErrors makes 5xx responses bad too.
+	serverErrors bool
+	total        int64
+	bad          int64
+}
+
+type budgetStatus struct {
+	BadRequests     int64   `json:"bad_requests"`
+	BurnRate        float64 `json:"burn_rate"`
+	BudgetRemaining float64 `json:"budget_remaining"`
+}
+
+// newErrorBudget returns a budget for an SLO of target percent good requests.
+func newErrorBudget(target float64, latency time.Duration) *errorBudget {
+	return &errorBudget{allowed: 1 - target/100, latency: latency}
+}
+
+func (b *errorBudget) isBad(res *Result) bool {
+	return res.err != nil || (b.serverErrors && res.status >= 500) || (b.latency > 0 && res.duration > b.latency)
+}
+
+func (b *errorBudget) add(res *Result) {
+	atomic.AddInt64(&b.total, 1)
+	if b.isBad(res) {
+		atomic.AddInt64(&b.bad, 1)
+	}
+}
+
+func (b *errorBudget) status() *budgetStatus {
+	return b.statusOf(atomic.LoadInt64(&b.total), atomic.LoadInt64(&b.bad))
+}
+
+// statusOf computes the burn rate, where 1 means the budget is being spent
+// exactly as fast as the SLO allows, and the fraction of the budget left,
+// which goes negative once it is overspent.
+func (b *errorBudget) statusOf(total, bad int64) *budgetStatus {
+	s := &budgetStatus{BadRequests: bad, BudgetRemaining: 1}
+	if total > 0 {
+		s.BurnRate = float64(bad) / float64(total) / b.allowed
+		s.BudgetRemaining = 1 - s.BurnRate
+	}
+	return s
+}
+
+// sloConfig is an SLO of the slos config section: target percent of the
+// requests, to endpoint if set, must be good. Unlike -slo_target, 5xx
+// responses are bad, and with latency so are requests slower than it.
+type sloConfig struct {
+	Name     string          `json:"name"`
+	Target   float64         `json:"target"`
+	Latency  config.Duration `json:"latency"`
+	Endpoint string          `json:"endpoint"`
+}
+
+var sloConfigs []sloConfig
+
+// serviceLevel tracks the compliance of the run with one SLO.
+type serviceLevel struct {
+	sloConfig
+	budget *errorBudget
+}
+
+// sloStatus reports an SLO for reliability reviews: compliance is the
+// percentage of good requests, and met whether it reached the target.
+type sloStatus struct {
+	Name       string  `json:"name"`
+	Target     float64 `json:"target"`
+	Latency    string  `json:"latency,omitempty"`
+	Endpoint   string  `json:"endpoint,omitempty"`
+	Requests   int64   `json:"requests"`
+	Compliance float64 `json:"compliance"`
+	Met        bool    `json:"met"`
+	budgetStatus
+}
+
+func newServiceLevels(configs []sloConfig) ([]*serviceLevel, error) {
+	var levels []*serviceLevel
+	names := map[string]bool{}
+	for i, cfg := range configs {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("slo-%d", i+1)
+		}
+		switch {
+		case names[cfg.Name]:
+			return nil, fmt.Errorf("slo %q: duplicate name", cfg.Name)
+		case cfg.Target <= 0 || cfg.Target >= 100:
+			return nil, fmt.Errorf("slo %q: target must be between 0 and 100", cfg.Name)
+		case cfg.Latency < 0:
+			return nil, fmt.Errorf("slo %q: latency must be non-negative", cfg.Name)
+		}
+		names[cfg.Name] = true
+		budget := newErrorBudget(cfg.Target, time.Duration(cfg.Latency))
+		budget.serverErrors = true
+		levels = append(levels, &serviceLevel{sloConfig: cfg, budget: budget})
+	}
+	return levels, nil
+}
+
+func (l *serviceLevel) add(res *Result) {
+	if l.Endpoint == "" || l.Endpoint == res.endpoint {
+		l.budget.add(res)
+	}
+}
+
+func (l *serviceLevel) status() sloStatus {
+	total, bad := atomic.LoadInt64(&l.budget.total), atomic.LoadInt64(&l.budget.bad)
+	s := sloStatus{Name: l.Name, Target: l.Target, Endpoint: l.Endpoint, Requests: total, Compliance: 100, budgetStatus: *l.budget.statusOf(total, bad)}
+	if l.Latency > 0 {
+		s.Latency = time.Duration(l.Latency).String()
+	}
+	if total > 0 {
+		s.Compliance = float64(total-bad) / float64(total) * 100
+	}
+	s.Met = s.Compliance >= l.Target
+	return s
+}
+
+// loadSLOs reads the slos section of a config file, for the report command.
+func loadSLOs(path string) ([]*serviceLevel, error) {
+	values, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []sloConfig
+	if ok, err := config.Section(values, "slos", &configs); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("%s has no slos section", path)
+	}
+	return newServiceLevels(configs)
+}
+
+func sloStatuses(levels []*serviceLevel) []sloStatus {
+	var out []sloStatus
+	for _, l := range levels {
+		out = append(out, l.status())
+	}
+	return out
+}
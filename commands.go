@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// command is a subcommand of dos. Every command parses its own flag set
+// from the arguments after its name; run uses the flags of the main flag
+// set.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+var commands = []command{
+	{"run", "run a load test (the default if the first argument is a flag)", runLoadTest},
+	{"validate-proxies", "check a proxy list without sending any load", validateProxiesCommand},
+	{"report", "rebuild the summary and charts of a run from its -results_out file", reportCommand},
+	{"compare", "compare two runs and the change between them", compareCommand},
+}
+
+// dispatch runs the command named by the first argument. Without one, the
+// arguments are flags of run, so existing command lines keep working.
+func dispatch(args []string) {
+	flag.CommandLine.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: dos [run] [flags]\n\nFlags:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nRun \"dos help\" for the other commands.\n")
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		runLoadTest(args)
+		return
+	}
+	if args[0] == "help" {
+		usage()
+		return
+	}
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == args[0] })
+	if i < 0 {
+		fmt.Fprintf(os.Stderr, "dos: unknown command %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+	commands[i].run(args[1:])
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: dos [command] [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-18s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(out, "\nRun \"dos <command> -h\" for the flags of a command.\n")
+}
+
+// commandFlags returns the flag set of a subcommand with the log flags all
+// commands share.
+func commandFlags(name string) (fs *flag.FlagSet, lvl *string, pretty *bool) {
+	fs = flag.NewFlagSet("dos "+name, flag.ExitOnError)
+	lvl = fs.String("lvl", "info", "log level")
+	pretty = fs.Bool("pretty", false, "enable pretty logging")
+	return fs, lvl, pretty
+}
+
+// setupLog writes the log to w and returns the level it is filtered at.
+func setupLog(w io.Writer, pretty bool, level string) zerolog.Level {
+	if pretty {
+		log = zerolog.New(zerolog.NewConsoleWriter(func(cw *zerolog.ConsoleWriter) { cw.Out = w }))
+	} else {
+		log = zerolog.New(w)
+	}
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+
+	lvl, err := zerolog.ParseLevel(level)
+	if err != nil {
+		log.Fatal().Timestamp().Err(err).Send()
+	}
+	return lvl
+}
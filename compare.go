@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// compareCommand prints two runs side by side with the change from the
+// first to the second, for before/after regression checks. A run is either
+// a summary written with -summary_format json or a -results_out file.
+func compareCommand(args []string) {
+	fs, lvl, pretty := commandFlags("compare")
+	format := fs.String("format", "text", "output format (text, json)")
+	maxRegression := fs.Float64("max_regression", 0, "exit with status 1 if requests/s dropped or p99 latency rose by more than this percentage (0 disables)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dos compare [flags] <before> <after>\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	zerolog.SetGlobalLevel(setupLog(os.Stderr, *pretty, *lvl))
+
+	switch {
+	case fs.NArg() != 2:
+		fs.Usage()
+		os.Exit(2)
+	case *format != "text" && *format != "json":
+		log.Fatal().Timestamp().Str("format", *format).Msg("format must be text or json")
+	case *maxRegression < 0:
+		log.Fatal().Timestamp().Msg("max_regression must be non-negative")
+	}
+	var runs [2]runSummary
+	for i, path := range fs.Args() {
+		var err error
+		if runs[i], err = loadRun(path); err != nil {
+			log.Fatal().Err(err).Timestamp().Str("run", path).Msg("Failed to load run")
+		}
+	}
+
+	rows := compareRuns(runs[0], runs[1])
+	if err := writeComparison(os.Stdout, *format, fs.Arg(0), fs.Arg(1), rows); err != nil {
+		log.Fatal().Err(err).Timestamp().Msg("Failed to write comparison")
+	}
+	regressed := false
+	for _, row := range rows {
+		if *maxRegression > 0 && row.regression(*maxRegression) {
+			log.Error().Timestamp().Str("metric", row.Metric).Float64("change_percent", *row.ChangePercent).Float64("max_regression", *maxRegression).Msg("Performance regressed")
+			regressed = true
+		}
+	}
+	if regressed {
+		os.Exit(1)
+	}
+}
+
+// loadRun reads a summary, or rebuilds one from a results file.
+func loadRun(path string) (runSummary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return runSummary{}, err
+	}
+	var probe struct {
+		SentRequests *int64 `json:"sent_requests"`
+	}
+	if json.Unmarshal(data, &probe) == nil && probe.SentRequests != nil {
+		var sum runSummary
+		err := json.Unmarshal(data, &sum)
+		if sum.RecordedRequests == 0 {
+			// summaries written before recorded_requests counted every
+			// recorded request as sent
+			sum.RecordedRequests = sum.SentRequests
+		}
+		return sum, err
+	}
+	records, err := readResults(bytes.NewReader(data))
+	if err != nil {
+		return runSummary{}, fmt.Errorf("neither a JSON summary nor a results file: %w", err)
+	}
+	if len(records) == 0 {
+		return runSummary{}, fmt.Errorf("results file has no requests")
+	}
+	return buildReport(records, nil).summary, nil
+}
+
+// comparisonRow is one metric of both runs. ChangePercent is relative to
+// the first run and unset if it had no value; for the error rate,
+// ChangePoints is the difference in percentage points instead.
+// higherIsBetter tells in which direction a change is a regression, and
+// gate whether -max_regression applies.
+type comparisonRow struct {
+	Metric         string   `json:"metric"`
+	Before         float64  `json:"before"`
+	After          float64  `json:"after"`
+	Unit           string   `json:"unit"`
+	ChangePercent  *float64 `json:"change_percent,omitempty"`
+	ChangePoints   *float64 `json:"change_points,omitempty"`
+	higherIsBetter bool
+	gate           bool
+}
+
+// regression reports whether the row is gated by -max_regression and got
+// worse by more than limit percent.
+func (r comparisonRow) regression(limit float64) bool {
+	if !r.gate || r.ChangePercent == nil {
+		return false
+	}
+	if r.higherIsBetter {
+		return -*r.ChangePercent > limit
+	}
+	return *r.ChangePercent > limit
+}
+
+func compareRuns(before, after runSummary) []comparisonRow {
+	var rows []comparisonRow
+	add := func(metric, unit string, b, a float64, higherIsBetter, gate bool) {
+		row := comparisonRow{Metric: metric, Before: b, After: a, Unit: unit, higherIsBetter: higherIsBetter, gate: gate}
+		if unit == "%" {
+			points := a - b
+			row.ChangePoints = &points
+		} else if b != 0 {
+			change := (a - b) / b * 100
+			row.ChangePercent = &change
+		}
+		rows = append(rows, row)
+	}
+	errorRate := func(s runSummary) float64 {
+		if s.RecordedRequests == 0 {
+			return 0
+		}
+		return float64(s.Errors) / float64(s.RecordedRequests) * 100
+	}
+	add("Requests", "requests", float64(before.RecordedRequests), float64(after.RecordedRequests), true, false)
+	add("Requests/s", "requests/s", before.RequestsPerSecond, after.RequestsPerSecond, true, true)
+	add("Error rate", "%", errorRate(before), errorRate(after), false, false)
+	add("Average latency", "ms", durationMs(time.Duration(before.AverageRequestDuration)), durationMs(time.Duration(after.AverageRequestDuration)), false, false)
+	if before.Latency != nil && after.Latency != nil {
+		add("p50 latency", "ms", durationMs(before.Latency.P50), durationMs(after.Latency.P50), false, false)
+		add("p90 latency", "ms", durationMs(before.Latency.P90), durationMs(after.Latency.P90), false, false)
+		add("p99 latency", "ms", durationMs(before.Latency.P99), durationMs(after.Latency.P99), false, true)
+		add("Max latency", "ms", durationMs(before.Latency.Max), durationMs(after.Latency.Max), false, false)
+	}
+	add("Throughput", "MB/s", before.ThroughputMBps, after.ThroughputMBps, true, false)
+	return rows
+}
+
+func writeComparison(w io.Writer, format, before, after string, rows []comparisonRow) error {
+	if format == "json" {
+		return json.NewEncoder(w).Encode(map[string]any{"before": before, "after": after, "metrics": rows})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Metric\t%s\t%s\tChange\n", filepath.Base(before), filepath.Base(after))
+	for _, row := range rows {
+		change := "-"
+		switch {
+		case row.ChangePoints != nil:
+			change = fmt.Sprintf("%+.2f pp", *row.ChangePoints)
+		case row.ChangePercent != nil:
+			change = fmt.Sprintf("%+.1f%%", *row.ChangePercent)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", row.Metric, formatMetric(row.Before, row.Unit), formatMetric(row.After, row.Unit), change)
+	}
+	return tw.Flush()
+}
+
+func formatMetric(v float64, unit string) string {
+	switch unit {
+	case "requests":
+		return fmt.Sprintf("%.0f", v)
+	case "requests/s":
+		return fmt.Sprintf("%.1f", v)
+	case "%":
+		return fmt.Sprintf("%.2f%%", v)
+	}
+	return fmt.Sprintf("%.3f %s", v, unit)
+}
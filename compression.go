@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// compressionEncodings are the content encodings responses can be
+// decompressed from.
+var compressionEncodings = []string{"gzip", "deflate", "br", "zstd"}
+
+var errDecompress = errors.New("decompress response")
+
+// parseCompression checks -compression, a comma-separated list of encodings,
+// and returns it as Accept-Encoding value.
+func parseCompression(s string) (string, error) {
+	var encodings []string
+	for _, enc := range strings.Split(s, ",") {
+		enc = strings.ToLower(strings.TrimSpace(enc))
+		if !slices.Contains(compressionEncodings, enc) {
+			return "", fmt.Errorf("unsupported encoding %q (%s)", enc, strings.Join(compressionEncodings, ", "))
+		}
+		encodings = append(encodings, enc)
+	}
+	return strings.Join(encodings, ", "), nil
+}
+
+// decompress records the decompressed size of resp in res and replaces the
+// body of resp with it, for sampling. res.bytes keeps the size on the wire.
+// A body that can't be decompressed fails the request.
+func (e *httpEngine) decompress(res *Result, resp *fasthttp.Response) {
+	body, err := resp.BodyUncompressed()
+	if err != nil {
+		res.err = fmt.Errorf("%w: %w", errDecompress, err)
+		return
+	}
+	res.decompressed = int64(len(resp.Header.Header()) + len(body))
+	if len(resp.Header.ContentEncoding()) > 0 {
+		res.compressed = true
+		resp.SetBodyRaw(body)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const consoleHelp = "commands: rate [rps], vus [n], pause, resume, stats, report"
+
+// console reads commands such as "rate 200" line by line, from stdin with
+// -control_stdin or from connections to -control_socket, and answers every
+// line with one line.
+type console struct {
+	ctx         context.Context
+	stats       *runStats
+	measureFrom time.Time
+	// users is the number of virtual users started, 0 without -vus.
+	users int
+}
+
+func (c *console) serve(r io.Reader, w io.Writer) {
+	defer crashes.handlePanic("console", nil)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		reply, err := c.exec(line)
+		if err != nil {
+			reply = "error: " + err.Error()
+		}
+		fmt.Fprintln(w, reply)
+	}
+}
+
+func (c *console) accept(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			c.serve(conn, conn)
+		}()
+	}
+}
+
+func (c *console) exec(line string) (string, error) {
+	cmd, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch cmd {
+	case "rate":
+		if arg == "" {
+			return fmt.Sprintf("rate %g", limitToRPS(limiter.Limit())), nil
+		}
+		rps, err := strconv.ParseFloat(arg, 64)
+		if err != nil || rps < 0 {
+			return "", fmt.Errorf("invalid rate %q, must be a non-negative number (0 means unlimited)", arg)
+		}
+		setRate(rps, "console")
+		return fmt.Sprintf("rate %g", rps), nil
+	case "vus":
+		if activeUsers == nil {
+			return "", errors.New("vus requires the run to be started with -vus")
+		}
+		if arg == "" {
+			return fmt.Sprintf("vus %d", activeUsers.get()), nil
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 || n > c.users {
+			return "", fmt.Errorf("invalid vus %q, must be between 0 and %d", arg, c.users)
+		}
+		activeUsers.set(n)
+		log.Info().Timestamp().Int("vus", n).Msg("Virtual users changed via console")
+		return fmt.Sprintf("vus %d", n), nil
+	case "pause":
+		pauseRun("console")
+		return "paused", nil
+	case "resume":
+		resumeRun(c.ctx, c.measureFrom, "console")
+		return runPhase(c.ctx, c.measureFrom), nil
+	case "stats":
+		snap := c.stats.snapshot(time.Since(c.measureFrom))
+		reply := fmt.Sprintf("sent %d, errors %d, %.1f requests/s", snap.SentRequests, snap.Errors, snap.RequestsPerSecond)
+		if snap.RemainingSeconds > 0 {
+			reply += fmt.Sprintf(", %.0fs left", snap.RemainingSeconds)
+		}
+		return reply, nil
+	case "report":
+		reportProgress(c.stats, c.measureFrom, "console")
+		return "reported", nil
+	case "help":
+		return consoleHelp, nil
+	}
+	return "", fmt.Errorf("unknown command %q, %s", cmd, consoleHelp)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"dos/internal/proxy"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type runControl struct {
+	mu      sync.Mutex
+	resumed chan struct{}
+}
+
+// pausedChan returns a channel that is closed when the run is resumed, or nil
+// if the run isn't paused.
+func (c *runControl) pausedChan() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumed
+}
+
+func (c *runControl) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed == nil {
+		c.resumed = make(chan struct{})
+	}
+}
+
+func (c *runControl) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed != nil {
+		close(c.resumed)
+		c.resumed = nil
+	}
+}
+
+type controlServer struct {
+	ctx         context.Context
+	stats       *runStats
+	measureFrom time.Time
+	token       []byte
+	server      *http.Server
+}
+
+// newControlServer serves the control API on addr, on 127.0.0.1 if it has
+// no host. Requests that change the run must carry token as Bearer token.
+func newControlServer(ctx context.Context, addr string, token []byte, stats *runStats, measureFrom time.Time) *controlServer {
+	s := &controlServer{
+		ctx:         ctx,
+		stats:       stats,
+		measureFrom: measureFrom,
+		token:       token,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stats", s.handleStats)
+	mux.HandleFunc("POST /pause", s.authorized(s.handlePause))
+	mux.HandleFunc("POST /resume", s.authorized(s.handleResume))
+	mux.HandleFunc("GET /rate", s.handleGetRate)
+	mux.HandleFunc("POST /rate", s.authorized(s.handleSetRate))
+	mux.HandleFunc("POST /proxies", s.authorized(s.handleAddProxies))
+	s.server = &http.Server{Addr: controlListenAddr(addr), Handler: mux}
+	return s
+}
+
+// controlListenAddr binds an address without host, such as :8081, to the
+// loopback interface only.
+func controlListenAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// readControlToken reads the token of -control_token_file.
+func readControlToken(path string) ([]byte, error) {
+	token, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	token = bytes.TrimSpace(token)
+	if len(token) == 0 {
+		return nil, errors.New("control token file is empty")
+	}
+	return token, nil
+}
+
+// authorized rejects requests without the control token.
+func (s *controlServer) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), s.token) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong control token"))
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *controlServer) start() error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.server.ListenAndServe()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}
+
+func (s *controlServer) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.server.Shutdown(ctx)
+}
+
+func (s *controlServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, runStatus{
+		Run:            runInfo,
+		Phase:          s.phase(),
+		Timestamp:      time.Now().Unix(),
+		ElapsedSeconds: max(time.Since(s.measureFrom), 0).Seconds(),
+		statsSnapshot:  s.stats.snapshot(time.Since(s.measureFrom)),
+	})
+}
+
+func (s *controlServer) phase() string {
+	if control.pausedChan() != nil {
+		return "paused"
+	}
+	return runPhase(s.ctx, s.measureFrom)
+}
+
+func (s *controlServer) handlePause(w http.ResponseWriter, r *http.Request) {
+	pauseRun("control API")
+	writeJSON(w, http.StatusOK, map[string]string{"phase": "paused"})
+}
+
+func (s *controlServer) handleResume(w http.ResponseWriter, r *http.Request) {
+	resumeRun(s.ctx, s.measureFrom, "control API")
+	writeJSON(w, http.StatusOK, map[string]string{"phase": s.phase()})
+}
+
+type rateBody struct {
+	RPS float64 `json:"rps"`
+}
+
+func (s *controlServer) handleGetRate(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, rateBody{RPS: limitToRPS(limiter.Limit())})
+}
+
+func (s *controlServer) handleSetRate(w http.ResponseWriter, r *http.Request) {
+	var body rateBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.RPS < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("rps must be non-negative"))
+		return
+	}
+	setRate(body.RPS, "control API")
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *controlServer) handleAddProxies(w http.ResponseWriter, r *http.Request) {
+	if rotator == nil {
+		writeError(w, http.StatusConflict, errors.New("run was not started with a proxy list"))
+		return
+	}
+	var body struct {
+		Proxies []string `json:"proxies"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	valid, invalid := proxy.ValidateProxies(body.Proxies)
+	rotator.Add(valid...)
+	log.Info().Timestamp().Int("added", len(valid)).Int("invalid", len(invalid)).Msg("Proxies added via control API")
+	events.emit(eventProxiesAdded, map[string]any{"added": len(valid), "invalid": len(invalid)})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"added":   valid,
+		"invalid": invalid,
+		"total":   rotator.Len(),
+	})
+}
+
+// pauseRun, resumeRun and setRate change the run from the control API or
+// the console. via is logged as the source of the change, such as
+// "console" or "control API".
+func pauseRun(via string) {
+	control.pause()
+	setPhase("paused")
+	log.Info().Timestamp().Msg("Run paused via " + via)
+}
+
+func resumeRun(ctx context.Context, measureFrom time.Time, via string) {
+	control.resume()
+	setPhase(runPhase(ctx, measureFrom))
+	log.Info().Timestamp().Msg("Run resumed via " + via)
+}
+
+// setRate sets the request rate, 0 meaning unlimited.
+func setRate(rps float64, via string) {
+	limit := rate.Inf
+	if rps > 0 {
+		limit = rate.Limit(rps)
+	}
+	limiter.SetLimit(limit)
+	log.Info().Timestamp().Float64("rps", rps).Msg("Rate changed via " + via)
+	events.emit(eventRateChanged, map[string]any{"rps": rps})
+}
+
+// reportProgress reports the statistics so far without stopping the run, as
+// the final summary would: in -summary_format if set, or else as a log line.
+func reportProgress(stats *runStats, measureFrom time.Time, via string) {
+	elapsed := time.Since(measureFrom)
+	snap := stats.snapshot(elapsed)
+	if *summaryFormat != "" {
+		sum := runSummary{Run: runInfo, URL: *targetURL, DurationSeconds: elapsed.Seconds(), statsSnapshot: snap}
+		if err := writeSummary(os.Stdout, *summaryFormat, sum); err != nil {
+			log.Error().Timestamp().Err(err).Msg("Failed to write summary")
+		}
+		return
+	}
+	evt := log.Info().Timestamp().Str("via", via).Float64("elapsed_seconds", elapsed.Seconds()).Int64("sent_requests", snap.SentRequests).Int64("errors", snap.Errors).Float64("average_request_duration", snap.AverageRequestDuration).Float64("requests_per_second", snap.RequestsPerSecond).Int64("bytes_received", snap.BytesReceived).Float64("throughput_mb_per_second", snap.ThroughputMBps)
+	if l := snap.Latency; l != nil {
+		evt = evt.Dur("p50", l.P50).Dur("p90", l.P90).Dur("p99", l.P99).Dur("max", l.Max)
+	}
+	if len(snap.ErrorTypes) > 0 {
+		evt = evt.Interface("error_types", snap.ErrorTypes)
+	}
+	evt.Msg("Intermediate report")
+}
+
+func limitToRPS(limit rate.Limit) float64 {
+	if limit == rate.Inf || math.IsInf(float64(limit), 1) {
+		return 0
+	}
+	return float64(limit)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"dos/internal/util"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	recentEventsKept = 50
+	maxCrashReports  = 5
+)
+
+type crashReport struct {
+	Time         time.Time  `json:"time"`
+	Version      string     `json:"version"`
+	Goroutine    string     `json:"goroutine"`
+	Panic        string     `json:"panic"`
+	Stack        string     `json:"stack"`
+	ConfigHash   string     `json:"config_hash"`
+	RecentEvents []runEvent `json:"recent_events"`
+}
+
+// crashReporter turns panics in worker goroutines into crash reports on disk
+// so that one bad request doesn't take down a long run.
+type crashReporter struct {
+	mu      sync.Mutex
+	recent  []runEvent
+	panics  int
+	written int
+}
+
+var (
+	crashes  = &crashReporter{}
+	errPanic = errors.New("panic")
+)
+
+func (c *crashReporter) keep(ev runEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recent = append(c.recent, ev)
+	if len(c.recent) > recentEventsKept {
+		c.recent = c.recent[len(c.recent)-recentEventsKept:]
+	}
+}
+
+func (c *crashReporter) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.panics
+}
+
+// handlePanic must be deferred directly. It recovers a panic, writes a crash
+// report and passes the panic as an error to onPanic, if set.
+func (c *crashReporter) handlePanic(goroutine string, onPanic func(error)) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err := fmt.Errorf("%w: %v", errPanic, r)
+	report := crashReport{
+		Time:       time.Now(),
+		Version:    version,
+		Goroutine:  goroutine,
+		Panic:      fmt.Sprint(r),
+		Stack:      string(debug.Stack()),
+		ConfigHash: configHash(),
+	}
+
+	c.mu.Lock()
+	c.panics++
+	write := c.written < maxCrashReports
+	if write {
+		c.written++
+		report.RecentEvents = append([]runEvent(nil), c.recent...)
+	}
+	c.mu.Unlock()
+
+	if write {
+		path := filepath.Join(*crashDir, fmt.Sprintf("dos-crash-%s.json", report.Time.Format("20060102-150405.000000")))
+		if werr := writeCrashReport(path, report); werr != nil {
+			log.Error().Timestamp().Err(werr).Str("path", path).Msg("Failed to write crash report")
+		}
+		log.Error().Timestamp().Err(err).Str("goroutine", goroutine).Str("crash_report", path).Str("stack", report.Stack).Msg("Recovered from panic")
+	} else {
+		log.Debug().Timestamp().Err(err).Str("goroutine", goroutine).Str("stack", report.Stack).Msg("Recovered from panic")
+	}
+
+	if onPanic != nil {
+		onPanic(err)
+	}
+}
+
+func writeCrashReport(path string, report crashReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, data)
+}
+
+// configHash identifies the run configuration: every flag value plus the
+// contents of the config file, which may hold sections that aren't flags.
+func configHash() string {
+	h := sha256.New()
+	flag.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(h, "%s=%s\n", f.Name, f.Value)
+	})
+	if *configFile != "" {
+		if data, err := os.ReadFile(*configFile); err == nil {
+			h.Write(data)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// doRecovered runs engine.Do, reporting a panic as a failed request.
+func doRecovered(ctx context.Context, vu *virtualUser) (res *Result) {
+	start := time.Now()
+	defer crashes.handlePanic("request", func(err error) {
+		res = acquireResult()
+		res.err = err
+		res.duration = time.Since(start)
+	})
+	return engine.Do(ctx, vu)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"dos/internal/curl"
+	"errors"
+	"io"
+	"os"
+)
+
+// importCurl sets the target URL, method and body from a curl command line,
+// or from stdin if cmdline is "-", and keeps its headers in curlRequest.
+func importCurl(cmdline string) error {
+	if cmdline == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		cmdline = string(b)
+	}
+	c, err := curl.Parse(cmdline)
+	if err != nil {
+		return err
+	}
+	if *targetURL != "" || *body != "" {
+		return errors.New("-url and -body cannot be combined with -from_curl")
+	}
+
+	*targetURL = c.URL
+	*method = c.Method
+	*body = c.Body
+	if c.Insecure {
+		*insecure = true
+	}
+	if c.FollowRedirects {
+		*followRedirects = true
+	}
+	curlRequest = &requestSpec{Headers: map[string]string{}}
+	for _, h := range c.Headers {
+		curlRequest.Headers[h.Name] = h.Value
+	}
+	return curlRequest.compile()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+type familyCounter struct {
+	v4 int64
+	v6 int64
+}
+
+var addressFamilies = &familyCounter{}
+
+func (c *familyCounter) count(conn net.Conn) {
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	if addr.IP.To4() != nil {
+		atomic.AddInt64(&c.v4, 1)
+	} else {
+		atomic.AddInt64(&c.v6, 1)
+	}
+}
+
+func (c *familyCounter) totals() (v4, v6 int64) {
+	return atomic.LoadInt64(&c.v4), atomic.LoadInt64(&c.v6)
+}
+
+func dialNetwork() string {
+	switch *ipVersion {
+	case "4":
+		return "tcp4"
+	case "6":
+		return "tcp6"
+	}
+	return "tcp"
+}
+
+// lookupNetwork is the resolver network matching dialNetwork.
+func lookupNetwork() string {
+	switch *ipVersion {
+	case "4":
+		return "ip4"
+	case "6":
+		return "ip6"
+	}
+	return "ip"
+}
+
+// targetDial returns the dial function for direct connections honoring
+// -ip_version, -connect_timeout and the blocklist.
+func targetDial() fasthttp.DialFunc {
+	switch *ipVersion {
+	case "4":
+		return scopedDial(func(addr string) (net.Conn, error) {
+			return fasthttp.DialTimeout(addr, *connectTimeout)
+		})
+	case "6":
+		return scopedDial(func(addr string) (net.Conn, error) {
+			return net.DialTimeout("tcp6", addr, *connectTimeout)
+		})
+	}
+	return scopedDial(func(addr string) (net.Conn, error) {
+		return fasthttp.DialDualStackTimeout(addr, *connectTimeout)
+	})
+}
+
+func countingDial(dial fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err == nil {
+			addressFamilies.count(conn)
+		}
+		return conn, err
+	}
+}
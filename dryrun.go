@@ -0,0 +1,124 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// sendDryRun sends a single request and prints the connection, the request and
+// the response, for checking the configuration before a run.
+func sendDryRun(ctx context.Context, target *url.URL) error {
+	e, ok := engine.(*httpEngine)
+	if !ok {
+		res := engine.Do(ctx, nil)
+		for _, t := range res.commands {
+			fmt.Printf("* %s %s\n", t.Command, t.Duration.Round(time.Microsecond))
+		}
+		fmt.Printf("* Finished in %s\n", res.duration.Round(time.Microsecond))
+		return res.err
+	}
+
+	c := &fasthttp.Client{Dial: client.Dial}
+	proxyAddr := ""
+	if rotator != nil {
+		c = rotator.ClientFor(0)
+		proxyAddr = rotator.At(0)
+	}
+	configureClient(c)
+	var tlsConfig *tls.Config
+	if target.Scheme == "https" {
+		tlsConfig = c.TLSConfig
+	}
+	c.Dial = dryRunDial(c.Dial, proxyAddr, tlsConfig, cmp.Or(target.Port(), "443"))
+
+	var rec sampleRecord
+	dry := *e
+	dry.client = c
+	dry.sampler = &requestSampler{rate: 1, out: func(r sampleRecord) { rec = r }}
+	res := dry.Do(ctx, nil)
+
+	printSampleMessage(">", rec.Request.Method+" "+rec.Request.URL, rec.Request)
+	if rec.Response != nil {
+		printSampleMessage("<", fmt.Sprintf("%d %s", rec.Response.Status, fasthttp.StatusMessage(rec.Response.Status)), *rec.Response)
+	}
+	for i, hop := range res.hops {
+		fmt.Printf("* Hop %d took %s\n", i+1, hop.Round(time.Microsecond))
+	}
+	if res.retries > 0 {
+		fmt.Printf("* Retried %d time(s)\n", res.retries)
+	}
+	fmt.Printf("* Finished in %s\n", res.duration.Round(time.Microsecond))
+	return res.err
+}
+
+// dryRunDial prints every connection dial opens. Like tracingDial, it does
+// the TLS handshake for connections to tlsPort itself, so that the
+// negotiated parameters can be printed.
+func dryRunDial(dial fasthttp.DialFunc, proxyAddr string, tlsConfig *tls.Config, tlsPort string) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil {
+			fmt.Printf("* Failed to connect to %s: %v\n", addr, err)
+			return nil, err
+		}
+		if proxyAddr != "" {
+			// the proxy resolves the target
+			fmt.Printf("* Connected to %s through proxy %s\n", addr, proxyAddr)
+		} else {
+			fmt.Printf("* Connected to %s (%s) from %s\n", addr, conn.RemoteAddr(), conn.LocalAddr())
+		}
+
+		host, port, _ := net.SplitHostPort(addr)
+		if tlsConfig == nil || port != tlsPort {
+			return conn, nil
+		}
+		tlsConn, err := tlsHandshake(conn, tlsConfig, host)
+		if err != nil {
+			fmt.Printf("* TLS handshake failed: %v\n", err)
+			return nil, err
+		}
+		printTLSState(tlsConn.ConnectionState())
+		// fasthttp treats connections with a Handshake method as TLS already
+		return tlsConn, nil
+	}
+}
+
+func printTLSState(state tls.ConnectionState) {
+	fmt.Printf("* %s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	if state.NegotiatedProtocol != "" {
+		fmt.Printf(", ALPN %s", state.NegotiatedProtocol)
+	}
+	fmt.Println()
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		fmt.Printf("* Certificate subject: %s\n", cert.Subject)
+		fmt.Printf("* Certificate issuer: %s\n", cert.Issuer)
+		fmt.Printf("* Certificate names: %s\n", strings.Join(cert.DNSNames, ", "))
+		fmt.Printf("* Certificate valid until: %s\n", cert.NotAfter.Format(time.RFC3339))
+	}
+	if len(state.VerifiedChains) == 0 {
+		fmt.Println("* Certificate not verified")
+	}
+}
+
+func printSampleMessage(prefix, first string, m sampleMessage) {
+	fmt.Printf("%s %s\n", prefix, first)
+	for _, h := range m.Headers {
+		fmt.Printf("%s %s\n", prefix, h)
+	}
+	fmt.Println(prefix)
+	if m.Body != "" {
+		fmt.Println(m.Body)
+		if m.BodyTruncated {
+			fmt.Printf("* Body truncated, %d bytes in total\n", m.BodySize)
+		}
+	}
+}
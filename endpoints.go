@@ -0,0 +1,80 @@
+package main
+
+import (
+	"dos/internal/metrics"
+	"sync"
+	"time"
+)
+
+// maxEndpoints bounds the endpoints kept apart, since recorded paths may
+// contain IDs. Requests to further endpoints are counted as otherEndpoint.
+const (
+	maxEndpoints  = 100
+	otherEndpoint = "other"
+)
+
+// endpointStats groups requests by the endpoint or scenario step they were
+// sent to, so that the slow or failing one among several can be found.
+type endpointStats struct {
+	mu    sync.Mutex
+	names []string
+	stats map[string]*endpointStat
+}
+
+type endpointStat struct {
+	requests int64
+	errors   int64
+	non2xx   int64
+	latency  *metrics.Histogram
+}
+
+// endpointSummary is the statistics of one endpoint. Errors are failed
+// requests, as in the totals, while non_2xx counts completed requests with
+// a status outside 2xx.
+type endpointSummary struct {
+	Endpoint string          `json:"endpoint"`
+	Requests int64           `json:"requests"`
+	Errors   int64           `json:"errors"`
+	Non2xx   int64           `json:"non_2xx"`
+	Latency  *latencySummary `json:"latency"`
+}
+
+func newEndpointStats() *endpointStats {
+	return &endpointStats{stats: map[string]*endpointStat{}}
+}
+
+func (e *endpointStats) record(name string, status int, failed bool, d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	stat, ok := e.stats[name]
+	if !ok && len(e.names) >= maxEndpoints {
+		name = otherEndpoint
+		stat, ok = e.stats[name]
+	}
+	if !ok {
+		stat = &endpointStat{latency: metrics.NewHistogram()}
+		e.stats[name] = stat
+		e.names = append(e.names, name)
+	}
+	stat.requests++
+	if failed {
+		stat.errors++
+	} else if status < 200 || status > 299 {
+		stat.non2xx++
+	}
+	stat.latency.Record(d)
+}
+
+// summaries returns the endpoints in the order they were first seen.
+func (e *endpointStats) summaries() []endpointSummary {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var out []endpointSummary
+	for _, name := range e.names {
+		stat := e.stats[name]
+		out = append(out, endpointSummary{Endpoint: name, Requests: stat.requests, Errors: stat.errors, Non2xx: stat.non2xx, Latency: newLatencySummary(stat.latency)})
+	}
+	return out
+}
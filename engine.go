@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"dos/internal/hook"
+	"dos/internal/schema"
+	"dos/internal/tmpl"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	errRequestHook  = errors.New("request hook")
+	errResponseHook = errors.New("response hook")
+	errSchema       = errors.New("schema violation")
+)
+
+// Engine sends one request. vu is the virtual user sending it, or nil
+// without -vus.
+type Engine interface {
+	Do(ctx context.Context, vu *virtualUser) *Result
+}
+
+func newEngine(target *url.URL) (Engine, error) {
+	switch target.Scheme {
+	case "http", "https":
+		e := &httpEngine{client: client, timeout: *requestTimeout, methods: allowedHTTPMethods, retry: retry, replay: replay, base: curlRequest, sampler: sampler, mix: mix, form: form, hooks: hooks, signers: signers, schema: responseSchema, schemaSample: *validateSample}
+		var err error
+		if e.url, err = parseTemplate(*targetURL); err != nil {
+			return nil, err
+		}
+		if e.body, err = parseTemplate(*body); err != nil {
+			return nil, err
+		}
+		if *followRedirects {
+			e.maxRedirects = *maxRedirects
+		}
+		if *compression != "" {
+			if e.acceptEncoding, err = parseCompression(*compression); err != nil {
+				return nil, fmt.Errorf("compression: %w", err)
+			}
+		}
+		return e, nil
+	case "smtp", "smtps", "imap", "imaps":
+		return newMailEngine(target)
+	}
+	return nil, fmt.Errorf("unsupported scheme %q", target.Scheme)
+}
+
+type httpEngine struct {
+	client       *fasthttp.Client
+	timeout      time.Duration
+	methods      []string
+	maxRedirects int
+	retry        *retryPolicy
+	url          *tmpl.Template
+	body         *tmpl.Template
+	replay       *replayLog
+	// base holds the headers imported with -from_curl.
+	base    *requestSpec
+	sampler *requestSampler
+	mix     *weightedMethods
+	form    *multipartForm
+	// acceptEncoding is set with -compression.
+	acceptEncoding string
+	hooks          hook.Hooks
+	signers        []requestSigner
+	// schema checks schemaSample of the 2xx responses, set with
+	// -validate_schema.
+	schema       *schema.Schema
+	schemaSample float64
+}
+
+func (e *httpEngine) Do(ctx context.Context, vu *virtualUser) *Result {
+	start := time.Now()
+	req := fasthttp.AcquireRequest()
+	vars := &requestVars{}
+	if vu != nil {
+		vars.captured = vu.vars
+	}
+	req.SetRequestURI(e.url.Expand(vars.lookup))
+	if *body != "" {
+		req.SetBodyString(e.body.Expand(vars.lookup))
+	} else if e.form != nil {
+		e.form.apply(req, vars)
+	}
+	if *randomMethod {
+		randomHTTPMethod := e.methods[rng.IntN(len(e.methods))]
+		req.Header.SetMethod(randomHTTPMethod)
+	} else {
+		req.Header.SetMethod(*method)
+	}
+
+	if e.base != nil {
+		e.base.apply(req, vars)
+	}
+	var mixMethod string
+	if e.mix != nil {
+		mixMethod = e.mix.pick()
+		req.Header.SetMethod(mixMethod)
+		if spec := methodRequests[mixMethod]; spec != nil {
+			spec.apply(req, vars)
+		}
+	}
+	step := -1
+	var entry *requestSpec
+	if e.replay != nil {
+		if vu != nil {
+			step = vu.position
+			entry = e.replay.entryAt(step)
+			vu.position++
+		} else {
+			entry = e.replay.nextEntry()
+		}
+		entry.apply(req, vars)
+	}
+
+	if *disableKeepalive {
+		req.SetConnectionClose()
+	}
+
+	variant := pickVariant()
+	if variant != nil {
+		variant.apply(req, vars)
+	}
+
+	if len(userAgentList) > 0 {
+		randomUserAgent := userAgentList[rng.IntN(len(userAgentList))]
+		req.Header.SetUserAgent(randomUserAgent)
+	} else if *userAgent != "" && len(req.Header.UserAgent()) == 0 {
+		// a user agent from a HAR recording, curl command or variant is kept
+		req.Header.SetUserAgent(*userAgent)
+	}
+	if e.acceptEncoding != "" && len(req.Header.Peek(fasthttp.HeaderAcceptEncoding)) == 0 {
+		req.Header.Set(fasthttp.HeaderAcceptEncoding, e.acceptEncoding)
+	}
+
+	c := e.client
+	primeCookies.apply(req)
+	if vu != nil {
+		c = vu.client
+		vu.cookies.apply(req)
+	}
+
+	resp := fasthttp.AcquireResponse()
+	var hops []time.Duration
+	var err error
+	if e.hooks != nil {
+		if hookErr := e.hooks.BeforeRequest(req); hookErr != nil {
+			err = fmt.Errorf("%w: %w", errRequestHook, hookErr)
+		}
+	}
+	if err == nil {
+		for _, s := range e.signers {
+			s.sign(req)
+		}
+		hops, err = e.send(c, req, resp)
+	}
+	// a request the hook refused isn't sent again
+	firstFailed := e.retry != nil && !errors.Is(err, errRequestHook) && e.retry.shouldRetry(resp.StatusCode(), err)
+	retries := 0
+	for firstFailed && retries < e.retry.retries && e.retry.shouldRetry(resp.StatusCode(), err) {
+		retries++
+		if e.retry.wait(ctx, retries) != nil {
+			break
+		}
+		rc := c
+		if e.retry.client != nil && vu == nil {
+			rc = e.retry.client
+			req.SetConnectionClose()
+		}
+		resp.Reset()
+		hops, err = e.send(rc, req, resp)
+	}
+	received := err == nil
+	if vu != nil && err == nil {
+		vu.cookies.update(resp)
+	}
+	if e.hooks != nil && err == nil {
+		if hookErr := e.hooks.AfterResponse(req, resp); hookErr != nil {
+			err = fmt.Errorf("%w: %w", errResponseHook, hookErr)
+		}
+	}
+	if step >= 0 && err == nil {
+		err = e.replay.capture(step, resp, vu.vars)
+	}
+
+	res := acquireResult()
+	res.status = resp.StatusCode()
+	res.duration = time.Since(start)
+	res.err = err
+	res.hops = hops
+	res.bytes = int64(len(resp.Header.Header()) + len(resp.Body()))
+	res.retries = retries
+	res.firstFailed = firstFailed
+	res.received = received
+	res.method = mixMethod
+	if entry != nil {
+		res.endpoint = entry.endpoint
+	}
+	if variant != nil {
+		res.variant = variant.Name
+	}
+	if e.acceptEncoding != "" && err == nil {
+		e.decompress(res, resp)
+	}
+	if e.schema != nil && res.err == nil && res.status >= 200 && res.status <= 299 && (e.schemaSample >= 1 || rng.Float64() < e.schemaSample) {
+		if schemaErr := e.schema.ValidateJSON(resp.Body()); schemaErr != nil {
+			res.err = fmt.Errorf("%w: %w", errSchema, schemaErr)
+		}
+	}
+	if e.sampler != nil && e.sampler.pick() {
+		e.sampler.record(start, req, resp, res.err, res.variant)
+	}
+
+	fasthttp.ReleaseRequest(req)
+	fasthttp.ReleaseResponse(resp)
+	return res
+}
+
+func (e *httpEngine) send(c *fasthttp.Client, req *fasthttp.Request, resp *fasthttp.Response) ([]time.Duration, error) {
+	if e.maxRedirects > 0 {
+		return doFollowingRedirects(c, req, resp, e.timeout, e.maxRedirects)
+	}
+	return nil, c.DoTimeout(req, resp, e.timeout)
+}
@@ -0,0 +1,12 @@
+//go:build agent
+
+package main
+
+import (
+	"errors"
+	"net/url"
+)
+
+func newMailEngine(target *url.URL) (Engine, error) {
+	return nil, errors.New("mail protocols are not included in the agent build")
+}
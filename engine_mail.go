@@ -0,0 +1,57 @@
+//go:build !agent
+
+package main
+
+import (
+	"context"
+	"dos/internal/mail"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+func newMailEngine(target *url.URL) (Engine, error) {
+	host := target.Hostname()
+	port := target.Port()
+	if port == "" {
+		port = mail.DefaultPort(target.Scheme)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	var commands []string
+	if *mailCommands != "" {
+		commands = strings.Split(*mailCommands, ",")
+	}
+	// the connections of the HTTP client go through -proxy_list, the
+	// blocklist, -connect_timeout and -dns_failover, and count the address
+	// families
+	return &mailEngine{prober: &mail.Prober{
+		Protocol:  strings.TrimSuffix(target.Scheme, "s"),
+		Dial:      client.Dial,
+		Addr:      net.JoinHostPort(host, port),
+		TLS:       strings.HasSuffix(target.Scheme, "s"),
+		TLSConfig: targetTLSConfig(host),
+		Commands:  commands,
+		Hostname:  hostname,
+		Timeout:   *requestTimeout,
+	}}, nil
+}
+
+type mailEngine struct {
+	prober *mail.Prober
+}
+
+func (e *mailEngine) Do(ctx context.Context, _ *virtualUser) *Result {
+	start := time.Now()
+	timings, err := e.prober.Probe(ctx)
+	res := acquireResult()
+	res.duration = time.Since(start)
+	res.err = err
+	res.received = err == nil
+	res.commands = timings
+	return res
+}
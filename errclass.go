@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"dos/internal/proxy"
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/valyala/fasthttp"
+)
+
+// unsentClasses are the error classes of requests that failed before they
+// were written to the target.
+var unsentClasses = []string{"proxy", "dns", "no_free_connections", "connection_refused", "connect_timeout", "tls", "tls_timeout", "out_of_scope", "request_hook"}
+
+// errorClass sorts a failed request into a coarse category, so a summary can
+// tell a target that is down from dead proxies or a saturated client. Proxy
+// failures take precedence, since the target was possibly never reached.
+// Responses outside 2xx are reported as non_2xx.
+func errorClass(res *Result) string {
+	err := res.err
+	if err == nil {
+		if res.status != 0 && (res.status < 200 || res.status > 299) {
+			return "non_2xx"
+		}
+		return ""
+	}
+
+	var proxyErr *proxy.DialError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var opErr *net.OpError
+	var certErr *tls.CertificateVerificationError
+	var alertErr tls.AlertError
+	var recordErr tls.RecordHeaderError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	switch {
+	case errors.Is(err, errPanic):
+		return "panic"
+	case errors.Is(err, errDecompress):
+		return "decompression"
+	case errors.Is(err, errOutOfScope):
+		return "out_of_scope"
+	case errors.Is(err, errRequestHook):
+		return "request_hook"
+	case errors.Is(err, errResponseHook):
+		return "response_hook"
+	case errors.Is(err, errExtract):
+		return "extract"
+	case errors.Is(err, errSchema):
+		return "schema"
+	case errors.As(err, &proxyErr):
+		return "proxy"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, fasthttp.ErrNoFreeConns):
+		return "no_free_connections"
+	case errors.Is(err, fasthttp.ErrTooManyRedirects):
+		return "too_many_redirects"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, fasthttp.ErrConnectionClosed):
+		return "connection_reset"
+	case errors.As(err, &certErr), errors.As(err, &alertErr), errors.As(err, &recordErr),
+		errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr):
+		return "tls"
+	case errors.Is(err, fasthttp.ErrDialTimeout), errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout():
+		return "connect_timeout"
+	case errors.Is(err, fasthttp.ErrTLSHandshakeTimeout):
+		return "tls_timeout"
+	case errors.Is(err, fasthttp.ErrTimeout), errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	}
+	return "other"
+}
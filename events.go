@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	eventRunStarted            = "run_started"
+	eventPhaseChanged          = "phase_changed"
+	eventRateChanged           = "rate_changed"
+	eventProxiesAdded          = "proxies_added"
+	eventFailover              = "target_failover"
+	eventTeardownEnded         = "teardown_finished"
+	eventThresholdBreached     = "threshold_breached"
+	eventCircuitBreakerTripped = "circuit_breaker_tripped"
+	eventCapacityFound         = "capacity_found"
+	eventRunEnded              = "run_ended"
+)
+
+type runEvent struct {
+	Time   time.Time      `json:"time"`
+	Type   string         `json:"type"`
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+// eventBus fans lifecycle events out to subscribers. Events are kept apart
+// from per-request logging so consumers don't have to parse log lines.
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers []func(runEvent)
+}
+
+var events = &eventBus{}
+
+func (b *eventBus) subscribe(fn func(runEvent)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, fn)
+}
+
+func (b *eventBus) emit(eventType string, fields map[string]any) {
+	ev := runEvent{Time: time.Now(), Type: eventType, Fields: fields}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, fn := range b.subscribers {
+		fn(ev)
+	}
+}
+
+// newEventFileSink returns a subscriber appending events to path as NDJSON.
+func newEventFileSink(path string) (func(runEvent), func() error, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc := json.NewEncoder(file)
+	sink := func(ev runEvent) {
+		if err := enc.Encode(ev); err != nil {
+			log.Error().Timestamp().Err(err).Str("events_out", path).Msg("Failed to write event")
+		}
+	}
+	return sink, file.Close, nil
+}
+
+func setPhase(name string) {
+	setPhaseAt(name, time.Now())
+}
+
+func setPhaseAt(name string, at time.Time) {
+	phases.enterAt(name, at)
+	events.emit(eventPhaseChanged, map[string]any{"phase": name})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const extractPrefix = "extract."
+
+var (
+	// extractors are parsed from -extract.
+	extractors []*extractor
+	// extracted holds the {{extract.<name>}} values taken from the
+	// -prime_url response. It is only written before the run.
+	extracted map[string]string
+	// primeCookies are the cookies the -prime_url response set, sent with
+	// every request, since tokens such as CSRF tokens are usually tied to
+	// the session cookie.
+	primeCookies cookieJar
+)
+
+// extractor takes a value out of a response: the first group of a regular
+// expression matching the body, the value at a path into a JSON body, or a
+// header.
+type extractor struct {
+	name   string
+	source string
+	expr   string
+	re     *regexp.Regexp
+	path   []string
+}
+
+// parseExtractor parses name=source:expression, where source is regex,
+// json or header.
+func parseExtractor(s string) (*extractor, error) {
+	name, spec, ok := strings.Cut(s, "=")
+	source, expr, ok2 := strings.Cut(spec, ":")
+	if !ok || !ok2 || name == "" || expr == "" {
+		return nil, fmt.Errorf("extract %q: expected name=source:expression", s)
+	}
+	x := &extractor{name: name, source: source, expr: expr}
+	switch source {
+	case "regex":
+		var err error
+		if x.re, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("extract %q: %w", s, err)
+		}
+		if x.re.NumSubexp() > 1 {
+			return nil, fmt.Errorf("extract %q: regex has more than one group", s)
+		}
+	case "json":
+		x.path = parseJSONPath(expr)
+	case "header":
+	default:
+		return nil, fmt.Errorf("extract %q: unknown source %q (regex, json, header)", s, source)
+	}
+	return x, nil
+}
+
+// parseJSONPath splits a path like $.data.items[0].id into its keys and
+// indices.
+func parseJSONPath(expr string) []string {
+	expr = strings.TrimPrefix(strings.TrimPrefix(expr, "$"), ".")
+	expr = strings.NewReplacer("[", ".", "]", "").Replace(expr)
+	return strings.Split(expr, ".")
+}
+
+func (x *extractor) extract(resp *fasthttp.Response) (string, error) {
+	switch x.source {
+	case "header":
+		value := resp.Header.Peek(x.expr)
+		if value == nil {
+			return "", fmt.Errorf("no %s header", x.expr)
+		}
+		return string(value), nil
+	case "regex":
+		m := x.re.FindSubmatch(resp.Body())
+		if m == nil {
+			return "", fmt.Errorf("%q doesn't match the body", x.expr)
+		}
+		return string(m[len(m)-1]), nil
+	}
+
+	var value any
+	if err := json.Unmarshal(resp.Body(), &value); err != nil {
+		return "", fmt.Errorf("body is not JSON: %w", err)
+	}
+	for _, key := range x.path {
+		switch v := value.(type) {
+		case map[string]any:
+			value = v[key]
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", fmt.Errorf("%s: no element %s", x.expr, key)
+			}
+			value = v[i]
+		default:
+			value = nil
+		}
+		if value == nil {
+			return "", fmt.Errorf("%s: no %s", x.expr, key)
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	// objects, arrays and booleans are inserted as JSON
+	b, _ := json.Marshal(value)
+	return string(b), nil
+}
+
+// prime requests -prime_url once and sets the values of all extractors and
+// the cookies it returns for the run.
+func prime(url string) error {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(url)
+	if *userAgent != "" {
+		req.Header.SetUserAgent(*userAgent)
+	}
+	for _, s := range signers {
+		s.sign(req)
+	}
+	if err := client.DoTimeout(req, resp, *requestTimeout); err != nil {
+		return err
+	}
+	if resp.StatusCode() >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode())
+	}
+
+	extracted = map[string]string{}
+	for _, x := range extractors {
+		value, err := x.extract(resp)
+		if err != nil {
+			return fmt.Errorf("extract %s: %w", x.name, err)
+		}
+		extracted[x.name] = value
+	}
+	primeCookies = cookieJar{}
+	primeCookies.update(resp)
+	return nil
+}
+
+// checkExtractNames reports extract placeholders that neither an -extract
+// nor a scenario step sets.
+func checkExtractNames() error {
+	for _, t := range templates {
+		for _, name := range t.Names() {
+			key, ok := strings.CutPrefix(name, extractPrefix)
+			if ok && !slices.ContainsFunc(extractors, func(x *extractor) bool { return x.name == key }) && !scenarioExtracts(key) {
+				return fmt.Errorf("%q: {{%s}} is set by neither -extract nor a scenario step", t, name)
+			}
+		}
+	}
+	return nil
+}
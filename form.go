@@ -0,0 +1,162 @@
+package main
+
+import (
+	"dos/internal/config"
+	"dos/internal/tmpl"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const randomFilePrefix = "@random:"
+
+// multipartForm builds a multipart/form-data body for every request, from
+// -form fields and -form_file files.
+type multipartForm struct {
+	fields []formField
+	files  []formFile
+}
+
+type formField struct {
+	name  string
+	value *tmpl.Template
+}
+
+// formFile is either the contents of a file, read once, or random content
+// of a size between minSize and maxSize generated for every request.
+type formFile struct {
+	field    string
+	filename string
+	content  []byte
+	minSize  int
+	maxSize  int
+}
+
+func stringListFlag(name, usage string) *config.StringList {
+	l := &config.StringList{}
+	flag.Var(l, name, usage)
+	return l
+}
+
+// newMultipartForm parses fields of the form name=value and files of the
+// form name=@path or name=@random:size, where size is a size like 64KB or a
+// range like 10KB-1MB.
+func newMultipartForm(fields, files []string) (*multipartForm, error) {
+	f := &multipartForm{}
+	for _, field := range fields {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("form %q: expected name=value", field)
+		}
+		t, err := parseTemplate(value)
+		if err != nil {
+			return nil, fmt.Errorf("form %q: %w", field, err)
+		}
+		f.fields = append(f.fields, formField{name: name, value: t})
+	}
+	for _, file := range files {
+		name, value, ok := strings.Cut(file, "=")
+		if !ok || name == "" || !strings.HasPrefix(value, "@") {
+			return nil, fmt.Errorf("form_file %q: expected name=@path or name=@random:size", file)
+		}
+		ff := formFile{field: name}
+		if spec, ok := strings.CutPrefix(value, randomFilePrefix); ok {
+			var err error
+			if ff.minSize, ff.maxSize, err = parseSizeRange(spec); err != nil {
+				return nil, fmt.Errorf("form_file %q: %w", file, err)
+			}
+			ff.filename = "random.bin"
+		} else {
+			path := value[1:]
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("form_file %q: %w", file, err)
+			}
+			ff.content = content
+			ff.filename = filepath.Base(path)
+		}
+		f.files = append(f.files, ff)
+	}
+	return f, nil
+}
+
+// apply replaces the body of req with the form.
+func (f *multipartForm) apply(req *fasthttp.Request, vars *requestVars) {
+	req.ResetBody()
+	// writes to the request body can't fail
+	w := multipart.NewWriter(req.BodyWriter())
+	for _, field := range f.fields {
+		w.WriteField(field.name, field.value.Expand(vars.lookup))
+	}
+	for _, file := range f.files {
+		part, _ := w.CreateFormFile(file.field, file.filename)
+		if file.content != nil {
+			part.Write(file.content)
+			continue
+		}
+		size := file.minSize
+		if file.maxSize > file.minSize {
+			size += rng.IntN(file.maxSize - file.minSize + 1)
+		}
+		io.CopyN(part, randomReader(), int64(size))
+	}
+	w.Close()
+	req.Header.SetContentType(w.FormDataContentType())
+}
+
+// randomReader returns a fast stream of random bytes seeded from rng.
+func randomReader() io.Reader {
+	var seed [32]byte
+	for i := 0; i < len(seed); i += 8 {
+		binary.LittleEndian.PutUint64(seed[i:], rng.Uint64())
+	}
+	return rand.NewChaCha8(seed)
+}
+
+// parseSizeRange parses a size like 64KB or a range like 10KB-1MB.
+func parseSizeRange(s string) (lo, hi int, err error) {
+	from, to, isRange := strings.Cut(s, "-")
+	if lo, err = parseSize(from); err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return lo, lo, nil
+	}
+	if hi, err = parseSize(to); err != nil {
+		return 0, 0, err
+	}
+	if hi < lo {
+		return 0, 0, fmt.Errorf("size range %q is reversed", s)
+	}
+	return lo, hi, nil
+}
+
+// parseSize parses a byte size with an optional B, KB, MB or GB suffix,
+// counting in powers of 1024.
+func parseSize(s string) (int, error) {
+	units := []struct {
+		suffix string
+		scale  int
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	num, scale := strings.ToUpper(strings.TrimSpace(s)), 1
+	for _, u := range units {
+		if n, ok := strings.CutSuffix(num, u.suffix); ok {
+			num, scale = n, u.scale
+			break
+		}
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(num))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * scale, nil
+}
@@ -5,6 +5,7 @@ go 1.24.5
 require (
 	github.com/rs/zerolog v1.34.0
 	github.com/valyala/fasthttp v1.68.0
+	golang.org/x/net v0.46.0
 	golang.org/x/time v0.12.0
 )
 
@@ -14,7 +15,6 @@ require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	golang.org/x/net v0.46.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/text v0.30.0 // indirect
 )
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime time.Time `json:"startedDateTime"`
+			Request         struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData *struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// harSkippedHeaders are set by the client for every request and would be
+// wrong or duplicated if copied from the recording.
+var harSkippedHeaders = map[string]bool{
+	"host":              true,
+	"content-length":    true,
+	"connection":        true,
+	"transfer-encoding": true,
+	"keep-alive":        true,
+}
+
+// loadHAR reads the http and https requests of a HAR file. Entries with
+// other schemes, such as data: or websocket URLs, are skipped.
+func loadHAR(path string) (*replayLog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	entries := har.Log.Entries
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].StartedDateTime.Before(entries[j].StartedDateTime) })
+
+	r := &replayLog{}
+	for i, e := range entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		spec := requestSpec{
+			Name:    fmt.Sprintf("har-%d", i+1),
+			Method:  e.Request.Method,
+			URL:     e.Request.URL,
+			Headers: map[string]string{},
+		}
+		spec.endpoint = spec.method() + " " + u.Path
+		for _, hdr := range e.Request.Headers {
+			// HTTP/2 pseudo-headers such as :authority
+			if strings.HasPrefix(hdr.Name, ":") || harSkippedHeaders[strings.ToLower(hdr.Name)] {
+				continue
+			}
+			spec.Headers[hdr.Name] = hdr.Value
+		}
+		if e.Request.PostData != nil {
+			spec.Body = e.Request.PostData.Text
+		}
+		if err := spec.compile(); err != nil {
+			return nil, fmt.Errorf("%s: entry %d: %w", path, i+1, err)
+		}
+		r.add(spec, e.StartedDateTime)
+	}
+	if len(r.entries) == 0 {
+		return nil, fmt.Errorf("%s: no http or https requests", path)
+	}
+	return r, nil
+}
@@ -0,0 +1,280 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	includeKey     = "include"
+	definitionsKey = "definitions"
+	refKey         = "$ref"
+)
+
+// Load reads a JSON config file. Files listed under "include" are loaded
+// first (relative to the including file) and overridden by the including
+// file. Objects of the form {"$ref": "name"} are replaced by the entry of
+// the same name under "definitions", with any sibling keys merged on top.
+func Load(path string) (map[string]any, error) {
+	values, err := load(path, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	definitions, _ := values[definitionsKey].(map[string]any)
+	delete(values, definitionsKey)
+
+	resolved, err := resolve(values, definitions, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return resolved.(map[string]any), nil
+}
+
+func load(path string, visiting map[string]bool) (map[string]any, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if visiting[abs] {
+		return nil, fmt.Errorf("include cycle detected at %s", path)
+	}
+	visiting[abs] = true
+	defer delete(visiting, abs)
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	includes, err := stringList(values[includeKey])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", path, includeKey, err)
+	}
+	delete(values, includeKey)
+
+	merged := map[string]any{}
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(abs), include)
+		}
+		included, err := load(include, visiting)
+		if err != nil {
+			return nil, err
+		}
+		merge(merged, included)
+	}
+	merge(merged, values)
+
+	return merged, nil
+}
+
+func merge(dst, src map[string]any) {
+	for k, v := range src {
+		srcMap, srcOk := v.(map[string]any)
+		dstMap, dstOk := dst[k].(map[string]any)
+		if srcOk && dstOk {
+			merged := maps.Clone(dstMap)
+			merge(merged, srcMap)
+			dst[k] = merged
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+func resolve(v any, definitions map[string]any, resolving map[string]bool) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		out := map[string]any{}
+		if ref, ok := v[refKey]; ok {
+			name, ok := ref.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a string", refKey)
+			}
+			def, ok := definitions[name]
+			if !ok {
+				return nil, fmt.Errorf("undefined %s %q", refKey, name)
+			}
+			if resolving[name] {
+				return nil, fmt.Errorf("%s cycle detected at %q", refKey, name)
+			}
+			resolving[name] = true
+			base, err := resolve(def, definitions, resolving)
+			delete(resolving, name)
+			if err != nil {
+				return nil, err
+			}
+			baseMap, ok := base.(map[string]any)
+			if !ok {
+				if len(v) > 1 {
+					return nil, fmt.Errorf("%s %q is not an object and cannot be extended", refKey, name)
+				}
+				return base, nil
+			}
+			merge(out, baseMap)
+		}
+		for k, val := range v {
+			if k == refKey {
+				continue
+			}
+			r, err := resolve(val, definitions, resolving)
+			if err != nil {
+				return nil, err
+			}
+			merge(out, map[string]any{k: r})
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			r, err := resolve(val, definitions, resolving)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// ApplyFlags sets every flag named in values that wasn't already set on the
+// command line. Keys that don't match a flag are reported as an error.
+func ApplyFlags(fs *flag.FlagSet, values map[string]any) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for key, value := range values {
+		if fs.Lookup(key) == nil {
+			return fmt.Errorf("unknown config key %q", key)
+		}
+		if explicit[key] {
+			continue
+		}
+		if list, ok := fs.Lookup(key).Value.(*StringList); ok {
+			items, err := stringList(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			*list = append(*list, items...)
+			continue
+		}
+		str, err := flagValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if err := fs.Set(key, str); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func flagValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		parts, err := stringList(v)
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(parts, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+func stringList(v any) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			str, err := flagValue(item)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, str)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("expected a string or a list, got %v", v)
+}
+
+// StringList is a flag that can be given more than once, collecting every
+// value. In a config file it takes a list, whose items may contain commas.
+type StringList []string
+
+func (l *StringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *StringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// Section removes key from values and decodes it into dst. It reports whether
+// the section was present.
+func Section(values map[string]any, key string, dst any) (bool, error) {
+	raw, ok := values[key]
+	if !ok {
+		return false, nil
+	}
+	delete(values, key)
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return true, fmt.Errorf("%s: %w", key, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return true, fmt.Errorf("%s: %w", key, err)
+	}
+	return true, nil
+}
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"100ms\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
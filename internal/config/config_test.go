@@ -0,0 +1,329 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  map[string]any
+		err   string
+	}{
+		{
+			name:  "plain",
+			files: map[string]string{"main.json": `{"url": "http://a", "workers": 4}`},
+			want:  map[string]any{"url": "http://a", "workers": 4.0},
+		},
+		{
+			name: "include is overridden by the including file",
+			files: map[string]string{
+				"base.json": `{"url": "http://base", "workers": 4}`,
+				"main.json": `{"include": "base.json", "url": "http://main"}`,
+			},
+			want: map[string]any{"url": "http://main", "workers": 4.0},
+		},
+		{
+			name: "later includes override earlier ones",
+			files: map[string]string{
+				"a.json":    `{"workers": 1, "method": "GET"}`,
+				"b.json":    `{"workers": 2}`,
+				"main.json": `{"include": ["a.json", "b.json"]}`,
+			},
+			want: map[string]any{"workers": 2.0, "method": "GET"},
+		},
+		{
+			name: "includes are relative to the including file",
+			files: map[string]string{
+				"sub/base.json": `{"workers": 3}`,
+				"sub/mid.json":  `{"include": "base.json"}`,
+				"main.json":     `{"include": "sub/mid.json"}`,
+			},
+			want: map[string]any{"workers": 3.0},
+		},
+		{
+			name: "nested objects are merged",
+			files: map[string]string{
+				"base.json": `{"headers": {"A": "1", "B": "2"}}`,
+				"main.json": `{"include": "base.json", "headers": {"B": "3"}}`,
+			},
+			want: map[string]any{"headers": map[string]any{"A": "1", "B": "3"}},
+		},
+		{
+			name: "include cycle",
+			files: map[string]string{
+				"a.json":    `{"include": "main.json"}`,
+				"main.json": `{"include": "a.json"}`,
+			},
+			err: "include cycle",
+		},
+		{
+			name:  "missing include",
+			files: map[string]string{"main.json": `{"include": "missing.json"}`},
+			err:   "missing.json",
+		},
+		{
+			name:  "invalid include",
+			files: map[string]string{"main.json": `{"include": {"a": 1}}`},
+			err:   "include",
+		},
+		{
+			name: "ref",
+			files: map[string]string{"main.json": `{
+				"definitions": {"auth": {"header": "Authorization", "prefix": "Bearer "}},
+				"signing": {"$ref": "auth"}
+			}`},
+			want: map[string]any{"signing": map[string]any{"header": "Authorization", "prefix": "Bearer "}},
+		},
+		{
+			name: "sibling keys extend a ref",
+			files: map[string]string{"main.json": `{
+				"definitions": {"auth": {"header": "Authorization", "prefix": "Bearer "}},
+				"signing": {"$ref": "auth", "prefix": "Token "}
+			}`},
+			want: map[string]any{"signing": map[string]any{"header": "Authorization", "prefix": "Token "}},
+		},
+		{
+			name: "refs inside arrays and definitions",
+			files: map[string]string{"main.json": `{
+				"definitions": {"get": {"method": "GET"}, "home": {"$ref": "get", "path": "/"}},
+				"steps": [{"$ref": "home"}, {"$ref": "get", "path": "/about"}]
+			}`},
+			want: map[string]any{"steps": []any{
+				map[string]any{"method": "GET", "path": "/"},
+				map[string]any{"method": "GET", "path": "/about"},
+			}},
+		},
+		{
+			name: "ref to a scalar",
+			files: map[string]string{"main.json": `{
+				"definitions": {"timeout": "5s"},
+				"request_timeout": {"$ref": "timeout"}
+			}`},
+			want: map[string]any{"request_timeout": "5s"},
+		},
+		{
+			name: "definitions come from includes",
+			files: map[string]string{
+				"defs.json": `{"definitions": {"get": {"method": "GET"}}}`,
+				"main.json": `{"include": "defs.json", "step": {"$ref": "get"}}`,
+			},
+			want: map[string]any{"step": map[string]any{"method": "GET"}},
+		},
+		{
+			name: "scalar ref can't be extended",
+			files: map[string]string{"main.json": `{
+				"definitions": {"timeout": "5s"},
+				"request_timeout": {"$ref": "timeout", "unit": "s"}
+			}`},
+			err: "cannot be extended",
+		},
+		{
+			name:  "undefined ref",
+			files: map[string]string{"main.json": `{"step": {"$ref": "missing"}}`},
+			err:   `undefined $ref "missing"`,
+		},
+		{
+			name:  "ref must be a string",
+			files: map[string]string{"main.json": `{"step": {"$ref": 1}}`},
+			err:   "$ref must be a string",
+		},
+		{
+			name: "ref cycle",
+			files: map[string]string{"main.json": `{
+				"definitions": {"a": {"$ref": "b"}, "b": {"$ref": "a"}},
+				"step": {"$ref": "a"}
+			}`},
+			err: "$ref cycle",
+		},
+		{
+			name:  "invalid JSON",
+			files: map[string]string{"main.json": `{"url": }`},
+			err:   "main.json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			got, err := Load(filepath.Join(dir, "main.json"))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Load() error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		values map[string]any
+		want   map[string]string
+		list   []string
+		err    string
+	}{
+		{
+			name:   "values of every type",
+			values: map[string]any{"url": "http://a", "workers": 4.0, "rate": 2.5, "insecure": true, "methods": []any{"GET", "POST"}},
+			want:   map[string]string{"url": "http://a", "workers": "4", "rate": "2.5", "insecure": "true", "methods": "GET,POST"},
+		},
+		{
+			name:   "command line wins",
+			args:   []string{"-workers", "8"},
+			values: map[string]any{"workers": 4.0, "url": "http://a"},
+			want:   map[string]string{"workers": "8", "url": "http://a"},
+		},
+		{
+			name:   "lists keep commas in items",
+			values: map[string]any{"header": []any{"Accept: a, b", "X-Id: 1"}},
+			list:   []string{"Accept: a, b", "X-Id: 1"},
+		},
+		{
+			name:   "command line lists win",
+			args:   []string{"-header", "A: 1"},
+			values: map[string]any{"header": "B: 2"},
+			list:   []string{"A: 1"},
+		},
+		{
+			name:   "unknown key",
+			values: map[string]any{"wrokers": 4.0},
+			err:    `unknown config key "wrokers"`,
+		},
+		{
+			name:   "invalid value",
+			values: map[string]any{"workers": "many"},
+			err:    "workers",
+		},
+		{
+			name:   "unsupported value",
+			values: map[string]any{"url": map[string]any{"a": 1.0}},
+			err:    "unsupported value",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.String("url", "", "")
+			fs.Int("workers", 1, "")
+			fs.Float64("rate", 0, "")
+			fs.Bool("insecure", false, "")
+			fs.String("methods", "", "")
+			var headers StringList
+			fs.Var(&headers, "header", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := ApplyFlags(fs, tt.values)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ApplyFlags() error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyFlags() error = %v", err)
+			}
+			for name, want := range tt.want {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Errorf("-%s = %q, want %q", name, got, want)
+				}
+			}
+			if tt.list != nil && !reflect.DeepEqual([]string(headers), tt.list) {
+				t.Errorf("-header = %q, want %q", headers, tt.list)
+			}
+		})
+	}
+}
+
+func TestSection(t *testing.T) {
+	type section struct {
+		Name    string   `json:"name"`
+		Timeout Duration `json:"timeout"`
+	}
+	tests := []struct {
+		name   string
+		values map[string]any
+		want   section
+		found  bool
+		err    string
+	}{
+		{
+			name:   "present",
+			values: map[string]any{"s": map[string]any{"name": "a", "timeout": "1.5s"}, "other": 1.0},
+			want:   section{Name: "a", Timeout: Duration(1500 * time.Millisecond)},
+			found:  true,
+		},
+		{
+			name:   "missing",
+			values: map[string]any{"other": 1.0},
+		},
+		{
+			name:   "unknown field",
+			values: map[string]any{"s": map[string]any{"nmae": "a"}},
+			found:  true,
+			err:    "nmae",
+		},
+		{
+			name:   "duration must be a string",
+			values: map[string]any{"s": map[string]any{"timeout": 100.0}},
+			found:  true,
+			err:    "duration must be a string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got section
+			found, err := Section(tt.values, "s", &got)
+			if found != tt.found {
+				t.Errorf("Section() found = %v, want %v", found, tt.found)
+			}
+			if _, ok := tt.values["s"]; ok {
+				t.Error("Section() left the key in values")
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Section() error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Section() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Section() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package curl
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Command is the request described by a curl command line.
+type Command struct {
+	Method          string
+	URL             string
+	Headers         []Header
+	Body            string
+	Insecure        bool
+	FollowRedirects bool
+}
+
+type Header struct {
+	Name  string
+	Value string
+}
+
+// ignored are options that take no argument and don't change the request,
+// such as output and progress options.
+var ignored = map[string]bool{
+	"-s": true, "--silent": true, "-S": true, "--show-error": true,
+	"-v": true, "--verbose": true, "-i": true, "--include": true,
+	"--compressed": true, "--http1.1": true, "--http2": true,
+	"-f": true, "--fail": true, "-#": true, "--progress-bar": true,
+	"-N": true, "--no-buffer": true,
+}
+
+// Parse reads a command line as copied from browser developer tools
+// ("Copy as cURL"), e.g. curl -X POST 'https://...' -H 'Accept: ...' -d '...'.
+// Both POSIX shell quoting and line continuations are understood.
+func Parse(cmdline string) (*Command, error) {
+	args, err := split(cmdline)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return nil, errors.New("command must start with curl")
+	}
+
+	c := &Command{}
+	var data []string
+	head := false
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			if c.URL != "" {
+				return nil, fmt.Errorf("more than one URL: %q and %q", c.URL, arg)
+			}
+			c.URL = arg
+			continue
+		}
+		if ignored[arg] || ignoredCluster(arg) {
+			continue
+		}
+
+		name, value, inline := strings.Cut(arg, "=")
+		if !strings.HasPrefix(arg, "--") {
+			// short options may be followed by their value: -XPOST
+			name, value, inline = arg[:2], arg[2:], len(arg) > 2
+		}
+		switch name {
+		case "-I", "--head", "-k", "--insecure", "-L", "--location", "-G", "--get":
+			if inline {
+				return nil, fmt.Errorf("option %s takes no value", name)
+			}
+		default:
+			if !inline {
+				i++
+				if i == len(args) {
+					return nil, fmt.Errorf("option %s requires a value", name)
+				}
+				value = args[i]
+			}
+		}
+
+		switch name {
+		case "-X", "--request":
+			c.Method = strings.ToUpper(value)
+		case "--url":
+			c.URL = value
+		case "-H", "--header":
+			hname, hvalue, ok := strings.Cut(value, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid header %q", value)
+			}
+			c.Headers = append(c.Headers, Header{strings.TrimSpace(hname), strings.TrimSpace(hvalue)})
+		case "-A", "--user-agent":
+			c.Headers = append(c.Headers, Header{"User-Agent", value})
+		case "-e", "--referer":
+			c.Headers = append(c.Headers, Header{"Referer", value})
+		case "-b", "--cookie":
+			if !strings.Contains(value, "=") {
+				return nil, fmt.Errorf("cookie files are not supported: %q", value)
+			}
+			c.Headers = append(c.Headers, Header{"Cookie", value})
+		case "-u", "--user":
+			c.Headers = append(c.Headers, Header{"Authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte(value))})
+		case "-d", "--data", "--data-raw", "--data-binary", "--data-ascii":
+			if strings.HasPrefix(value, "@") && name != "--data-raw" {
+				return nil, fmt.Errorf("reading data from files is not supported: %q", value)
+			}
+			data = append(data, value)
+		case "--data-urlencode":
+			data = append(data, urlencode(value))
+		case "-I", "--head":
+			head = true
+		case "-G", "--get":
+			c.Method = "GET"
+		case "-k", "--insecure":
+			c.Insecure = true
+		case "-L", "--location":
+			c.FollowRedirects = true
+		default:
+			return nil, fmt.Errorf("unsupported option %s", name)
+		}
+	}
+	if c.URL == "" {
+		return nil, errors.New("missing URL")
+	}
+
+	switch {
+	case head:
+		c.Method = "HEAD"
+	case len(data) > 0 && c.Method == "GET":
+		// -G appends the data to the URL as query string
+		sep := "?"
+		if strings.Contains(c.URL, "?") {
+			sep = "&"
+		}
+		c.URL += sep + strings.Join(data, "&")
+	case len(data) > 0:
+		c.Body = strings.Join(data, "&")
+		if c.Method == "" {
+			c.Method = "POST"
+		}
+		if !c.hasHeader("Content-Type") {
+			c.Headers = append(c.Headers, Header{"Content-Type", "application/x-www-form-urlencoded"})
+		}
+	}
+	if c.Method == "" {
+		c.Method = "GET"
+	}
+	return c, nil
+}
+
+// ignoredCluster reports whether arg combines ignored short options, as in -sS.
+func ignoredCluster(arg string) bool {
+	if len(arg) < 3 || strings.HasPrefix(arg, "--") {
+		return false
+	}
+	for _, ch := range arg[1:] {
+		if !ignored["-"+string(ch)] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Command) hasHeader(name string) bool {
+	for _, h := range c.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlencode encodes a --data-urlencode value: "content", "=content" or
+// "name=content".
+func urlencode(value string) string {
+	name, content, ok := strings.Cut(value, "=")
+	if !ok {
+		return url.QueryEscape(value)
+	}
+	if name == "" {
+		return url.QueryEscape(content)
+	}
+	return name + "=" + url.QueryEscape(content)
+}
+
+// split breaks a command line into arguments like a POSIX shell, including
+// bash's $'...' strings that browsers emit for bodies with special characters.
+func split(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '\\' && i+1 < len(s) && (s[i+1] == '\n' || s[i+1] == '\r'):
+			// line continuation
+			i++
+			if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case ch == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			cur.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case ch == '$' && i+1 < len(s) && s[i+1] == '\'':
+			n, err := ansiC(s[i+2:], &cur)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 1
+			inArg = true
+		case ch == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				cur.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, errors.New("unterminated double quote")
+			}
+			inArg = true
+		case ch == '\\' && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+			inArg = true
+		default:
+			cur.WriteByte(ch)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// ansiC decodes the body of a $'...' string up to and including the closing
+// quote and returns the number of bytes consumed.
+func ansiC(s string, b *strings.Builder) (int, error) {
+	escapes := map[byte]byte{'n': '\n', 't': '\t', 'r': '\r', '\\': '\\', '\'': '\'', '"': '"', '0': 0}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			return i + 1, nil
+		case '\\':
+			if i+1 == len(s) {
+				return 0, errors.New("unterminated $' quote")
+			}
+			i++
+			if e, ok := escapes[s[i]]; ok {
+				b.WriteByte(e)
+			} else if s[i] == 'x' && i+2 < len(s) {
+				var v byte
+				if _, err := fmt.Sscanf(s[i+1:i+3], "%02x", &v); err != nil {
+					return 0, fmt.Errorf("invalid escape \\x%s", s[i+1:i+3])
+				}
+				b.WriteByte(v)
+				i += 2
+			} else {
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return 0, errors.New("unterminated $' quote")
+}
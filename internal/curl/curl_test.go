@@ -0,0 +1,124 @@
+package curl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmdline string
+		want    *Command
+		err     string
+	}{
+		{
+			name:    "plain GET",
+			cmdline: "curl https://example.com/",
+			want:    &Command{Method: "GET", URL: "https://example.com/"},
+		},
+		{
+			name: "copied from the browser",
+			cmdline: `curl 'https://example.com/api?q=1' \
+  -H 'Accept: application/json' \
+  -H 'Cookie: a=b; c=d' \
+  --compressed`,
+			want: &Command{Method: "GET", URL: "https://example.com/api?q=1", Headers: []Header{
+				{"Accept", "application/json"},
+				{"Cookie", "a=b; c=d"},
+			}},
+		},
+		{
+			name:    "windows line continuations",
+			cmdline: "curl 'https://example.com/' \\\r\n  -H 'Accept: */*'",
+			want:    &Command{Method: "GET", URL: "https://example.com/", Headers: []Header{{"Accept", "*/*"}}},
+		},
+		{
+			name:    "data makes a form POST",
+			cmdline: `curl https://example.com/login -d 'user=ann' --data "pass=s3cret"`,
+			want: &Command{Method: "POST", URL: "https://example.com/login", Body: "user=ann&pass=s3cret", Headers: []Header{
+				{"Content-Type", "application/x-www-form-urlencoded"},
+			}},
+		},
+		{
+			name:    "explicit method and content type",
+			cmdline: `curl -X put https://example.com/items/1 -H 'content-type: application/json' --data-raw '{"a":1}'`,
+			want: &Command{Method: "PUT", URL: "https://example.com/items/1", Body: `{"a":1}`, Headers: []Header{
+				{"content-type", "application/json"},
+			}},
+		},
+		{
+			name:    "inline values",
+			cmdline: `curl -XDELETE --url=https://example.com/items/1 -HAccept:text/plain`,
+			want:    &Command{Method: "DELETE", URL: "https://example.com/items/1", Headers: []Header{{"Accept", "text/plain"}}},
+		},
+		{
+			name:    "ANSI-C quoted body",
+			cmdline: `curl https://example.com/ --data-raw $'{"text":"it\'s\\n\x41"}'`,
+			want: &Command{Method: "POST", URL: "https://example.com/", Body: `{"text":"it's\nA"}`, Headers: []Header{
+				{"Content-Type", "application/x-www-form-urlencoded"},
+			}},
+		},
+		{
+			name:    "double quotes and escapes",
+			cmdline: `curl "https://example.com/" -H "X-Quote: say \"hi\"" -H X-Space:\ a`,
+			want:    &Command{Method: "GET", URL: "https://example.com/", Headers: []Header{{"X-Quote", `say "hi"`}, {"X-Space", "a"}}},
+		},
+		{
+			name:    "shorthand headers",
+			cmdline: `curl https://example.com/ -A agent/1.0 -e https://ref.example.com/ -b 'a=1' -u ann:pw`,
+			want: &Command{Method: "GET", URL: "https://example.com/", Headers: []Header{
+				{"User-Agent", "agent/1.0"},
+				{"Referer", "https://ref.example.com/"},
+				{"Cookie", "a=1"},
+				{"Authorization", "Basic YW5uOnB3"},
+			}},
+		},
+		{
+			name:    "get appends data to the query",
+			cmdline: `curl -G https://example.com/search?lang=en --data-urlencode 'q=a b&c' --data-urlencode =x/y`,
+			want:    &Command{Method: "GET", URL: "https://example.com/search?lang=en&q=a+b%26c&x%2Fy"},
+		},
+		{
+			name:    "head",
+			cmdline: `curl -I https://example.com/`,
+			want:    &Command{Method: "HEAD", URL: "https://example.com/"},
+		},
+		{
+			name:    "flags",
+			cmdline: `curl -sS https://example.com/ -k --location -v`,
+			want:    &Command{Method: "GET", URL: "https://example.com/", Insecure: true, FollowRedirects: true},
+		},
+		{name: "not curl", cmdline: "wget https://example.com/", err: "must start with curl"},
+		{name: "empty", cmdline: "", err: "must start with curl"},
+		{name: "missing URL", cmdline: "curl -H 'Accept: */*'", err: "missing URL"},
+		{name: "two URLs", cmdline: "curl https://a.example.com/ https://b.example.com/", err: "more than one URL"},
+		{name: "missing value", cmdline: "curl https://example.com/ -H", err: "requires a value"},
+		{name: "value for a switch", cmdline: "curl https://example.com/ -kx", err: "takes no value"},
+		{name: "invalid header", cmdline: "curl https://example.com/ -H 'Accept'", err: "invalid header"},
+		{name: "cookie file", cmdline: "curl https://example.com/ -b cookies.txt", err: "cookie files"},
+		{name: "data file", cmdline: "curl https://example.com/ -d @body.json", err: "reading data from files"},
+		{name: "unsupported option", cmdline: "curl https://example.com/ -o out.html", err: "unsupported option -o"},
+		{name: "unterminated single quote", cmdline: "curl 'https://example.com/", err: "unterminated single quote"},
+		{name: "unterminated double quote", cmdline: `curl "https://example.com/`, err: "unterminated double quote"},
+		{name: "unterminated ANSI-C quote", cmdline: `curl https://example.com/ -d $'a`, err: "unterminated $' quote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.cmdline)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Parse() error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package dist
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rand is the subset of *rand.Rand used for sampling.
+type Rand interface {
+	Float64() float64
+	NormFloat64() float64
+	ExpFloat64() float64
+}
+
+// Distribution produces random values. Durations given in the spec are
+// sampled as nanoseconds.
+type Distribution interface {
+	Sample(r Rand) float64
+	String() string
+}
+
+// Parse reads a distribution spec such as "constant(100ms)",
+// "uniform(50ms,150ms)", "normal(100ms,20ms)", "exponential(100ms)",
+// "lognormal(200ms,1.5)" or "pareto(10ms,2.5)". A bare value is a constant.
+func Parse(spec string) (Distribution, error) {
+	spec = strings.TrimSpace(spec)
+	open := strings.IndexByte(spec, '(')
+	if open < 0 {
+		v, err := parseValue(spec)
+		if err != nil {
+			return nil, err
+		}
+		return constant{spec: spec, v: v}, nil
+	}
+	if !strings.HasSuffix(spec, ")") {
+		return nil, fmt.Errorf("invalid distribution %q: missing closing parenthesis", spec)
+	}
+
+	name := strings.ToLower(strings.TrimSpace(spec[:open]))
+	var args []float64
+	for _, arg := range strings.Split(spec[open+1:len(spec)-1], ",") {
+		v, err := parseValue(strings.TrimSpace(arg))
+		if err != nil {
+			return nil, fmt.Errorf("invalid distribution %q: %w", spec, err)
+		}
+		args = append(args, v)
+	}
+
+	want := map[string]int{
+		"constant":    1,
+		"uniform":     2,
+		"normal":      2,
+		"exponential": 1,
+		"lognormal":   2,
+		"pareto":      2,
+	}
+	n, ok := want[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown distribution %q", name)
+	}
+	if len(args) != n {
+		return nil, fmt.Errorf("invalid distribution %q: %s takes %d argument(s)", spec, name, n)
+	}
+
+	switch name {
+	case "constant":
+		return constant{spec: spec, v: args[0]}, nil
+	case "uniform":
+		if args[1] < args[0] {
+			return nil, fmt.Errorf("invalid distribution %q: max is lower than min", spec)
+		}
+		return uniform{spec: spec, min: args[0], max: args[1]}, nil
+	case "normal":
+		return normal{spec: spec, mean: args[0], stddev: args[1]}, nil
+	case "exponential":
+		return exponential{spec: spec, mean: args[0]}, nil
+	case "lognormal":
+		if args[0] <= 0 {
+			return nil, fmt.Errorf("invalid distribution %q: median must be positive", spec)
+		}
+		return lognormal{spec: spec, mu: math.Log(args[0]), sigma: args[1]}, nil
+	case "pareto":
+		if args[0] <= 0 || args[1] <= 0 {
+			return nil, fmt.Errorf("invalid distribution %q: scale and shape must be positive", spec)
+		}
+		return pareto{spec: spec, scale: args[0], shape: args[1]}, nil
+	}
+	return nil, fmt.Errorf("unknown distribution %q", name)
+}
+
+// SampleDuration samples d as a non-negative duration.
+func SampleDuration(d Distribution, r Rand) time.Duration {
+	return time.Duration(max(d.Sample(r), 0))
+}
+
+func parseValue(s string) (float64, error) {
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return float64(d), nil
+}
+
+type constant struct {
+	spec string
+	v    float64
+}
+
+func (d constant) Sample(Rand) float64 { return d.v }
+func (d constant) String() string      { return d.spec }
+
+type uniform struct {
+	spec     string
+	min, max float64
+}
+
+func (d uniform) Sample(r Rand) float64 { return d.min + r.Float64()*(d.max-d.min) }
+func (d uniform) String() string        { return d.spec }
+
+type normal struct {
+	spec         string
+	mean, stddev float64
+}
+
+func (d normal) Sample(r Rand) float64 { return d.mean + r.NormFloat64()*d.stddev }
+func (d normal) String() string        { return d.spec }
+
+type exponential struct {
+	spec string
+	mean float64
+}
+
+func (d exponential) Sample(r Rand) float64 { return r.ExpFloat64() * d.mean }
+func (d exponential) String() string        { return d.spec }
+
+type lognormal struct {
+	spec      string
+	mu, sigma float64
+}
+
+func (d lognormal) Sample(r Rand) float64 { return math.Exp(d.mu + d.sigma*r.NormFloat64()) }
+func (d lognormal) String() string        { return d.spec }
+
+type pareto struct {
+	spec         string
+	scale, shape float64
+}
+
+func (d pareto) Sample(r Rand) float64 {
+	return d.scale / math.Pow(1-r.Float64(), 1/d.shape)
+}
+func (d pareto) String() string { return d.spec }
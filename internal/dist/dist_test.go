@@ -0,0 +1,102 @@
+package dist
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedRand returns the same values on every call.
+type fixedRand struct {
+	float, norm, exp float64
+}
+
+func (r fixedRand) Float64() float64     { return r.float }
+func (r fixedRand) NormFloat64() float64 { return r.norm }
+func (r fixedRand) ExpFloat64() float64  { return r.exp }
+
+func TestParse(t *testing.T) {
+	r := fixedRand{float: 0.5, norm: 1, exp: 2}
+	ms := float64(time.Millisecond)
+
+	tests := []struct {
+		spec string
+		want float64
+		err  string
+	}{
+		{spec: "100ms", want: 100 * ms},
+		{spec: " 2.5 ", want: 2.5},
+		{spec: "constant(100ms)", want: 100 * ms},
+		{spec: "uniform(50ms, 150ms)", want: 100 * ms},
+		{spec: "uniform(1,1)", want: 1},
+		{spec: "normal(100ms,20ms)", want: 120 * ms},
+		{spec: "Normal(100ms,20ms)", want: 120 * ms},
+		{spec: "exponential(100ms)", want: 200 * ms},
+		{spec: "lognormal(200ms,0)", want: 200 * ms},
+		{spec: "lognormal(1,1)", want: math.E},
+		{spec: "pareto(10ms,1)", want: 20 * ms},
+		{spec: "fast", err: `invalid value "fast"`},
+		{spec: "uniform(1,2", err: "missing closing parenthesis"},
+		{spec: "gamma(1,2)", err: `unknown distribution "gamma"`},
+		{spec: "normal(1)", err: "normal takes 2 argument(s)"},
+		{spec: "constant(1,2)", err: "constant takes 1 argument(s)"},
+		{spec: "constant()", err: `invalid value ""`},
+		{spec: "uniform(2,1)", err: "max is lower than min"},
+		{spec: "lognormal(0,1)", err: "median must be positive"},
+		{spec: "pareto(1,0)", err: "scale and shape must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			d, err := Parse(tt.spec)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Parse(%q) error = %v, want it to contain %q", tt.spec, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.spec, err)
+			}
+			if got := d.Sample(r); math.Abs(got-tt.want) > 1e-6*math.Max(1, tt.want) {
+				t.Errorf("Sample() = %v, want %v", got, tt.want)
+			}
+			if got := d.String(); got != strings.TrimSpace(tt.spec) {
+				t.Errorf("String() = %q, want %q", got, strings.TrimSpace(tt.spec))
+			}
+		})
+	}
+}
+
+func TestSampleDuration(t *testing.T) {
+	tests := []struct {
+		spec string
+		r    fixedRand
+		want time.Duration
+	}{
+		{spec: "normal(100ms,20ms)", r: fixedRand{norm: 1}, want: 120 * time.Millisecond},
+		{spec: "normal(100ms,20ms)", r: fixedRand{norm: -10}, want: 0},
+		{spec: "-5ms", want: 0},
+	}
+	for _, tt := range tests {
+		d, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.spec, err)
+		}
+		if got := SampleDuration(d, tt.r); got != tt.want {
+			t.Errorf("SampleDuration(%s) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestLockedRandSeed(t *testing.T) {
+	a, b := NewLockedRand(7), NewLockedRand(7)
+	for range 10 {
+		if x, y := a.Uint64(), b.Uint64(); x != y {
+			t.Fatalf("same seed gave %d and %d", x, y)
+		}
+	}
+	if NewLockedRand(7).Uint64() == NewLockedRand(8).Uint64() {
+		t.Error("different seeds gave the same value")
+	}
+}
@@ -0,0 +1,52 @@
+package dist
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+// LockedRand is a *rand.Rand that is safe for concurrent use.
+type LockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func NewLockedRand(seed int64) *LockedRand {
+	return &LockedRand{r: rand.New(rand.NewPCG(uint64(seed), 0))}
+}
+
+func (l *LockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+func (l *LockedRand) NormFloat64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.NormFloat64()
+}
+
+func (l *LockedRand) ExpFloat64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.ExpFloat64()
+}
+
+func (l *LockedRand) IntN(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.IntN(n)
+}
+
+func (l *LockedRand) Int64N(n int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Int64N(n)
+}
+
+func (l *LockedRand) Uint64() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Uint64()
+}
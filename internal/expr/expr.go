@@ -0,0 +1,151 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Condition is a boolean expression over named metrics, such as
+// "p95 > 500ms and error_rate < 5%". Clauses are joined with "and" / "or",
+// where "and" binds tighter. Duration literals are converted to milliseconds
+// and percentages to fractions.
+type Condition struct {
+	source string
+	anyOf  [][]comparison
+}
+
+type comparison struct {
+	name  string
+	op    string
+	value float64
+}
+
+var operators = []string{">=", "<=", "==", "!=", ">", "<"}
+
+func Parse(s string) (*Condition, error) {
+	c := &Condition{source: s}
+	for _, group := range splitWord(s, "or") {
+		var all []comparison
+		for _, clause := range splitWord(group, "and") {
+			cmp, err := parseComparison(clause)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %w", s, err)
+			}
+			all = append(all, cmp)
+		}
+		c.anyOf = append(c.anyOf, all)
+	}
+	return c, nil
+}
+
+func (c *Condition) String() string {
+	return c.source
+}
+
+// Names returns every metric name the condition refers to.
+func (c *Condition) Names() []string {
+	var names []string
+	for _, all := range c.anyOf {
+		for _, cmp := range all {
+			names = append(names, cmp.name)
+		}
+	}
+	return names
+}
+
+func (c *Condition) Eval(vars map[string]float64) (bool, error) {
+	for _, all := range c.anyOf {
+		matched := true
+		for _, cmp := range all {
+			v, ok := vars[cmp.name]
+			if !ok {
+				return false, fmt.Errorf("unknown metric %q", cmp.name)
+			}
+			if !compare(v, cmp.op, cmp.value) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func compare(a float64, op string, b float64) bool {
+	switch op {
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	}
+	return false
+}
+
+func splitWord(s, word string) []string {
+	fields := strings.Fields(s)
+	var parts []string
+	var cur []string
+	for _, f := range fields {
+		if strings.EqualFold(f, word) {
+			parts = append(parts, strings.Join(cur, " "))
+			cur = nil
+			continue
+		}
+		cur = append(cur, f)
+	}
+	return append(parts, strings.Join(cur, " "))
+}
+
+func parseComparison(s string) (comparison, error) {
+	for _, op := range operators {
+		i := strings.Index(s, op)
+		if i < 0 {
+			continue
+		}
+		name := strings.TrimSpace(s[:i])
+		if name == "" {
+			return comparison{}, fmt.Errorf("missing metric name in %q", s)
+		}
+		value, err := ParseValue(strings.TrimSpace(s[i+len(op):]))
+		if err != nil {
+			return comparison{}, err
+		}
+		return comparison{name: name, op: op, value: value}, nil
+	}
+	return comparison{}, fmt.Errorf("no comparison operator in %q", s)
+}
+
+// ParseValue parses a number, a percentage (converted to a fraction) or a
+// duration (converted to milliseconds).
+func ParseValue(s string) (float64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("missing value")
+	}
+	if strings.HasSuffix(s, "%") {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return v / 100, nil
+	}
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return float64(d) / float64(time.Millisecond), nil
+}
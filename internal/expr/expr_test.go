@@ -0,0 +1,101 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		err  string
+	}{
+		{in: "42", want: 42},
+		{in: "-1.5", want: -1.5},
+		{in: "5%", want: 0.05},
+		{in: "500ms", want: 500},
+		{in: "1.5s", want: 1500},
+		{in: "250us", want: 0.25},
+		{in: "", err: "missing value"},
+		{in: "x%", err: "invalid syntax"},
+		{in: "fast", err: `invalid value "fast"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseValue(tt.in)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ParseValue(%q) error = %v, want it to contain %q", tt.in, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseValue(%q) error = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseValue(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCondition(t *testing.T) {
+	vars := map[string]float64{"p95": 600, "error_rate": 0.02, "rps": 100}
+
+	tests := []struct {
+		cond  string
+		names []string
+		want  bool
+		err   string
+	}{
+		{cond: "p95 > 500ms", names: []string{"p95"}, want: true},
+		{cond: "p95 >= 600ms", names: []string{"p95"}, want: true},
+		{cond: "p95 < 600", names: []string{"p95"}, want: false},
+		{cond: "p95 <= 600", names: []string{"p95"}, want: true},
+		{cond: "rps == 100", names: []string{"rps"}, want: true},
+		{cond: "rps != 100", names: []string{"rps"}, want: false},
+		{cond: "p95>500ms", names: []string{"p95"}, want: true},
+		{cond: "p95 > 500ms and error_rate < 5%", names: []string{"p95", "error_rate"}, want: true},
+		{cond: "p95 > 500ms AND error_rate < 1%", names: []string{"p95", "error_rate"}, want: false},
+		{cond: "p95 > 1s or error_rate < 5%", names: []string{"p95", "error_rate"}, want: true},
+		// and binds tighter than or
+		{cond: "rps < 10 and p95 > 1s or error_rate > 1%", names: []string{"rps", "p95", "error_rate"}, want: true},
+		{cond: "rps > 10 or p95 > 1s and error_rate > 5%", names: []string{"rps", "p95", "error_rate"}, want: true},
+		{cond: "rps < 10 or p95 > 1s and error_rate > 1%", names: []string{"rps", "p95", "error_rate"}, want: false},
+		{cond: "p50 > 1", err: `unknown metric "p50"`},
+		{cond: "p95 500", err: "no comparison operator"},
+		{cond: "> 500", err: "missing metric name"},
+		{cond: "p95 >", err: "missing value"},
+		{cond: "p95 > fast", err: `invalid value "fast"`},
+		{cond: "p95 > 1 and", err: "no comparison operator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			c, err := Parse(tt.cond)
+			var got bool
+			if err == nil {
+				got, err = c.Eval(vars)
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("%q error = %v, want it to contain %q", tt.cond, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%q error = %v", tt.cond, err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval(%q) = %v, want %v", tt.cond, got, tt.want)
+			}
+			if names := c.Names(); !reflect.DeepEqual(names, tt.names) {
+				t.Errorf("Names() = %q, want %q", names, tt.names)
+			}
+			if c.String() != tt.cond {
+				t.Errorf("String() = %q, want %q", c.String(), tt.cond)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type Event struct {
+	Host string
+	From string
+	To   string
+	Err  error
+}
+
+// Dialer resolves the target host itself and sticks to one of its addresses
+// until that address keeps failing, at which point new connections move on to
+// the next healthy address.
+type Dialer struct {
+	Network          string
+	Timeout          time.Duration
+	FailureThreshold int
+	Cooldown         time.Duration
+	ResolveTTL       time.Duration
+	OnFailover       func(Event)
+
+	mu        sync.Mutex
+	hosts     map[string]*hostState
+	failovers int64
+}
+
+type hostState struct {
+	addrs      []string
+	current    int
+	failures   map[string]int
+	downUntil  map[string]time.Time
+	resolvedAt time.Time
+}
+
+func NewDialer(timeout time.Duration, threshold int, cooldown time.Duration) *Dialer {
+	return &Dialer{
+		Network:          "tcp",
+		Timeout:          timeout,
+		FailureThreshold: threshold,
+		Cooldown:         cooldown,
+		ResolveTTL:       30 * time.Second,
+		hosts:            map[string]*hostState{},
+	}
+}
+
+func (d *Dialer) Failovers() int64 {
+	return atomic.LoadInt64(&d.failovers)
+}
+
+func (d *Dialer) Dial(addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := d.candidates(host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range candidates {
+		conn, err := net.DialTimeout(d.Network, net.JoinHostPort(ip, port), d.Timeout)
+		if err != nil {
+			lastErr = err
+			d.reportFailure(host, ip, err)
+			continue
+		}
+		d.reportSuccess(host, ip)
+		return &trackedConn{Conn: conn, dialer: d, host: host, ip: ip}, nil
+	}
+	return nil, lastErr
+}
+
+func (d *Dialer) candidates(host string) ([]string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{host}, nil
+	}
+
+	d.mu.Lock()
+	state, ok := d.hosts[host]
+	stale := !ok || time.Since(state.resolvedAt) > d.ResolveTTL
+	d.mu.Unlock()
+
+	if stale {
+		ctx, cancel := context.WithTimeout(context.Background(), d.Timeout)
+		ips, err := net.DefaultResolver.LookupIP(ctx, lookupNetwork(d.Network), host)
+		cancel()
+		addrs := make([]string, len(ips))
+		for i, ip := range ips {
+			addrs[i] = ip.String()
+		}
+		if err != nil {
+			if ok {
+				return d.ordered(state), nil
+			}
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no addresses found for %s", host)
+		}
+
+		d.mu.Lock()
+		if ok {
+			state.addrs = addrs
+			state.resolvedAt = time.Now()
+			if state.current >= len(addrs) {
+				state.current = 0
+			}
+		} else {
+			state = &hostState{
+				addrs:      addrs,
+				failures:   map[string]int{},
+				downUntil:  map[string]time.Time{},
+				resolvedAt: time.Now(),
+			}
+			d.hosts[host] = state
+		}
+		d.mu.Unlock()
+	}
+
+	return d.ordered(state), nil
+}
+
+// ordered returns the addresses starting from the current one, with addresses
+// that are still cooling down moved to the end as a last resort.
+func (d *Dialer) ordered(state *hostState) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	healthy := make([]string, 0, len(state.addrs))
+	var down []string
+	for i := range state.addrs {
+		ip := state.addrs[(state.current+i)%len(state.addrs)]
+		if now.Before(state.downUntil[ip]) {
+			down = append(down, ip)
+		} else {
+			healthy = append(healthy, ip)
+		}
+	}
+	return append(healthy, down...)
+}
+
+func (d *Dialer) reportSuccess(host, ip string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.hosts[host]
+	if !ok {
+		return
+	}
+	state.failures[ip] = 0
+}
+
+func (d *Dialer) reportFailure(host, ip string, err error) {
+	d.mu.Lock()
+	state, ok := d.hosts[host]
+	if !ok || len(state.addrs) < 2 {
+		d.mu.Unlock()
+		return
+	}
+
+	state.failures[ip]++
+	if state.failures[ip] < d.FailureThreshold || state.addrs[state.current] != ip {
+		d.mu.Unlock()
+		return
+	}
+
+	state.failures[ip] = 0
+	state.downUntil[ip] = time.Now().Add(d.Cooldown)
+	state.current = (state.current + 1) % len(state.addrs)
+	event := Event{Host: host, From: ip, To: state.addrs[state.current], Err: err}
+	d.mu.Unlock()
+
+	atomic.AddInt64(&d.failovers, 1)
+	if d.OnFailover != nil {
+		d.OnFailover(event)
+	}
+}
+
+func lookupNetwork(network string) string {
+	switch network {
+	case "tcp4":
+		return "ip4"
+	case "tcp6":
+		return "ip6"
+	}
+	return "ip"
+}
+
+type trackedConn struct {
+	net.Conn
+	dialer *Dialer
+	host   string
+	ip     string
+}
+
+func (c *trackedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if isReset(err) {
+		c.dialer.reportFailure(c.host, c.ip, err)
+	}
+	return n, err
+}
+
+func (c *trackedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if isReset(err) {
+		c.dialer.reportFailure(c.host, c.ip, err)
+	}
+	return n, err
+}
+
+func isReset(err error) bool {
+	return err != nil && (errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE))
+}
@@ -0,0 +1,155 @@
+package feeder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Feeder hands out rows of a data file one after another, starting over
+// after the last row.
+type Feeder struct {
+	columns map[string]bool
+	rows    []map[string]string
+	next    uint64
+}
+
+// Load reads a CSV file with a header row, a JSON array of objects, or
+// newline-delimited JSON objects (.ndjson, .jsonl).
+func Load(path string) (*Feeder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		rows, err = parseCSV(data)
+	case ".json":
+		rows, err = parseJSON(data)
+	case ".ndjson", ".jsonl":
+		rows, err = parseNDJSON(data)
+	default:
+		return nil, fmt.Errorf("%s: unsupported data file, expected .csv, .json, .ndjson or .jsonl", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s: no rows", path)
+	}
+
+	f := &Feeder{columns: map[string]bool{}, rows: rows}
+	for _, row := range rows {
+		for col := range row {
+			f.columns[col] = true
+		}
+	}
+	return f, nil
+}
+
+func (f *Feeder) Len() int {
+	return len(f.rows)
+}
+
+func (f *Feeder) HasColumn(name string) bool {
+	return f.columns[name]
+}
+
+// Next returns the next row. It is safe for concurrent use.
+func (f *Feeder) Next() map[string]string {
+	n := atomic.AddUint64(&f.next, 1) - 1
+	return f.rows[n%uint64(len(f.rows))]
+}
+
+func parseCSV(data []byte) ([]map[string]string, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("missing header row")
+	}
+	header := records[0]
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(header))
+		for i, col := range header {
+			row[strings.TrimSpace(col)] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseJSON(data []byte) ([]map[string]string, error) {
+	var objects []map[string]any
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]string, len(objects))
+	for i, obj := range objects {
+		row, err := stringify(obj)
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+func parseNDJSON(data []byte) ([]map[string]string, error) {
+	var rows []map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(text), &obj); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		row, err := stringify(obj)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// stringify converts JSON values to the text inserted into requests. Nested
+// objects and arrays are kept as JSON.
+func stringify(obj map[string]any) (map[string]string, error) {
+	row := make(map[string]string, len(obj))
+	for k, v := range obj {
+		switch v := v.(type) {
+		case string:
+			row[k] = v
+		case float64:
+			row[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			row[k] = strconv.FormatBool(v)
+		case nil:
+			row[k] = ""
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			row[k] = string(b)
+		}
+	}
+	return row, nil
+}
@@ -0,0 +1,97 @@
+package feeder
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []map[string]string
+		err     string
+	}{
+		{
+			name:    "csv",
+			file:    "users.csv",
+			content: "id, name\n1,ann\n2,\"bob, jr\"\n",
+			want:    []map[string]string{{"id": "1", "name": "ann"}, {"id": "2", "name": "bob, jr"}},
+		},
+		{
+			name:    "json",
+			file:    "users.JSON",
+			content: `[{"id": 1, "name": "ann", "admin": true, "team": null}, {"id": 2.5, "tags": ["a"], "meta": {"b": 1}}]`,
+			want: []map[string]string{
+				{"id": "1", "name": "ann", "admin": "true", "team": ""},
+				{"id": "2.5", "tags": `["a"]`, "meta": `{"b":1}`},
+			},
+		},
+		{
+			name:    "ndjson",
+			file:    "users.ndjson",
+			content: "{\"id\": 1}\n\n  {\"id\": 2}  \n",
+			want:    []map[string]string{{"id": "1"}, {"id": "2"}},
+		},
+		{
+			name:    "jsonl",
+			file:    "users.jsonl",
+			content: `{"id": "a"}`,
+			want:    []map[string]string{{"id": "a"}},
+		},
+		{name: "unsupported extension", file: "users.txt", content: "1", err: "unsupported data file"},
+		{name: "empty csv", file: "users.csv", content: "", err: "missing header row"},
+		{name: "header only", file: "users.csv", content: "id,name\n", err: "no rows"},
+		{name: "ragged csv", file: "users.csv", content: "id,name\n1\n", err: "wrong number of fields"},
+		{name: "empty json", file: "users.json", content: "[]", err: "no rows"},
+		{name: "invalid json", file: "users.json", content: `{"id": 1}`, err: "cannot unmarshal"},
+		{name: "invalid ndjson line", file: "users.ndjson", content: "{\"id\": 1}\n[1]\n", err: "line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := Load(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Load() error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !reflect.DeepEqual(f.rows, tt.want) {
+				t.Errorf("Load() rows = %v, want %v", f.rows, tt.want)
+			}
+			if f.Len() != len(tt.want) {
+				t.Errorf("Len() = %d, want %d", f.Len(), len(tt.want))
+			}
+			for col := range tt.want[0] {
+				if !f.HasColumn(col) {
+					t.Errorf("HasColumn(%q) = false", col)
+				}
+			}
+			if f.HasColumn("missing") {
+				t.Error(`HasColumn("missing") = true`)
+			}
+		})
+	}
+}
+
+func TestNextWrapsAround(t *testing.T) {
+	f := &Feeder{rows: []map[string]string{{"id": "1"}, {"id": "2"}}}
+	var got []string
+	for range 5 {
+		got = append(got, f.Next()["id"])
+	}
+	if want := []string{"1", "2", "1", "2", "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Next() gave %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,48 @@
+// Package hook is the interface of plugins that change the requests of the
+// load and check their responses, e.g. to sign requests or to decide from
+// the body whether a request succeeded.
+//
+// A plugin is a main package built with -buildmode=plugin from within this
+// module, so that it uses the same versions of its dependencies, and
+// exports
+//
+//	func New(args string) (hook.Hooks, error)
+//
+// which is called once with the value of -hook_args.
+package hook
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Hooks are called for every request of the load, from many goroutines at
+// once.
+type Hooks interface {
+	// BeforeRequest is called right before a request is sent and may
+	// change it. An error fails the request without sending it.
+	BeforeRequest(req *fasthttp.Request) error
+	// AfterResponse is called with every response that was received. An
+	// error counts the request as failed.
+	AfterResponse(req *fasthttp.Request, resp *fasthttp.Response) error
+}
+
+// Load opens the plugin at path and creates its hooks. Plugins are only
+// supported on linux, freebsd and darwin, in binaries built with cgo.
+func Load(path, args string) (Hooks, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("New")
+	if err != nil {
+		return nil, err
+	}
+	newHooks, ok := sym.(func(string) (Hooks, error))
+	if !ok {
+		return nil, fmt.Errorf("%s: New is %T, not func(string) (hook.Hooks, error)", path, sym)
+	}
+	return newHooks(args)
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package limits
+
+func OpenFiles() int {
+	return 0
+}
@@ -0,0 +1,41 @@
+package limits
+
+// reservedFiles is kept free for stdio, log and output files, listeners and
+// the resolver.
+const reservedFiles = 64
+
+type Limits struct {
+	OpenFiles uint64
+	// OpenFilesMax is the hard limit the soft OpenFiles can be raised to.
+	OpenFilesMax   uint64
+	EphemeralPorts int
+}
+
+func Detect() Limits {
+	soft, hard := openFilesLimits()
+	return Limits{
+		OpenFiles:      soft,
+		OpenFilesMax:   hard,
+		EphemeralPorts: ephemeralPorts(),
+	}
+}
+
+// OpenFilesFor returns the open files limit needed for conns concurrent
+// connections.
+func OpenFilesFor(conns int) uint64 {
+	return uint64(conns) + reservedFiles
+}
+
+// MaxConnections returns how many concurrent outgoing connections the
+// process can hold, or 0 if no limit could be detected.
+func (l Limits) MaxConnections() int {
+	limit := 0
+	if l.OpenFiles > 0 {
+		limit = int(l.OpenFiles) - reservedFiles
+		limit = max(limit, 1)
+	}
+	if l.EphemeralPorts > 0 && (limit == 0 || l.EphemeralPorts < limit) {
+		limit = l.EphemeralPorts
+	}
+	return limit
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package limits
+
+import "errors"
+
+func openFilesLimits() (soft, hard uint64) {
+	return 0, 0
+}
+
+func RaiseOpenFiles(n uint64) error {
+	return errors.ErrUnsupported
+}
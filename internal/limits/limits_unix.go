@@ -0,0 +1,39 @@
+//go:build unix
+
+package limits
+
+import (
+	"math"
+	"syscall"
+)
+
+// openFilesLimits returns the soft and hard limit of open files, 0 if
+// unlimited or unknown.
+func openFilesLimits() (soft, hard uint64) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0, 0
+	}
+	soft, hard = uint64(rlim.Cur), uint64(rlim.Max)
+	if soft > math.MaxInt32 {
+		soft = 0
+	}
+	if hard > math.MaxInt32 {
+		hard = 0
+	}
+	return soft, hard
+}
+
+// RaiseOpenFiles raises the soft limit of open files to n, or to the hard
+// limit if that is lower.
+func RaiseOpenFiles(n uint64) error {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return err
+	}
+	if n <= uint64(rlim.Cur) {
+		return nil
+	}
+	rlim.Cur = min(n, uint64(rlim.Max))
+	return syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlim)
+}
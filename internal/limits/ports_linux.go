@@ -0,0 +1,20 @@
+//go:build linux
+
+package limits
+
+import (
+	"fmt"
+	"os"
+)
+
+func ephemeralPorts() int {
+	data, err := os.ReadFile("/proc/sys/net/ipv4/ip_local_port_range")
+	if err != nil {
+		return 0
+	}
+	var low, high int
+	if _, err := fmt.Sscan(string(data), &low, &high); err != nil || high < low {
+		return 0
+	}
+	return high - low + 1
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package limits
+
+func ephemeralPorts() int {
+	return 0
+}
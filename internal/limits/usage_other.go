@@ -0,0 +1,9 @@
+//go:build !unix
+
+package limits
+
+import "time"
+
+func CPUTime() time.Duration {
+	return 0
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package limits
+
+import (
+	"syscall"
+	"time"
+)
+
+// CPUTime returns the user and system CPU time used by the process so far,
+// or 0 if it can't be read.
+func CPUTime() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
@@ -0,0 +1,210 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	SMTP = "smtp"
+	IMAP = "imap"
+)
+
+type Timing struct {
+	Command  string
+	Duration time.Duration
+}
+
+// Prober runs mail sessions against Addr. Dial opens the connections, so
+// that they take the same path as any other traffic of the run; if it is
+// nil, a net.Dialer on Network is used.
+type Prober struct {
+	Protocol  string
+	Network   string
+	Dial      func(addr string) (net.Conn, error)
+	Addr      string
+	TLS       bool
+	TLSConfig *tls.Config
+	Commands  []string
+	Hostname  string
+	Timeout   time.Duration
+}
+
+func DefaultPort(scheme string) string {
+	switch scheme {
+	case "smtp":
+		return "25"
+	case "smtps":
+		return "465"
+	case "imap":
+		return "143"
+	case "imaps":
+		return "993"
+	}
+	return ""
+}
+
+// Probe opens a connection, reads the server greeting, runs the configured
+// commands and closes the session, timing every step.
+func (p *Prober) Probe(ctx context.Context) (timings []Timing, err error) {
+	deadline := time.Now().Add(p.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	start := time.Now()
+	conn, err := p.dial(ctx, deadline)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	timings = append(timings, Timing{Command: "CONNECT", Duration: time.Since(start)})
+
+	s := &session{r: bufio.NewReader(conn), w: conn, protocol: p.Protocol}
+
+	start = time.Now()
+	if err := s.readGreeting(); err != nil {
+		return timings, err
+	}
+	timings = append(timings, Timing{Command: "GREETING", Duration: time.Since(start)})
+
+	commands := make([]string, 0, len(p.Commands)+1)
+	commands = append(commands, p.Commands...)
+	commands = append(commands, s.quitCommand())
+	for _, cmd := range commands {
+		cmd = strings.ToUpper(strings.TrimSpace(cmd))
+		if cmd == "" {
+			continue
+		}
+		line := cmd
+		if p.Protocol == SMTP && (cmd == "EHLO" || cmd == "HELO") {
+			line = cmd + " " + p.Hostname
+		}
+		start = time.Now()
+		if err := s.do(line); err != nil {
+			return timings, fmt.Errorf("%s: %w", cmd, err)
+		}
+		timings = append(timings, Timing{Command: cmd, Duration: time.Since(start)})
+	}
+
+	return timings, nil
+}
+
+// dial connects to Addr and does the TLS handshake, if any, with deadline
+// set on the connection.
+func (p *Prober) dial(ctx context.Context, deadline time.Time) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if p.Dial != nil {
+		conn, err = p.Dial(p.Addr)
+	} else {
+		network := p.Network
+		if network == "" {
+			network = "tcp"
+		}
+		conn, err = (&net.Dialer{Deadline: deadline}).DialContext(ctx, network, p.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !p.TLS {
+		return conn, nil
+	}
+	tlsConn := tls.Client(conn, p.TLSConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+type session struct {
+	r        *bufio.Reader
+	w        net.Conn
+	protocol string
+	tag      int
+}
+
+func (s *session) quitCommand() string {
+	if s.protocol == IMAP {
+		return "LOGOUT"
+	}
+	return "QUIT"
+}
+
+func (s *session) readGreeting() error {
+	if s.protocol == IMAP {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "* OK") && !strings.HasPrefix(line, "* PREAUTH") {
+			return fmt.Errorf("unexpected greeting: %q", strings.TrimSpace(line))
+		}
+		return nil
+	}
+	return s.readSMTPReply()
+}
+
+func (s *session) do(line string) error {
+	if s.protocol == IMAP {
+		s.tag++
+		tag := fmt.Sprintf("a%d", s.tag)
+		if _, err := fmt.Fprintf(s.w, "%s %s\r\n", tag, line); err != nil {
+			return err
+		}
+		return s.readIMAPReply(tag)
+	}
+	if _, err := fmt.Fprintf(s.w, "%s\r\n", line); err != nil {
+		return err
+	}
+	return s.readSMTPReply()
+}
+
+func (s *session) readSMTPReply() error {
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		// a reply line is a three digit code, then "-" if more lines
+		// follow or " " and text, which may be left out on the last line
+		text := strings.TrimRight(line, "\r\n")
+		if len(text) < 3 || len(text) > 3 && text[3] != ' ' && text[3] != '-' {
+			return fmt.Errorf("malformed reply: %q", text)
+		}
+		if len(text) > 3 && text[3] == '-' {
+			continue
+		}
+		if text[0] != '2' && text[0] != '3' {
+			return fmt.Errorf("server replied: %s", text)
+		}
+		return nil
+	}
+}
+
+func (s *session) readIMAPReply(tag string) error {
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, tag+" ") {
+			continue
+		}
+		status := strings.TrimPrefix(line, tag+" ")
+		if !strings.HasPrefix(status, "OK") {
+			return fmt.Errorf("server replied: %s", strings.TrimSpace(status))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,275 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadSMTPReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		err   string
+	}{
+		{name: "single line", reply: "250 OK\r\n"},
+		{name: "multiline", reply: "250-mail.example.com\r\n250-SIZE 1000\r\n250 HELP\r\n"},
+		{name: "intermediate", reply: "354 Start mail input\r\n"},
+		{name: "bare newline", reply: "221 Bye\n"},
+		{name: "code only", reply: "250\r\n"},
+		{name: "rejected", reply: "550 No such user\r\n", err: "server replied: 550 No such user"},
+		{name: "rejected after continuation", reply: "421-Busy\r\n421 Try later\r\n", err: "server replied: 421 Try later"},
+		{name: "short", reply: "25\r\n", err: "malformed reply"},
+		{name: "no separator", reply: "250OK\r\n", err: "malformed reply"},
+		{name: "closed", reply: "", err: "EOF"},
+		{name: "closed in multiline", reply: "250-mail.example.com\r\n", err: "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &session{r: bufio.NewReader(strings.NewReader(tt.reply)), protocol: SMTP}
+			checkErr(t, s.readSMTPReply(), tt.err)
+		})
+	}
+}
+
+func TestReadIMAPReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		err   string
+	}{
+		{name: "tagged", reply: "a1 OK NOOP completed\r\n"},
+		{name: "untagged first", reply: "* 3 EXISTS\r\n* CAPABILITY IMAP4rev1\r\na1 OK done\r\n"},
+		{name: "other tag with the same prefix", reply: "a10 NO wrong\r\na1 OK done\r\n"},
+		{name: "no", reply: "a1 NO denied\r\n", err: "server replied: NO denied"},
+		{name: "bad", reply: "a1 BAD unknown command\r\n", err: "server replied: BAD unknown command"},
+		{name: "closed", reply: "* BYE\r\n", err: "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &session{r: bufio.NewReader(strings.NewReader(tt.reply)), protocol: IMAP}
+			checkErr(t, s.readIMAPReply("a1"), tt.err)
+		})
+	}
+}
+
+func TestReadGreeting(t *testing.T) {
+	tests := []struct {
+		protocol string
+		greeting string
+		err      string
+	}{
+		{protocol: SMTP, greeting: "220 mail.example.com ESMTP\r\n"},
+		{protocol: SMTP, greeting: "220-mail.example.com\r\n220 ready\r\n"},
+		{protocol: SMTP, greeting: "554 go away\r\n", err: "server replied: 554 go away"},
+		{protocol: IMAP, greeting: "* OK IMAP4rev1 ready\r\n"},
+		{protocol: IMAP, greeting: "* PREAUTH logged in\r\n"},
+		{protocol: IMAP, greeting: "* BYE too many connections\r\n", err: `unexpected greeting: "* BYE too many connections"`},
+		{protocol: IMAP, greeting: "", err: "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol+" "+strings.TrimSpace(tt.greeting), func(t *testing.T) {
+			s := &session{r: bufio.NewReader(strings.NewReader(tt.greeting)), protocol: tt.protocol}
+			checkErr(t, s.readGreeting(), tt.err)
+		})
+	}
+}
+
+// fakeServer answers a session on one end of a pipe: it sends greeting,
+// unless it is empty, and then the reply returns for every line it reads.
+// An empty reply closes the connection. Lines are collected in received.
+type fakeServer struct {
+	greeting string
+	reply    func(line string) string
+	received []string
+	done     chan struct{}
+}
+
+func (f *fakeServer) dial(string) (net.Conn, error) {
+	client, server := net.Pipe()
+	f.done = make(chan struct{})
+	go func() {
+		defer close(f.done)
+		defer server.Close()
+		if f.greeting != "" {
+			if _, err := io.WriteString(server, f.greeting); err != nil {
+				return
+			}
+		}
+		r := bufio.NewReader(server)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			f.received = append(f.received, line)
+			reply := f.reply(line)
+			if reply == "" {
+				return
+			}
+			if _, err := io.WriteString(server, reply); err != nil {
+				return
+			}
+		}
+	}()
+	return client, nil
+}
+
+func smtpReplies(line string) string {
+	switch {
+	case strings.HasPrefix(line, "EHLO"):
+		return "250-mail.example.com\r\n250 HELP\r\n"
+	case line == "QUIT":
+		return "221 Bye\r\n"
+	case line == "VRFY":
+		return "502 Command not implemented\r\n"
+	case line == "HANG":
+		return ""
+	}
+	return "250 OK\r\n"
+}
+
+func imapReplies(line string) string {
+	tag, cmd, _ := strings.Cut(line, " ")
+	switch cmd {
+	case "LOGOUT":
+		return "* BYE\r\n" + tag + " OK LOGOUT completed\r\n"
+	case "SELECT":
+		return tag + " NO no mailbox selected\r\n"
+	}
+	return "* 1 EXISTS\r\n" + tag + " OK " + cmd + " completed\r\n"
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		server   *fakeServer
+		commands []string
+		timings  []string
+		received []string
+		err      string
+	}{
+		{
+			name:     "smtp",
+			protocol: SMTP,
+			server:   &fakeServer{greeting: "220 ready\r\n", reply: smtpReplies},
+			commands: []string{"ehlo", " NOOP ", ""},
+			timings:  []string{"CONNECT", "GREETING", "EHLO", "NOOP", "QUIT"},
+			received: []string{"EHLO probe.example.com", "NOOP", "QUIT"},
+		},
+		{
+			name:     "imap",
+			protocol: IMAP,
+			server:   &fakeServer{greeting: "* OK ready\r\n", reply: imapReplies},
+			commands: []string{"NOOP", "CAPABILITY"},
+			timings:  []string{"CONNECT", "GREETING", "NOOP", "CAPABILITY", "LOGOUT"},
+			received: []string{"a1 NOOP", "a2 CAPABILITY", "a3 LOGOUT"},
+		},
+		{
+			name:     "smtp rejected greeting",
+			protocol: SMTP,
+			server:   &fakeServer{greeting: "554 go away\r\n", reply: smtpReplies},
+			timings:  []string{"CONNECT"},
+			err:      "server replied: 554 go away",
+		},
+		{
+			name:     "smtp rejected command",
+			protocol: SMTP,
+			server:   &fakeServer{greeting: "220 ready\r\n", reply: smtpReplies},
+			commands: []string{"EHLO", "VRFY", "NOOP"},
+			timings:  []string{"CONNECT", "GREETING", "EHLO"},
+			received: []string{"EHLO probe.example.com", "VRFY"},
+			err:      "VRFY: server replied: 502 Command not implemented",
+		},
+		{
+			name:     "imap rejected command",
+			protocol: IMAP,
+			server:   &fakeServer{greeting: "* OK ready\r\n", reply: imapReplies},
+			commands: []string{"SELECT"},
+			timings:  []string{"CONNECT", "GREETING"},
+			received: []string{"a1 SELECT"},
+			err:      "SELECT: server replied: NO no mailbox selected",
+		},
+		{
+			name:     "connection closed",
+			protocol: SMTP,
+			server:   &fakeServer{greeting: "220 ready\r\n", reply: smtpReplies},
+			commands: []string{"HANG"},
+			timings:  []string{"CONNECT", "GREETING"},
+			received: []string{"HANG"},
+			err:      "HANG: EOF",
+		},
+		{
+			name:     "no greeting",
+			protocol: SMTP,
+			server:   &fakeServer{reply: smtpReplies},
+			timings:  []string{"CONNECT"},
+			err:      os.ErrDeadlineExceeded.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Prober{
+				Protocol: tt.protocol,
+				Dial:     tt.server.dial,
+				Addr:     "mail.example.com:25",
+				Commands: tt.commands,
+				Hostname: "probe.example.com",
+				Timeout:  200 * time.Millisecond,
+			}
+			timings, err := p.Probe(context.Background())
+			<-tt.server.done
+			checkErr(t, err, tt.err)
+
+			var names []string
+			for _, timing := range timings {
+				names = append(names, timing.Command)
+			}
+			if !reflect.DeepEqual(names, tt.timings) {
+				t.Errorf("timings = %q, want %q", names, tt.timings)
+			}
+			if !reflect.DeepEqual(tt.server.received, tt.received) {
+				t.Errorf("server received %q, want %q", tt.server.received, tt.received)
+			}
+		})
+	}
+}
+
+func TestProbeDialError(t *testing.T) {
+	dialErr := errors.New("connection refused")
+	p := &Prober{
+		Protocol: SMTP,
+		Dial:     func(string) (net.Conn, error) { return nil, dialErr },
+		Addr:     "mail.example.com:25",
+		Timeout:  time.Second,
+	}
+	timings, err := p.Probe(context.Background())
+	if !errors.Is(err, dialErr) {
+		t.Errorf("Probe() error = %v, want %v", err, dialErr)
+	}
+	if len(timings) != 0 {
+		t.Errorf("timings = %v, want none", timings)
+	}
+}
+
+func checkErr(t *testing.T, err error, want string) {
+	t.Helper()
+	if want == "" {
+		if err != nil {
+			t.Errorf("error = %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("error = %v, want it to contain %q", err, want)
+	}
+}
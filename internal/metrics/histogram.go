@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	subBits    = 6
+	subCount   = 1 << subBits
+	numBuckets = (64 - subBits) * subCount
+)
+
+// Histogram records durations in log-linear buckets, keeping the relative
+// error of reported quantiles below ~1.6%. It is safe for concurrent use.
+type Histogram struct {
+	counts [numBuckets]uint64
+	count  uint64
+	sum    uint64
+	min    uint64
+	max    uint64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{min: math.MaxUint64}
+}
+
+func bucketOf(v uint64) int {
+	if v < subCount {
+		return int(v)
+	}
+	exp := bits.Len64(v) - subBits - 1
+	return (exp+1)*subCount + int(v>>exp) - subCount
+}
+
+func bucketValue(idx int) uint64 {
+	if idx < subCount {
+		return uint64(idx)
+	}
+	exp := idx/subCount - 1
+	mant := uint64(idx%subCount + subCount)
+	return mant<<exp + (uint64(1)<<exp)/2
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	v := uint64(d)
+	atomic.AddUint64(&h.counts[bucketOf(v)], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, v)
+	for {
+		cur := atomic.LoadUint64(&h.min)
+		if v >= cur || atomic.CompareAndSwapUint64(&h.min, cur, v) {
+			break
+		}
+	}
+	for {
+		cur := atomic.LoadUint64(&h.max)
+		if v <= cur || atomic.CompareAndSwapUint64(&h.max, cur, v) {
+			break
+		}
+	}
+}
+
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+func (h *Histogram) Mean() time.Duration {
+	count := h.Count()
+	if count == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadUint64(&h.sum) / count)
+}
+
+func (h *Histogram) Min() time.Duration {
+	if h.Count() == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadUint64(&h.min))
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(atomic.LoadUint64(&h.max))
+}
+
+// Quantile returns the value below which the fraction q of recorded values fall.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	count := h.Count()
+	if count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(count)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i := range h.counts {
+		seen += atomic.LoadUint64(&h.counts[i])
+		if seen >= rank {
+			v := bucketValue(i)
+			return time.Duration(min(max(v, uint64(h.Min())), uint64(h.Max())))
+		}
+	}
+	return h.Max()
+}
+
+func (h *Histogram) Merge(o *Histogram) {
+	if o.Count() == 0 {
+		return
+	}
+	for i := range o.counts {
+		if c := atomic.LoadUint64(&o.counts[i]); c > 0 {
+			atomic.AddUint64(&h.counts[i], c)
+		}
+	}
+	atomic.AddUint64(&h.count, atomic.LoadUint64(&o.count))
+	atomic.AddUint64(&h.sum, atomic.LoadUint64(&o.sum))
+	if m := atomic.LoadUint64(&o.min); m < atomic.LoadUint64(&h.min) {
+		atomic.StoreUint64(&h.min, m)
+	}
+	if m := atomic.LoadUint64(&o.max); m > atomic.LoadUint64(&h.max) {
+		atomic.StoreUint64(&h.max, m)
+	}
+}
+
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+	atomic.StoreUint64(&h.count, 0)
+	atomic.StoreUint64(&h.sum, 0)
+	atomic.StoreUint64(&h.min, math.MaxUint64)
+	atomic.StoreUint64(&h.max, 0)
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// Rolling keeps statistics over a sliding window made of one-second slots.
+type Rolling struct {
+	mu       sync.Mutex
+	window   time.Duration
+	slots    []rollingSlot
+	cached   Snapshot
+	cachedAt time.Time
+}
+
+type rollingSlot struct {
+	second int64
+	errors uint64
+	hist   *Histogram
+}
+
+func NewRolling(window time.Duration) *Rolling {
+	n := int(window / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	r := &Rolling{window: time.Duration(n) * time.Second, slots: make([]rollingSlot, n)}
+	for i := range r.slots {
+		r.slots[i].hist = NewHistogram()
+	}
+	return r
+}
+
+func (r *Rolling) Record(at time.Time, d time.Duration, failed bool) {
+	second := at.Unix()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	slot := &r.slots[int(second%int64(len(r.slots)))]
+	if slot.second != second {
+		slot.second = second
+		slot.errors = 0
+		slot.hist.Reset()
+	}
+	slot.hist.Record(d)
+	if failed {
+		slot.errors++
+	}
+}
+
+// Snapshot returns the statistics of the current window. Results are cached
+// for a short time since computing quantiles walks every slot.
+func (r *Rolling) Snapshot() Snapshot {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.cachedAt) < 250*time.Millisecond {
+		return r.cached
+	}
+
+	merged := NewHistogram()
+	var errors uint64
+	oldest := now.Unix() - int64(len(r.slots)) + 1
+	for i := range r.slots {
+		slot := &r.slots[i]
+		if slot.second < oldest {
+			continue
+		}
+		merged.Merge(slot.hist)
+		errors += slot.errors
+	}
+
+	snap := newSnapshot(merged, errors, r.window)
+
+	r.cached = snap
+	r.cachedAt = now
+	return snap
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type Snapshot struct {
+	Requests  uint64
+	Errors    uint64
+	ErrorRate float64
+	RPS       float64
+	Mean      time.Duration
+	P50       time.Duration
+	P90       time.Duration
+	P95       time.Duration
+	P99       time.Duration
+	Max       time.Duration
+}
+
+func newSnapshot(h *Histogram, errors uint64, elapsed time.Duration) Snapshot {
+	snap := Snapshot{
+		Requests: h.Count(),
+		Errors:   errors,
+		Mean:     h.Mean(),
+		P50:      h.Quantile(0.50),
+		P90:      h.Quantile(0.90),
+		P95:      h.Quantile(0.95),
+		P99:      h.Quantile(0.99),
+		Max:      h.Max(),
+	}
+	if elapsed > 0 {
+		snap.RPS = float64(snap.Requests) / elapsed.Seconds()
+	}
+	if snap.Requests > 0 {
+		snap.ErrorRate = float64(errors) / float64(snap.Requests)
+	}
+	return snap
+}
+
+// Vars exposes the snapshot to condition expressions; latencies are in
+// milliseconds.
+func (s Snapshot) Vars() map[string]float64 {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return map[string]float64{
+		"requests":   float64(s.Requests),
+		"errors":     float64(s.Errors),
+		"error_rate": s.ErrorRate,
+		"rps":        s.RPS,
+		"avg":        ms(s.Mean),
+		"p50":        ms(s.P50),
+		"p90":        ms(s.P90),
+		"p95":        ms(s.P95),
+		"p99":        ms(s.P99),
+		"max":        ms(s.Max),
+	}
+}
+
+// Recorder accumulates latency and errors over an open-ended period.
+type Recorder struct {
+	hist   *Histogram
+	errors uint64
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{hist: NewHistogram()}
+}
+
+func (r *Recorder) Record(d time.Duration, failed bool) {
+	r.hist.Record(d)
+	if failed {
+		atomic.AddUint64(&r.errors, 1)
+	}
+}
+
+func (r *Recorder) Histogram() *Histogram {
+	return r.hist
+}
+
+func (r *Recorder) Snapshot(elapsed time.Duration) Snapshot {
+	return newSnapshot(r.hist, atomic.LoadUint64(&r.errors), elapsed)
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"dos/internal/util"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// Cache keeps the results of validating proxies in a file, so that a later
+// validation of the same list only checks the proxies whose result is older
+// than the TTL.
+type Cache struct {
+	path    string
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is the result of a proxy in the file. Probe is the probe URL it
+// was checked with, as a result without probe doesn't stand in for one with.
+type cacheEntry struct {
+	Checked   time.Time `json:"checked"`
+	Probe     string    `json:"probe,omitempty"`
+	LatencyMs float64   `json:"latency_ms,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// LoadCache reads the cache at path. A missing file is an empty cache.
+func LoadCache(path string, ttl time.Duration) (*Cache, error) {
+	c := &Cache{path: path, ttl: ttl, entries: map[string]cacheEntry{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns the results of the proxies like the package Validate,
+// checking only those without a fresh entry in the cache, and the number of
+// results taken from the cache. The cache is updated but not saved.
+func (c *Cache) Validate(proxies []string, opts Options) (checks []Check, cached int) {
+	checks = make([]Check, len(proxies))
+	var stale []string
+	var staleAt []int
+	now := time.Now()
+	for i, p := range proxies {
+		e, ok := c.entries[p]
+		if !ok || e.Probe != opts.ProbeURL || now.Sub(e.Checked) > c.ttl {
+			stale = append(stale, p)
+			staleAt = append(staleAt, i)
+			continue
+		}
+		checks[i] = Check{Proxy: p, Latency: time.Duration(e.LatencyMs * float64(time.Millisecond))}
+		if e.Error != "" {
+			checks[i].Err = errors.New(e.Error)
+		}
+		cached++
+	}
+
+	for j, check := range Validate(stale, opts) {
+		checks[staleAt[j]] = check
+		e := cacheEntry{Checked: now, Probe: opts.ProbeURL}
+		if check.Valid() {
+			e.LatencyMs = float64(check.Latency) / float64(time.Millisecond)
+		} else {
+			e.Error = check.Err.Error()
+		}
+		c.entries[check.Proxy] = e
+	}
+	return checks, cached
+}
+
+// Save writes the cache back to its file, dropping the expired entries.
+func (c *Cache) Save() error {
+	now := time.Now()
+	for p, e := range c.entries {
+		if now.Sub(e.Checked) > c.ttl {
+			delete(c.entries, p)
+		}
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(c.path, data)
+}
@@ -1,9 +1,9 @@
 package proxy
 
 import (
-	"crypto/tls"
 	"fmt"
 	"net"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -12,6 +12,7 @@ import (
 )
 
 type ProxyRotator struct {
+	mu      sync.RWMutex
 	proxies []string
 	current uint32
 }
@@ -21,6 +22,8 @@ func NewProxyRotator(proxies []string) *ProxyRotator {
 }
 
 func (p *ProxyRotator) Next() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	if len(p.proxies) == 0 {
 		return ""
 	}
@@ -28,20 +31,69 @@ func (p *ProxyRotator) Next() string {
 	return p.proxies[(int(n)-1)%len(p.proxies)]
 }
 
+func (p *ProxyRotator) Add(proxies ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.proxies = append(p.proxies, proxies...)
+}
+
+func (p *ProxyRotator) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.proxies)
+}
+
 func (p *ProxyRotator) GetClient() *fasthttp.Client {
+	return p.client(p.Next)
+}
+
+// ClientFor returns a client that always connects through the i-th proxy,
+// counting from 0 and wrapping around the list.
+func (p *ProxyRotator) ClientFor(i int) *fasthttp.Client {
+	return p.client(func() string { return p.At(i) })
+}
+
+// At returns the i-th proxy, counting from 0 and wrapping around the list,
+// or "" if there are none.
+func (p *ProxyRotator) At(i int) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if len(p.proxies) == 0 {
+		return ""
+	}
+	return p.proxies[i%len(p.proxies)]
+}
+
+func (p *ProxyRotator) client(next func() string) *fasthttp.Client {
 	return &fasthttp.Client{
 		ReadTimeout:     5 * time.Second,
 		WriteTimeout:    5 * time.Second,
 		MaxConnDuration: 30 * time.Second,
-		TLSConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
 		Dial: func(addr string) (net.Conn, error) {
-			proxy := p.Next()
+			proxy := next()
 			if proxy == "" {
-				return nil, fmt.Errorf("proxy address is empty")
+				return nil, &DialError{Err: fmt.Errorf("proxy address is empty")}
 			}
-			return fasthttpproxy.FasthttpSocksDialer("socks5://" + proxy)(addr)
+			conn, err := fasthttpproxy.FasthttpSocksDialer("socks5://" + proxy)(addr)
+			if err != nil {
+				return nil, &DialError{Proxy: proxy, Err: err}
+			}
+			return conn, nil
 		},
 	}
 }
+
+// DialError is returned for connections that failed at or through a proxy,
+// so they can be told apart from failures of the target itself.
+type DialError struct {
+	Proxy string
+	Err   error
+}
+
+func (e *DialError) Error() string {
+	return fmt.Sprintf("proxy %s: %v", e.Proxy, e.Err)
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
@@ -1,49 +1,132 @@
 package proxy
 
 import (
+	"fmt"
 	"net"
 	"sync"
 	"time"
+
+	"github.com/valyala/fasthttp"
+	xproxy "golang.org/x/net/proxy"
 )
 
-func ValidateProxies(proxies []string) (validProxiesSl, invalidProxiesSl []string) {
-	validProxies := make(chan string, len(proxies))
-	invalidProxies := make(chan string, len(proxies))
-	timeout := 5 * time.Second
+// Options configure Validate.
+type Options struct {
+	// Timeout bounds every check of a proxy.
+	Timeout time.Duration
+	// Concurrency is the number of proxies checked at once, all of them if
+	// 0.
+	Concurrency int
+	// ProbeURL, if set, is requested through every proxy after it accepted
+	// a connection. Any response passes, since it only shows that the proxy
+	// relays traffic.
+	ProbeURL string
+}
 
-	wg := &sync.WaitGroup{}
-	wg.Add(len(proxies))
+// Check is the result of validating one proxy. Latency is the time the
+// last check that was run took: the probe request if there is one,
+// otherwise the TCP connect.
+type Check struct {
+	Proxy   string
+	Err     error
+	Latency time.Duration
+}
+
+func (c Check) Valid() bool {
+	return c.Err == nil
+}
 
-	for _, proxy := range proxies {
-		go func(proxy string, timeout time.Duration) {
+// Validate checks every proxy and returns the results in the order of the
+// list.
+func Validate(proxies []string, opts Options) []Check {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 || concurrency > len(proxies) {
+		concurrency = len(proxies)
+	}
+	checks := make([]Check, len(proxies))
+	next := make(chan int)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(concurrency)
+	for range concurrency {
+		go func() {
 			defer wg.Done()
-			if testProxy(proxy, timeout) {
-				validProxies <- proxy
-			} else {
-				invalidProxies <- proxy
+			for i := range next {
+				checks[i] = check(proxies[i], opts)
 			}
-		}(proxy, timeout)
+		}()
 	}
-
+	for i := range proxies {
+		next <- i
+	}
+	close(next)
 	wg.Wait()
-	close(validProxies)
-	close(invalidProxies)
+	return checks
+}
 
-	for proxy := range validProxies {
-		validProxiesSl = append(validProxiesSl, proxy)
-	}
-	for proxy := range invalidProxies {
-		invalidProxiesSl = append(invalidProxiesSl, proxy)
-	}
+func ValidateProxies(proxies []string) (validProxiesSl, invalidProxiesSl []string) {
+	return Split(Validate(proxies, Options{Timeout: 5 * time.Second}))
+}
 
+// Split returns the proxies of the checks that passed and those that
+// failed, in the order of the checks.
+func Split(checks []Check) (validProxiesSl, invalidProxiesSl []string) {
+	for _, c := range checks {
+		if c.Valid() {
+			validProxiesSl = append(validProxiesSl, c.Proxy)
+		} else {
+			invalidProxiesSl = append(invalidProxiesSl, c.Proxy)
+		}
+	}
 	return validProxiesSl, invalidProxiesSl
 }
 
-func testProxy(proxy string, timeout time.Duration) bool {
-	conn, err := net.DialTimeout("tcp", proxy, timeout)
+func check(proxy string, opts Options) Check {
+	c := Check{Proxy: proxy}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", proxy, opts.Timeout)
 	if err != nil {
-		return false
+		c.Err = err
+		return c
 	}
 	conn.Close()
-	return true
+	c.Latency = time.Since(start)
+	if opts.ProbeURL == "" {
+		return c
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(opts.ProbeURL)
+	// the deadline also bounds the SOCKS handshake, which the dialers of
+	// the load don't limit
+	deadline := time.Now().Add(opts.Timeout)
+	socks, err := xproxy.SOCKS5("tcp", proxy, nil, deadlineDialer(deadline))
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	client := &fasthttp.Client{Dial: func(addr string) (net.Conn, error) { return socks.Dial("tcp", addr) }}
+	start = time.Now()
+	if err := client.DoDeadline(req, resp, deadline); err != nil {
+		c.Err = fmt.Errorf("probe: %w", err)
+		return c
+	}
+	c.Latency = time.Since(start)
+	return c
+}
+
+// deadlineDialer connects with a deadline that stays set on the connection.
+type deadlineDialer time.Time
+
+func (d deadlineDialer) Dial(network, addr string) (net.Conn, error) {
+	deadline := time.Time(d)
+	conn, err := net.DialTimeout(network, addr, time.Until(deadline))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(deadline)
+	return conn, nil
 }
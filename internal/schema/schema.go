@@ -0,0 +1,487 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema validates JSON documents against the subset of JSON Schema (drafts
+// 7 to 2020-12) that API response contracts usually use: types, properties,
+// required, additionalProperties, items, enum, const, numeric, string and
+// array bounds, pattern, allOf, anyOf, oneOf, not and local $ref. Annotations
+// such as title or format are ignored, while other validation keywords are
+// rejected, so that a schema is never silently checked only in part.
+type Schema struct {
+	root *node
+}
+
+// Error is a violation at a JSON pointer into the document.
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return "at " + e.Path + ": " + e.Message
+}
+
+type node struct {
+	// always is set for the true and false schemas.
+	always *bool
+	// ref is the target of $ref, filled in once it is compiled.
+	ref *node
+
+	types         []string
+	enum          []any
+	constant      any
+	hasConst      bool
+	minimum       *float64
+	maximum       *float64
+	exclusiveMin  *float64
+	exclusiveMax  *float64
+	multipleOf    *float64
+	minLength     *int
+	maxLength     *int
+	pattern       *regexp.Regexp
+	minItems      *int
+	maxItems      *int
+	uniqueItems   bool
+	items         *node
+	properties    map[string]*node
+	required      []string
+	additional    *node
+	minProperties *int
+	maxProperties *int
+	allOf         []*node
+	anyOf         []*node
+	oneOf         []*node
+	not           *node
+}
+
+var ignoredKeywords = []string{
+	"$schema", "$id", "$comment", "$defs", "definitions", "title", "description",
+	"default", "examples", "format", "readOnly", "writeOnly", "deprecated",
+	"contentMediaType", "contentEncoding",
+}
+
+// Load reads a schema from a JSON file.
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func Parse(data []byte) (*Schema, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	c := &compiler{root: raw, refs: map[string]*node{}}
+	root, err := c.compile(raw, "#")
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{root: root}, nil
+}
+
+type compiler struct {
+	root any
+	// refs are the targets of $ref by pointer, compiled once so that
+	// recursive schemas terminate.
+	refs map[string]*node
+}
+
+func (c *compiler) compile(raw any, at string) (*node, error) {
+	if b, ok := raw.(bool); ok {
+		return &node{always: &b}, nil
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or a boolean", at)
+	}
+
+	n := &node{}
+	var err error
+	for key, value := range m {
+		where := at + "/" + key
+		switch key {
+		case "$ref":
+			ref, ok := value.(string)
+			if !ok || !strings.HasPrefix(ref, "#") {
+				return nil, fmt.Errorf("%s: only local references like #/$defs/name are supported", where)
+			}
+			if n.ref, err = c.resolve(ref); err != nil {
+				return nil, fmt.Errorf("%s: %w", where, err)
+			}
+		case "type":
+			switch t := value.(type) {
+			case string:
+				n.types = []string{t}
+			case []any:
+				for _, v := range t {
+					s, ok := v.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s: types must be strings", where)
+					}
+					n.types = append(n.types, s)
+				}
+			default:
+				return nil, fmt.Errorf("%s: must be a string or an array", where)
+			}
+			for _, t := range n.types {
+				if !slices.Contains([]string{"null", "boolean", "object", "array", "number", "integer", "string"}, t) {
+					return nil, fmt.Errorf("%s: unknown type %q", where, t)
+				}
+			}
+		case "enum":
+			if n.enum, ok = value.([]any); !ok {
+				return nil, fmt.Errorf("%s: must be an array", where)
+			}
+		case "const":
+			n.constant, n.hasConst = value, true
+		case "minimum":
+			n.minimum, err = number(value, where)
+		case "maximum":
+			n.maximum, err = number(value, where)
+		case "exclusiveMinimum":
+			n.exclusiveMin, err = number(value, where)
+		case "exclusiveMaximum":
+			n.exclusiveMax, err = number(value, where)
+		case "multipleOf":
+			n.multipleOf, err = number(value, where)
+		case "minLength":
+			n.minLength, err = count(value, where)
+		case "maxLength":
+			n.maxLength, err = count(value, where)
+		case "minItems":
+			n.minItems, err = count(value, where)
+		case "maxItems":
+			n.maxItems, err = count(value, where)
+		case "minProperties":
+			n.minProperties, err = count(value, where)
+		case "maxProperties":
+			n.maxProperties, err = count(value, where)
+		case "pattern":
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be a string", where)
+			}
+			if n.pattern, err = regexp.Compile(s); err != nil {
+				return nil, fmt.Errorf("%s: %w", where, err)
+			}
+		case "uniqueItems":
+			n.uniqueItems, _ = value.(bool)
+		case "items":
+			if _, ok := value.([]any); ok {
+				return nil, fmt.Errorf("%s: tuple items are not supported", where)
+			}
+			n.items, err = c.compile(value, where)
+		case "properties":
+			props, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be an object", where)
+			}
+			n.properties = map[string]*node{}
+			for name, sub := range props {
+				if n.properties[name], err = c.compile(sub, where+"/"+name); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			list, ok := value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be an array", where)
+			}
+			for _, v := range list {
+				s, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: names must be strings", where)
+				}
+				n.required = append(n.required, s)
+			}
+		case "additionalProperties":
+			n.additional, err = c.compile(value, where)
+		case "allOf", "anyOf", "oneOf":
+			list, ok := value.([]any)
+			if !ok || len(list) == 0 {
+				return nil, fmt.Errorf("%s: must be a non-empty array", where)
+			}
+			var subs []*node
+			for i, v := range list {
+				sub, err := c.compile(v, where+"/"+strconv.Itoa(i))
+				if err != nil {
+					return nil, err
+				}
+				subs = append(subs, sub)
+			}
+			switch key {
+			case "allOf":
+				n.allOf = subs
+			case "anyOf":
+				n.anyOf = subs
+			default:
+				n.oneOf = subs
+			}
+		case "not":
+			n.not, err = c.compile(value, where)
+		default:
+			if !slices.Contains(ignoredKeywords, key) {
+				return nil, fmt.Errorf("%s: unsupported keyword", where)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// resolve compiles the target of a local reference, once.
+func (c *compiler) resolve(ref string) (*node, error) {
+	if target, ok := c.refs[ref]; ok {
+		return target, nil
+	}
+	target := &node{}
+	c.refs[ref] = target
+	raw := c.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch v := raw.(type) {
+		case map[string]any:
+			raw = v[token]
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("%q not found", ref)
+			}
+			raw = v[i]
+		default:
+			raw = nil
+		}
+		if raw == nil {
+			return nil, fmt.Errorf("%q not found", ref)
+		}
+	}
+	compiled, err := c.compile(raw, ref)
+	if err != nil {
+		return nil, err
+	}
+	// references to target compiled in the meantime keep the pointer
+	*target = *compiled
+	return target, nil
+}
+
+func number(v any, where string) (*float64, error) {
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a number", where)
+	}
+	return &f, nil
+}
+
+func count(v any, where string) (*int, error) {
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("%s: must be a non-negative integer", where)
+	}
+	i := int(f)
+	return &i, nil
+}
+
+// ValidateJSON parses data and validates it.
+func (s *Schema) ValidateJSON(data []byte) error {
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&doc); err != nil {
+		return &Error{Message: "body is not JSON: " + err.Error()}
+	}
+	if dec.More() {
+		return &Error{Message: "body is not JSON: data after the document"}
+	}
+	return s.Validate(doc)
+}
+
+// Validate returns the first violation of a document decoded with
+// encoding/json, as an *Error.
+func (s *Schema) Validate(doc any) error {
+	return s.root.validate(doc, "")
+}
+
+func (n *node) validate(v any, path string) error {
+	fail := func(format string, args ...any) error {
+		return &Error{Path: path, Message: fmt.Sprintf(format, args...)}
+	}
+	if n.always != nil {
+		if !*n.always {
+			return fail("no value is allowed")
+		}
+		return nil
+	}
+	if n.ref != nil {
+		if err := n.ref.validate(v, path); err != nil {
+			return err
+		}
+	}
+
+	if len(n.types) > 0 && !slices.ContainsFunc(n.types, func(t string) bool { return hasType(v, t) }) {
+		return fail("expected %s, got %s", strings.Join(n.types, " or "), typeOf(v))
+	}
+	if n.enum != nil && !slices.ContainsFunc(n.enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+		return fail("value is not one of the enum values")
+	}
+	if n.hasConst && !reflect.DeepEqual(n.constant, v) {
+		return fail("value is not the const value")
+	}
+
+	switch v := v.(type) {
+	case float64:
+		switch {
+		case n.minimum != nil && v < *n.minimum:
+			return fail("%v is less than the minimum %v", v, *n.minimum)
+		case n.maximum != nil && v > *n.maximum:
+			return fail("%v is greater than the maximum %v", v, *n.maximum)
+		case n.exclusiveMin != nil && v <= *n.exclusiveMin:
+			return fail("%v is not greater than %v", v, *n.exclusiveMin)
+		case n.exclusiveMax != nil && v >= *n.exclusiveMax:
+			return fail("%v is not less than %v", v, *n.exclusiveMax)
+		case n.multipleOf != nil && *n.multipleOf != 0 && math.Abs(math.Remainder(v, *n.multipleOf)) > 1e-9:
+			return fail("%v is not a multiple of %v", v, *n.multipleOf)
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		switch {
+		case n.minLength != nil && length < *n.minLength:
+			return fail("string is shorter than %d", *n.minLength)
+		case n.maxLength != nil && length > *n.maxLength:
+			return fail("string is longer than %d", *n.maxLength)
+		case n.pattern != nil && !n.pattern.MatchString(v):
+			return fail("string doesn't match %q", n.pattern)
+		}
+	case []any:
+		switch {
+		case n.minItems != nil && len(v) < *n.minItems:
+			return fail("array has fewer than %d items", *n.minItems)
+		case n.maxItems != nil && len(v) > *n.maxItems:
+			return fail("array has more than %d items", *n.maxItems)
+		}
+		if n.uniqueItems {
+			for i := range v {
+				for j := range i {
+					if reflect.DeepEqual(v[i], v[j]) {
+						return fail("items %d and %d are equal", j, i)
+					}
+				}
+			}
+		}
+		if n.items != nil {
+			for i, item := range v {
+				if err := n.items.validate(item, path+"/"+strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]any:
+		switch {
+		case n.minProperties != nil && len(v) < *n.minProperties:
+			return fail("object has fewer than %d properties", *n.minProperties)
+		case n.maxProperties != nil && len(v) > *n.maxProperties:
+			return fail("object has more than %d properties", *n.maxProperties)
+		}
+		for _, name := range n.required {
+			if _, ok := v[name]; !ok {
+				return fail("missing required property %q", name)
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(v)) {
+			sub, ok := n.properties[name]
+			if !ok {
+				sub = n.additional
+			}
+			if sub == nil {
+				continue
+			}
+			if sub.always != nil && !*sub.always && !ok {
+				return fail("property %q is not allowed", name)
+			}
+			if err := sub.validate(v[name], path+"/"+escape(name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, sub := range n.allOf {
+		if err := sub.validate(v, path); err != nil {
+			return err
+		}
+	}
+	if n.anyOf != nil && !slices.ContainsFunc(n.anyOf, func(sub *node) bool { return sub.validate(v, path) == nil }) {
+		return fail("value matches none of anyOf")
+	}
+	if n.oneOf != nil {
+		matches := 0
+		for _, sub := range n.oneOf {
+			if sub.validate(v, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fail("value matches %d of oneOf instead of one", matches)
+		}
+	}
+	if n.not != nil && n.not.validate(v, path) == nil {
+		return fail("value matches not")
+	}
+	return nil
+}
+
+func hasType(v any, t string) bool {
+	switch t {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	}
+	return typeOf(v) == t
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	return "object"
+}
+
+// escape escapes a property name for a JSON pointer.
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
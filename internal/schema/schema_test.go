@@ -0,0 +1,120 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		schema string
+		err    string
+	}{
+		{schema: `true`},
+		{schema: `{"title": "User", "format": "uuid", "$defs": {}}`},
+		{schema: `1`, err: "must be an object or a boolean"},
+		{schema: `{"type": "decimal"}`, err: `unknown type "decimal"`},
+		{schema: `{"type": 1}`, err: "must be a string or an array"},
+		{schema: `{"minLength": -1}`, err: "must be a non-negative integer"},
+		{schema: `{"minimum": "1"}`, err: "must be a number"},
+		{schema: `{"pattern": "("}`, err: "#/pattern"},
+		{schema: `{"items": [{}]}`, err: "tuple items are not supported"},
+		{schema: `{"anyOf": []}`, err: "must be a non-empty array"},
+		{schema: `{"if": {}}`, err: "#/if: unsupported keyword"},
+		{schema: `{"properties": {"a": {"dependentRequired": {}}}}`, err: "#/properties/a/dependentRequired: unsupported keyword"},
+		{schema: `{"$ref": "other.json"}`, err: "only local references"},
+		{schema: `{"$ref": "#/$defs/missing"}`, err: `"#/$defs/missing" not found`},
+		{schema: `{"type": "object"`, err: "unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			_, err := Parse([]byte(tt.schema))
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("Parse() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	const user = `{
+		"type": "object",
+		"required": ["id", "name"],
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"name": {"type": "string", "minLength": 1, "maxLength": 5, "pattern": "^[a-z]+$"},
+			"role": {"enum": ["admin", "user"]},
+			"score": {"type": "number", "exclusiveMaximum": 100, "multipleOf": 0.5},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2, "uniqueItems": true},
+			"manager": {"$ref": "#"}
+		},
+		"additionalProperties": false
+	}`
+	tests := []struct {
+		name   string
+		schema string
+		doc    string
+		path   string
+		err    string
+	}{
+		{name: "valid", schema: user, doc: `{"id": 1, "name": "ann", "role": "admin", "score": 99.5, "tags": ["a", "b"]}`},
+		{name: "not JSON", schema: user, doc: `{"id": `, err: "body is not JSON"},
+		{name: "trailing data", schema: user, doc: `{"id": 1, "name": "a"} {}`, err: "data after the document"},
+		{name: "wrong type", schema: user, doc: `[]`, err: "expected object, got array"},
+		{name: "missing required", schema: user, doc: `{"id": 1}`, err: `missing required property "name"`},
+		{name: "additional property", schema: user, doc: `{"id": 1, "name": "a", "extra": 1}`, err: `property "extra" is not allowed`},
+		{name: "integer", schema: user, doc: `{"id": 1.5, "name": "a"}`, path: "/id", err: "expected integer, got number"},
+		{name: "minimum", schema: user, doc: `{"id": 0, "name": "a"}`, path: "/id", err: "less than the minimum"},
+		{name: "minLength", schema: user, doc: `{"id": 1, "name": ""}`, path: "/name", err: "shorter than 1"},
+		{name: "maxLength counts runes", schema: user, doc: `{"id": 1, "name": "ééééé"}`, path: "/name", err: "doesn't match"},
+		{name: "maxLength", schema: user, doc: `{"id": 1, "name": "abcdef"}`, path: "/name", err: "longer than 5"},
+		{name: "enum", schema: user, doc: `{"id": 1, "name": "a", "role": "root"}`, path: "/role", err: "not one of the enum values"},
+		{name: "exclusiveMaximum", schema: user, doc: `{"id": 1, "name": "a", "score": 100}`, path: "/score", err: "not less than 100"},
+		{name: "multipleOf", schema: user, doc: `{"id": 1, "name": "a", "score": 0.3}`, path: "/score", err: "not a multiple of 0.5"},
+		{name: "item type", schema: user, doc: `{"id": 1, "name": "a", "tags": ["a", 1]}`, path: "/tags/1", err: "expected string"},
+		{name: "maxItems", schema: user, doc: `{"id": 1, "name": "a", "tags": ["a", "b", "c"]}`, path: "/tags", err: "more than 2 items"},
+		{name: "uniqueItems", schema: user, doc: `{"id": 1, "name": "a", "tags": ["a", "a"]}`, path: "/tags", err: "items 0 and 1 are equal"},
+		{name: "recursive ref", schema: user, doc: `{"id": 1, "name": "a", "manager": {"id": 2}}`, path: "/manager", err: `missing required property "name"`},
+		{name: "nullable", schema: `{"type": ["string", "null"]}`, doc: `null`},
+		{name: "const", schema: `{"const": {"a": [1]}}`, doc: `{"a": [2]}`, err: "not the const value"},
+		{name: "false schema", schema: `false`, doc: `1`, err: "no value is allowed"},
+		{name: "escaped pointer", schema: `{"additionalProperties": {"type": "number"}}`, doc: `{"a/b~c": "x"}`, path: "/a~1b~0c", err: "expected number"},
+		{name: "minProperties", schema: `{"minProperties": 1}`, doc: `{}`, err: "fewer than 1 properties"},
+		{name: "allOf", schema: `{"allOf": [{"type": "number"}, {"maximum": 5}]}`, doc: `6`, err: "greater than the maximum 5"},
+		{name: "anyOf", schema: `{"anyOf": [{"type": "string"}, {"type": "boolean"}]}`, doc: `1`, err: "matches none of anyOf"},
+		{name: "oneOf none", schema: `{"oneOf": [{"type": "string"}, {"type": "boolean"}]}`, doc: `1`, err: "matches 0 of oneOf"},
+		{name: "oneOf both", schema: `{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, doc: `1`, err: "matches 2 of oneOf"},
+		{name: "oneOf one", schema: `{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, doc: `1.5`},
+		{name: "not", schema: `{"not": {"type": "null"}}`, doc: `null`, err: "matches not"},
+		{name: "defs ref", schema: `{"$defs": {"id": {"type": "integer"}}, "items": {"$ref": "#/$defs/id"}}`, doc: `[1, "2"]`, path: "/1", err: "expected integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			err = s.ValidateJSON([]byte(tt.doc))
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("ValidateJSON() error = %v", err)
+				}
+				return
+			}
+			var schemaErr *Error
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("ValidateJSON() error = %v, want an *Error", err)
+			}
+			if schemaErr.Path != tt.path || !strings.Contains(schemaErr.Message, tt.err) {
+				t.Errorf("ValidateJSON() error at %q: %q, want at %q: %q", schemaErr.Path, schemaErr.Message, tt.path, tt.err)
+			}
+		})
+	}
+}
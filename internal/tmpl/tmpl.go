@@ -0,0 +1,87 @@
+package tmpl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Template is a string with {{name}} placeholders that are expanded for
+// every request. Whitespace inside the braces is ignored.
+type Template struct {
+	source string
+	parts  []part
+}
+
+type part struct {
+	literal string
+	name    string
+}
+
+func Parse(s string) (*Template, error) {
+	t := &Template{source: s}
+	rest := s
+	for {
+		open := strings.Index(rest, "{{")
+		if open < 0 {
+			break
+		}
+		end := strings.Index(rest[open:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("%q: unclosed {{", s)
+		}
+		name := strings.TrimSpace(rest[open+2 : open+end])
+		if name == "" {
+			return nil, fmt.Errorf("%q: empty placeholder", s)
+		}
+		if open > 0 {
+			t.parts = append(t.parts, part{literal: rest[:open]})
+		}
+		t.parts = append(t.parts, part{name: name})
+		rest = rest[open+end+2:]
+	}
+	if rest != "" {
+		t.parts = append(t.parts, part{literal: rest})
+	}
+	return t, nil
+}
+
+func (t *Template) String() string {
+	return t.source
+}
+
+// Static reports whether the template has no placeholders.
+func (t *Template) Static() bool {
+	for _, p := range t.parts {
+		if p.name != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Names returns every placeholder name in the template.
+func (t *Template) Names() []string {
+	var names []string
+	for _, p := range t.parts {
+		if p.name != "" {
+			names = append(names, p.name)
+		}
+	}
+	return names
+}
+
+// Expand replaces every placeholder with the value returned by lookup.
+func (t *Template) Expand(lookup func(name string) string) string {
+	if t.Static() {
+		return t.source
+	}
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.name != "" {
+			b.WriteString(lookup(p.name))
+		} else {
+			b.WriteString(p.literal)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package tmpl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	vars := map[string]string{"id": "42", "user.name": "ann"}
+	lookup := func(name string) string { return vars[name] }
+
+	tests := []struct {
+		in     string
+		names  []string
+		static bool
+		want   string
+		err    string
+	}{
+		{in: "", static: true, want: ""},
+		{in: "/users", static: true, want: "/users"},
+		{in: "/users/{{id}}", names: []string{"id"}, want: "/users/42"},
+		{in: "{{id}}", names: []string{"id"}, want: "42"},
+		{in: "{{ id }}-{{user.name}}", names: []string{"id", "user.name"}, want: "42-ann"},
+		{in: "{{id}}{{id}}", names: []string{"id", "id"}, want: "4242"},
+		{in: "{{missing}}!", names: []string{"missing"}, want: "!"},
+		{in: "a } b }} c", static: true, want: "a } b }} c"},
+		{in: "/users/{{id", err: "unclosed {{"},
+		{in: "/users/{{ }}", err: "empty placeholder"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			tmpl, err := Parse(tt.in)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Parse(%q) error = %v, want it to contain %q", tt.in, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.in, err)
+			}
+			if got := tmpl.String(); got != tt.in {
+				t.Errorf("String() = %q, want %q", got, tt.in)
+			}
+			if got := tmpl.Static(); got != tt.static {
+				t.Errorf("Static() = %v, want %v", got, tt.static)
+			}
+			if got := tmpl.Names(); !reflect.DeepEqual(got, tt.names) {
+				t.Errorf("Names() = %q, want %q", got, tt.names)
+			}
+			if got := tmpl.Expand(lookup); got != tt.want {
+				t.Errorf("Expand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"strings"
 )
 
+// ReadFileEntries returns the lines of a file, trimmed, skipping empty lines
+// and comment lines starting with #.
 func ReadFileEntries(filePath string) (entries []string, e error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -17,7 +19,7 @@ func ReadFileEntries(filePath string) (entries []string, e error) {
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
+		if line != "" && !strings.HasPrefix(line, "#") {
 			entries = append(entries, line)
 		}
 	}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"dos/internal/metrics"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// intervalWriter writes the statistics of every -interval as one JSON line
+// to -interval_out, so tools can follow a run without parsing the logs.
+type intervalWriter struct {
+	stats       *runStats
+	every       time.Duration
+	measureFrom time.Time
+	ctx         context.Context
+	out         io.WriteCloser
+	enc         *json.Encoder
+	done        chan struct{}
+	stopped     chan struct{}
+
+	mu       sync.Mutex
+	current  *metrics.Recorder
+	bytes    int64
+	lastFrom time.Time
+}
+
+// intervalLine is one interval. Requests and errors are those completed in
+// the interval, with 5xx responses counted as errors; latencies are in
+// milliseconds.
+type intervalLine struct {
+	Type            string  `json:"type"`
+	Time            int64   `json:"time"`
+	Phase           string  `json:"phase"`
+	ElapsedSeconds  float64 `json:"elapsed_seconds"`
+	IntervalSeconds float64 `json:"interval_seconds"`
+	Requests        uint64  `json:"requests"`
+	Errors          uint64  `json:"errors"`
+	ErrorRate       float64 `json:"error_rate"`
+	RPS             float64 `json:"rps"`
+	Avg             float64 `json:"avg"`
+	P50             float64 `json:"p50"`
+	P90             float64 `json:"p90"`
+	P99             float64 `json:"p99"`
+	Max             float64 `json:"max"`
+	BytesReceived   int64   `json:"bytes_received"`
+	InFlight        int64   `json:"in_flight"`
+}
+
+func newIntervalWriter(ctx context.Context, path string, every time.Duration, stats *runStats, measureFrom time.Time) (*intervalWriter, error) {
+	var out io.WriteCloser = os.Stderr
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		out = file
+	}
+	return &intervalWriter{
+		stats:       stats,
+		every:       every,
+		measureFrom: measureFrom,
+		ctx:         ctx,
+		out:         out,
+		enc:         json.NewEncoder(out),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		current:     metrics.NewRecorder(),
+		lastFrom:    measureFrom,
+	}, nil
+}
+
+func (w *intervalWriter) record(res *Result) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.current.Record(res.duration, isFailure(res))
+	w.bytes += res.bytes
+}
+
+func (w *intervalWriter) run() {
+	defer close(w.stopped)
+	defer crashes.handlePanic("interval_out", nil)
+	// warm-up isn't reported, like in the statistics
+	select {
+	case <-time.After(time.Until(w.measureFrom)):
+	case <-w.done:
+		return
+	}
+	ticker := time.NewTicker(w.every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.write(runPhase(w.ctx, w.measureFrom))
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// stop writes the last, possibly shorter interval and closes the output.
+func (w *intervalWriter) stop() {
+	close(w.done)
+	<-w.stopped
+	w.write("finished")
+	if w.out != os.Stderr {
+		w.out.Close()
+	}
+}
+
+func (w *intervalWriter) write(phase string) {
+	now := time.Now()
+	w.mu.Lock()
+	rec, bytes, from := w.current, w.bytes, w.lastFrom
+	w.current, w.bytes, w.lastFrom = metrics.NewRecorder(), 0, now
+	w.mu.Unlock()
+
+	snap := rec.Snapshot(now.Sub(from))
+	line := intervalLine{
+		Type:            "interval",
+		Time:            now.Unix(),
+		Phase:           phase,
+		ElapsedSeconds:  now.Sub(w.measureFrom).Seconds(),
+		IntervalSeconds: now.Sub(from).Seconds(),
+		Requests:        snap.Requests,
+		Errors:          snap.Errors,
+		ErrorRate:       snap.ErrorRate,
+		RPS:             snap.RPS,
+		Avg:             durationMs(snap.Mean),
+		P50:             durationMs(snap.P50),
+		P90:             durationMs(snap.P90),
+		P99:             durationMs(snap.P99),
+		Max:             durationMs(snap.Max),
+		BytesReceived:   bytes,
+		InFlight:        max(atomic.LoadInt64(&w.stats.attempted)-atomic.LoadInt64(&w.stats.recorded), 0),
+	}
+	if err := w.enc.Encode(line); err != nil {
+		log.Error().Timestamp().Err(err).Msg("Failed to write interval statistics")
+	}
+}
@@ -1,12 +1,25 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
+	"dos/internal/config"
+	"dos/internal/dist"
+	"dos/internal/failover"
+	feederpkg "dos/internal/feeder"
+	"dos/internal/hook"
+	"dos/internal/limits"
+	"dos/internal/mail"
+	"dos/internal/metrics"
 	"dos/internal/proxy"
+	"dos/internal/schema"
 	"dos/internal/util"
+	"errors"
 	"flag"
 	"fmt"
-	"math/rand"
+	"maps"
+	"net"
 	"net/url"
 	"os"
 	"os/signal"
@@ -14,6 +27,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 
 	"time"
 
@@ -25,47 +39,198 @@ import (
 var (
 	version                = ""
 	printVersion           = flag.Bool("version", false, "print version")
+	configFile             = flag.String("config", "", "path to JSON config file with flag values (supports include and $ref)")
 	targetURL              = flag.String("url", "", "url address of target to send requests to")
+	dataFile               = flag.String("data", "", "CSV or JSON file whose rows are used one per request through {{data.<column>}} placeholders")
+	fromCurl               = flag.String("from_curl", "", "curl command line to take the URL, method, headers and body from (- reads it from stdin)")
+	harPath                = flag.String("har", "", "HAR file whose requests are replayed in order instead of the -url request")
+	accessLog              = flag.String("access_log", "", "nginx or Apache access log (common or combined format) whose requests are replayed against -url")
+	replayTiming           = flag.Bool("replay_timing", false, "launch -har or -access_log requests with the gaps they were recorded with")
+	replaySpeed            = flag.Float64("replay_speed", 1, "speed multiplier of -replay_timing (e.g. 2 replays twice as fast)")
+	body                   = flag.String("body", "", "request body, may contain placeholders such as {{uuid}} or {{seq}}")
+	formFields             = stringListFlag("form", "multipart form field name=value sent as body, may be repeated and contain placeholders")
+	formFiles              = stringListFlag("form_file", "multipart form file name=@path, or name=@random:size with random content of a size like 64KB or 10KB-1MB, may be repeated")
 	method                 = flag.String("method", fasthttp.MethodGet, "HTTP method to use")
+	methodMix              = flag.String("method_mix", "", "weighted mix of HTTP methods, e.g. GET:80,POST:20, with per-method bodies and headers in the methods section of the config file")
 	randomMethod           = flag.Bool("random_method", false, "randomize HTTP method")
 	delayBetweenRequests   = flag.Duration("delay", 0, "delay between requests")
+	delayJitter            = flag.Duration("delay_jitter", 0, "random jitter applied to the delay between requests")
+	delayDist              = flag.String("delay_dist", "constant", "distribution of the delay between requests (constant, uniform, exponential, normal, or a spec like lognormal(200ms,1.5))")
 	maxGoroutines          = flag.Int("max_goroutines", 10, "limit of maximum goroutines count")
+	workload               = flag.String("workload", "closed", "workload model: closed keeps max_goroutines requests in flight, open launches requests on the -delay/-delay_dist schedule regardless of outstanding ones")
+	vus                    = flag.Int("vus", 0, "number of virtual users, each with its own connections, cookies and proxy (overrides max_goroutines, 0 disables)")
 	requestTimeout         = flag.Duration("request_timeout", time.Second*10, "timeout for each request")
+	connectTimeout         = flag.Duration("connect_timeout", fasthttp.DefaultDialTimeout, "timeout for establishing direct TCP connections to the target")
+	tlsTimeout             = flag.Duration("tls_timeout", 0, "timeout for the TLS handshake with the target (0 means request_timeout)")
+	readTimeout            = flag.Duration("read_timeout", 0, "timeout for reading a response, overriding the client default (0 keeps it)")
+	writeTimeout           = flag.Duration("write_timeout", 0, "timeout for writing a request, overriding the client default (0 keeps it)")
 	logLevel               = flag.String("lvl", "info", "log level")
 	userAgent              = flag.String("user_agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/138.0.0.0 Safari/537.36", "user-agent used for requests")
 	userAgentsListFile     = flag.String("user_agents_list", "", "path to file with list of user agents. Will use default user agent if not provided")
 	executionTime          = flag.Duration("exec_time", 0, "total duration of execution")
+	totalRequests          = flag.Int64("requests", 0, "total number of requests to send before stopping (0 means unlimited)")
+	warmup                 = flag.Duration("warmup", 0, "duration of warm-up phase whose requests are not counted in statistics")
+	statusFile             = flag.String("status_file", "", "path to JSON file rewritten every second with current statistics")
+	intervalOut            = flag.String("interval_out", "", "path to append the statistics of every -interval to as JSON lines (- for stderr)")
+	intervalLength         = flag.Duration("interval", time.Second, "length of the intervals written to -interval_out")
+	timeseriesOut          = flag.String("timeseries_out", "", "path to write per-second statistics to at the end of the run (- for stdout)")
+	timeseriesFormat       = flag.String("timeseries_format", "json", "format of per-second statistics (json, csv)")
+	resultsOut             = flag.String("results_out", "", "path to write every request outside of warm-up to, for the report command")
+	resultsFormat          = flag.String("results_format", "ndjson", "format of -results_out (ndjson, csv)")
+	controlAddr            = flag.String("control_addr", "", "address for the HTTP control API (e.g. :8081), on 127.0.0.1 unless a host is given, disabled if empty")
+	controlTokenFile       = flag.String("control_token_file", "", "path to the file with the Bearer token the control API requires for requests that change the run")
+	controlStdin           = flag.Bool("control_stdin", false, "read commands such as \"rate 200\" or \"vus 50\" from stdin during the run")
+	controlSocket          = flag.String("control_socket", "", "path of a unix socket accepting the same commands as -control_stdin")
+	rollingWindow          = flag.Duration("rolling_window", time.Second*10, "window of rolling statistics used to select request variants")
+	sloTarget              = flag.Float64("slo_target", 0, "percentage of requests that must succeed for the error budget report (e.g. 99.9, 0 disables)")
+	sloLatency             = flag.Duration("slo_latency", 0, "requests slower than this also count against the error budget (0 means only failures)")
+	iOwnThisTarget         = flag.Bool("i_own_this_target", false, "confirm that you own or are authorized to load test every host the run sends requests to")
+	targetAllowlist        = flag.String("target_allowlist", "", "path to a file of host names the run may send requests to, one per line, *.example.com matching subdomains")
+	verifyToken            = flag.String("verify_token", "", "token every target host must serve in "+verificationPath+" for the run to start")
+	blockPrivate           = flag.Bool("block_private", false, "refuse targets resolving to private (RFC 1918, fc00::/7) or link-local addresses; with -proxy_list only checked at startup")
+	blockCIDRs             = flag.String("block_cidrs", "", "comma-separated CIDRs or addresses the run must never connect to (e.g. 10.20.0.0/16,203.0.113.7); with -proxy_list only checked at startup")
+	blockDomains           = flag.String("block_domains", "", "comma-separated domains the run must never send requests to, including their subdomains; with -proxy_list only checked at startup")
+	awsSign                = flag.Bool("aws_sign", false, "sign HTTP requests with AWS Signature Version 4, with credentials from the environment or -aws_profile")
+	awsProfile             = flag.String("aws_profile", "", "profile of the shared AWS credentials file used with -aws_sign (default AWS_PROFILE or default)")
+	awsRegion              = flag.String("aws_region", "", "region requests are signed for with -aws_sign (default AWS_REGION, or taken from the target host)")
+	awsService             = flag.String("aws_service", "", "service requests are signed for with -aws_sign (default taken from the target host)")
+	hmacHeader             = flag.String("hmac_header", "", "header set to an HMAC of every HTTP request, e.g. X-Signature")
+	hmacKeyFile            = flag.String("hmac_key_file", "", "path to the file with the -hmac_header key")
+	hmacAlgorithm          = flag.String("hmac_algorithm", "sha256", "hash of -hmac_header (sha1, sha256, sha512)")
+	hmacEncoding           = flag.String("hmac_encoding", "hex", "encoding of -hmac_header (hex, base64)")
+	hmacMessage            = flag.String("hmac_message", "{{body}}", "message signed for -hmac_header, with {{method}}, {{path}}, {{host}}, {{body}}, {{body_sha256}} and {{header.<name>}} placeholders")
+	hmacPrefix             = flag.String("hmac_prefix", "", "prefix of the -hmac_header value, e.g. sha256=")
+	primeURL               = flag.String("prime_url", "", "URL requested once before the run, whose response -extract takes values from and whose cookies are sent with every request")
+	extractRules           = stringListFlag("extract", "name=source:expression value taken from the -prime_url response into {{extract.<name>}}, where source is regex (first group), json (a path like data.token) or header, may be repeated")
+	oauthTokenURL          = flag.String("oauth_token_url", "", "OAuth2 token endpoint a client credentials token is fetched from and sent as the Bearer token of every HTTP request")
+	oauthClientID          = flag.String("oauth_client_id", "", "client ID of -oauth_token_url")
+	oauthSecretFile        = flag.String("oauth_client_secret_file", "", "path to the file with the client secret of -oauth_token_url")
+	oauthScope             = flag.String("oauth_scope", "", "space-separated scopes requested from -oauth_token_url")
+	oauthClientAuth        = flag.String("oauth_client_auth", "basic", "how the client authenticates to -oauth_token_url: basic (HTTP Basic) or post (in the form body)")
+	oauthRefreshBefore     = flag.Duration("oauth_refresh_before", time.Minute, "how long before it expires the OAuth2 token is refreshed, at the latest halfway through its lifetime")
+	validateSchema         = flag.String("validate_schema", "", "JSON Schema file 2xx responses are validated against, with violations counted as schema errors")
+	validateSample         = flag.Float64("validate_sample", 1, "fraction of 2xx responses validated against -validate_schema (e.g. 0.1)")
+	hookPlugin             = flag.String("hook", "", "path to a Go plugin whose hooks are called before every HTTP request and after every response")
+	hookArgs               = flag.String("hook_args", "", "argument passed to the New function of the -hook plugin")
+	dryRun                 = flag.Bool("dry_run", false, "send a single request, print the connection, request and response, and exit")
+	sampleRate             = flag.Float64("sample_rate", 0, "fraction of requests whose full request and response are written to -sample_out (e.g. 0.01)")
+	sampleOut              = flag.String("sample_out", "", "path to write sampled requests and responses to as NDJSON, with bodies truncated to 4KiB")
+	eventsOut              = flag.String("events_out", "", "path to write run lifecycle events to as NDJSON")
+	manifestOut            = flag.String("manifest_out", "", "path to write a JSON manifest with the effective configuration, version and host of the run to at startup")
+	phasesOut              = flag.String("phases_out", "", "path to write JSON with precise run phase boundaries to")
+	traceMarker            = flag.Bool("trace_marker", false, "write run phase boundaries to the ftrace marker on linux for perf/trace-cmd, or as ETW events on windows")
+	auto                   = flag.Bool("auto", false, "find the highest request rate the target sustains by raising the rate stepwise, then stop")
+	autoStartRPS           = flag.Float64("auto_start_rps", 10, "request rate of the first -auto step")
+	autoStepDuration       = flag.Duration("auto_step", time.Second*10, "duration of every -auto step")
+	autoMaxErrorRate       = flag.String("auto_max_error_rate", "1%", "highest error rate of a passing -auto step (failed requests and 5xx responses count as errors)")
+	autoMaxP99             = flag.Duration("auto_max_p99", time.Second, "highest p99 latency of a passing -auto step")
+	abortOnErrorRate       = flag.String("abort_on_error_rate", "", "stop the run when the error rate over -abort_window reaches this, e.g. 50% (failed requests and 5xx responses count as errors)")
+	abortWindow            = flag.Duration("abort_window", time.Second*10, "sliding window of -abort_on_error_rate")
+	abortMinRequests       = flag.Uint64("abort_min_requests", 20, "requests needed in the window before -abort_on_error_rate can stop the run")
+	drainTimeout           = flag.Duration("drain_timeout", time.Second*10, "how long to wait for in-flight requests to finish on shutdown")
+	baselineRequests       = flag.Int("baseline_requests", 0, "unloaded requests sent one at a time before the run to check the target answers and measure its idle latency (0 disables)")
+	probeURL               = flag.String("probe_url", "", "health or metrics URL on the target polled during the run, outside of the load, for correlation")
+	probeInterval          = flag.Duration("probe_interval", time.Second*5, "how often -probe_url is polled")
+	crashDir               = flag.String("crash_dir", ".", "directory crash reports are written to when a worker goroutine panics")
 	prettyLog              = flag.Bool("pretty", false, "enable pretty logging")
+	quiet                  = flag.Bool("quiet", false, "only log errors, and print the final summary (in -summary_format, text by default)")
+	summaryFormat          = flag.String("summary_format", "", "print a final summary to stdout after the logs (text, json)")
 	proxyList              = flag.String("proxy_list", "", "path to file with list of proxies")
+	saveValidProxies       = flag.String("save_valid_proxies", "", "path to write the proxies that passed validation to, for use as the proxy list of later runs")
+	saveInvalidProxies     = flag.String("save_invalid_proxies", "", "path to write the proxies that failed validation to")
+	proxyCache             = flag.String("proxy_cache", "", "path to a file caching proxy validation results, so that only proxies whose result expired are checked again")
+	proxyCacheTTL          = flag.Duration("proxy_cache_ttl", time.Hour, "how long a cached proxy validation result is used")
+	dnsFailover            = flag.Bool("dns_failover", false, "move new connections to other resolved target IPs when one keeps failing (direct connections only)")
+	failoverThreshold      = flag.Int("failover_threshold", 3, "consecutive connect errors or resets before a target IP is failed over")
+	failoverCooldown       = flag.Duration("failover_cooldown", time.Second*30, "how long a failed target IP is avoided")
 	startingTimeoutSeconds = flag.Int("starting_timeout", 3, "timeout for starting in seconds")
+	maxConnsPerHost        = flag.Int("max_conns_per_host", 0, "maximum connections per host (0 means the larger of 512 and max_goroutines)")
+	maxIdleConnDuration    = flag.Duration("max_idle_conn_duration", fasthttp.DefaultMaxIdleConnDuration, "how long idle keep-alive connections are kept open")
+	readBufferSize         = flag.Int("read_buffer_size", 0, "per-connection read buffer size in bytes (0 means fasthttp default)")
+	writeBufferSize        = flag.Int("write_buffer_size", 0, "per-connection write buffer size in bytes (0 means fasthttp default)")
+	ipVersion              = flag.String("ip_version", "any", "address family used to connect to the target (4, 6, any)")
+	timingBreakdown        = flag.Bool("timing_breakdown", false, "report DNS, connect, TLS, time to first byte and transfer timings of HTTP requests")
+	retries                = flag.Int("retries", 0, "how many times a failed HTTP request is retried")
+	retryBackoff           = flag.Duration("retry_backoff", time.Millisecond*100, "delay before the first retry, doubled for every further retry")
+	retryOnStatus          = flag.String("retry_on_status", "", "comma-separated response status codes that are retried like errors (e.g. 502,503)")
+	followRedirects        = flag.Bool("follow_redirects", false, "follow 3xx redirects and report the latency of every hop")
+	maxRedirects           = flag.Int("max_redirects", 5, "maximum redirects followed per request with -follow_redirects")
+	compression            = flag.String("compression", "", "comma-separated encodings requested with Accept-Encoding (gzip, deflate, br, zstd); responses are decompressed and both sizes reported")
+	disableKeepalive       = flag.Bool("disable_keepalive", false, "open a new connection for every request instead of reusing pooled connections")
+	insecure               = flag.Bool("insecure", false, "skip verification of the target's TLS certificate")
+	tlsMinVersion          = flag.String("tls_min_version", "", "minimum TLS version offered to the target (1.0, 1.1, 1.2, 1.3)")
+	tlsMaxVersion          = flag.String("tls_max_version", "", "maximum TLS version offered to the target (1.0, 1.1, 1.2, 1.3)")
+	ciphers                = flag.String("ciphers", "", "comma-separated TLS 1.0-1.2 cipher suites offered to the target (e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)")
+	certFile               = flag.String("cert", "", "path to PEM client certificate presented to the target (requires -key)")
+	keyFile                = flag.String("key", "", "path to PEM private key of the client certificate")
+	caFile                 = flag.String("ca", "", "path to PEM CA bundle used to verify the target instead of the system roots")
+	seed                   = flag.Int64("seed", 0, "seed of all random choices, such as user agents, methods, jitter and placeholders, to repeat a run; requests only repeat in the same order with a single worker (-max_goroutines 1 or -vus 1) (0 picks one, which is logged)")
+	mailCommands           = flag.String("mail_commands", "", "comma-separated commands sent after the greeting in smtp/imap mode (e.g. EHLO,NOOP)")
 
-	client        *fasthttp.Client
-	log           zerolog.Logger
-	limiter       *rate.Limiter
-	userAgentList []string
+	client         *fasthttp.Client
+	rotator        *proxy.ProxyRotator
+	control        = &runControl{}
+	failoverDialer *failover.Dialer
+	log            zerolog.Logger
+	limiter        *rate.Limiter
+	userAgentList  []string
+	// rng is the source of every random choice of the load, seeded from
+	// -seed.
+	rng         *dist.LockedRand
+	engine      Engine
+	retry       *retryPolicy
+	curlRequest *requestSpec
+	replay      *replayLog
+	sampler     *requestSampler
+	form        *multipartForm
+	hooks       hook.Hooks
+	// responseSchema is loaded from -validate_schema.
+	responseSchema *schema.Schema
+
+	allowedHTTPMethods = []string{fasthttp.MethodGet, fasthttp.MethodPost, fasthttp.MethodPut, fasthttp.MethodPatch, fasthttp.MethodDelete, fasthttp.MethodHead, fasthttp.MethodOptions, fasthttp.MethodConnect, fasthttp.MethodTrace}
+
+	commandStats = newNamedStats()
 )
 
 func main() {
-	flag.Parse()
+	dispatch(os.Args[1:])
+}
+
+// runLoadTest is the run command.
+func runLoadTest(args []string) {
+	flag.CommandLine.Parse(args)
 	if *printVersion {
 		fmt.Println(version)
 		return
 	}
+
+	var configErr error
+	if *configFile != "" {
+		configErr = loadConfig(*configFile)
+	}
 	*method = strings.ToUpper(*method)
 
-	if *prettyLog {
-		log = zerolog.New(zerolog.NewConsoleWriter())
-	} else {
-		log = zerolog.New(os.Stdout)
+	lvl := setupLog(os.Stdout, *prettyLog, *logLevel)
+	if *quiet {
+		lvl = max(lvl, zerolog.ErrorLevel)
+		*summaryFormat = cmp.Or(*summaryFormat, "text")
 	}
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	zerolog.SetGlobalLevel(lvl)
 
-	lvl, err := zerolog.ParseLevel(*logLevel)
-	if err != nil {
-		log.Fatal().Timestamp().Err(err).Send()
+	if configErr != nil {
+		log.Fatal().Timestamp().Err(configErr).Str("config", *configFile).Msg("Failed to load config")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
 	}
+	rng = dist.NewLockedRand(*seed)
 
-	zerolog.SetGlobalLevel(lvl)
+	if *fromCurl != "" {
+		if err := importCurl(*fromCurl); err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Invalid curl command")
+		}
+		log.Info().Timestamp().Str("method", *method).Str("url", *targetURL).Int("headers", len(curlRequest.Headers)).Msg("Imported curl command")
+	}
 
 	if *userAgentsListFile != "" {
 		var err error
@@ -78,85 +243,769 @@ func main() {
 		log.Info().Timestamp().Msg("No user agents list provided, using default user agent")
 	}
 
+	if err := loadTLSConfig(); err != nil {
+		log.Fatal().Err(err).Timestamp().Msg("Invalid TLS settings")
+	}
+	if len(targetTLS.Certificates) > 0 {
+		log.Info().Timestamp().Str("cert", *certFile).Msg("Using client certificate")
+	}
+
 	if *proxyList != "" {
 		proxies, err := util.ReadFileEntries(*proxyList)
 		if err != nil {
 			log.Fatal().Err(err).Timestamp().Msg("Failed to read proxy list")
 		}
 		log.Info().Timestamp().Int("proxies-count", len(proxies)).Msg("Validating proxy list")
-		validProxies, _ := proxy.ValidateProxies(proxies)
+		var validProxies, invalidProxies []string
+		if *proxyCache != "" {
+			cache, err := proxy.LoadCache(*proxyCache, *proxyCacheTTL)
+			if err != nil {
+				log.Fatal().Err(err).Timestamp().Msg("Failed to read proxy cache")
+			}
+			checks, cached := cache.Validate(proxies, proxy.Options{Timeout: 5 * time.Second})
+			validProxies, invalidProxies = proxy.Split(checks)
+			log.Info().Timestamp().Int("cached", cached).Msg("Used cached proxy validation results")
+			if err := cache.Save(); err != nil {
+				log.Warn().Err(err).Timestamp().Msg("Failed to save proxy cache")
+			}
+		} else {
+			validProxies, invalidProxies = proxy.ValidateProxies(proxies)
+		}
 		log.Info().Timestamp().Str("valid-proxies", fmt.Sprintf("%d/%d", len(validProxies), len(proxies))).Msg("Validated proxy list")
+		if *saveValidProxies != "" {
+			if err := saveProxies(*saveValidProxies, validProxies); err != nil {
+				log.Fatal().Err(err).Timestamp().Msg("Failed to save valid proxies")
+			}
+		}
+		if *saveInvalidProxies != "" {
+			if err := saveProxies(*saveInvalidProxies, invalidProxies); err != nil {
+				log.Fatal().Err(err).Timestamp().Msg("Failed to save invalid proxies")
+			}
+		}
 
-		client = proxy.NewProxyRotator(validProxies).GetClient()
+		rotator = proxy.NewProxyRotator(validProxies)
+		client = rotator.GetClient()
 		log.Info().Timestamp().Msg("Using proxy list")
+		if *ipVersion != "any" {
+			log.Warn().Timestamp().Msg("ip_version is not supported with proxies, the proxy resolves the target")
+		}
+		if *dnsFailover {
+			log.Warn().Timestamp().Msg("DNS failover is not supported with proxies, ignoring")
+		}
 	} else {
 		log.Info().Timestamp().Msg("No proxy list provided, using direct connection")
-		client = &fasthttp.Client{}
+		client = &fasthttp.Client{Dial: countingDial(targetDial())}
+		if *dnsFailover {
+			failoverDialer = failover.NewDialer(*connectTimeout, *failoverThreshold, *failoverCooldown)
+			failoverDialer.Network = dialNetwork()
+			failoverDialer.OnFailover = func(e failover.Event) {
+				log.Warn().Timestamp().Err(e.Err).Str("host", e.Host).Str("from", e.From).Str("to", e.To).Msg("Target address failed over")
+				events.emit(eventFailover, map[string]any{"host": e.Host, "from": e.From, "to": e.To, "error": errString(e.Err)})
+			}
+			client.Dial = countingDial(scopedDial(failoverDialer.Dial))
+		}
+	}
+
+	stageRPS, stageVUs := stageLoad(stageConfigs)
+	initialVUs := *vus
+	*vus = max(*vus, stageVUs)
+	if *vus > 0 {
+		*maxGoroutines = *vus
+	}
+	clampConcurrency()
+	configureClient(client)
+	if client.MaxConnsPerHost < *maxGoroutines {
+		log.Warn().Timestamp().Int("max_conns_per_host", client.MaxConnsPerHost).Int("max_goroutines", *maxGoroutines).Msg("max_conns_per_host is lower than max_goroutines, requests may fail with no free connections")
+	}
+
+	var delayPacer *pacer
+	if *delayDist != "constant" {
+		if *delayBetweenRequests <= 0 && !strings.Contains(*delayDist, "(") {
+			log.Fatal().Timestamp().Str("delay_dist", *delayDist).Msg("delay_dist requires a positive delay")
+		}
+		interval, err := delayDistribution(*delayDist, *delayBetweenRequests, *delayJitter)
+		if err != nil {
+			log.Fatal().Timestamp().Err(err).Str("delay_dist", *delayDist).Msg("Invalid delay_dist")
+		}
+		delayPacer = newPacer(interval)
+	}
+
+	if *workload == "open" && delayPacer == nil && *delayBetweenRequests > 0 {
+		// unlike the limiter, a pacer keeps arrivals on their schedule
+		interval, err := dist.Parse(delayBetweenRequests.String())
+		if err != nil {
+			log.Fatal().Timestamp().Err(err).Msg("Invalid delay")
+		}
+		delayPacer = newPacer(interval)
 	}
 
-	if *delayBetweenRequests != 0 {
+	if *delayBetweenRequests != 0 && delayPacer == nil {
 		limiter = rate.NewLimiter(rate.Every(*delayBetweenRequests), 1)
+	} else if *controlAddr != "" || *controlStdin || *controlSocket != "" {
+		limiter = rate.NewLimiter(rate.Inf, 1)
+	}
+	if *auto {
+		limiter = rate.NewLimiter(rate.Limit(*autoStartRPS), 1)
+	}
+	if stageRPS > 0 && limiter == nil {
+		limiter = rate.NewLimiter(rate.Inf, 1)
 	}
 
-	if _, err := url.Parse(*targetURL); err != nil {
-		log.Fatal().Err(err).Timestamp().Str("url", *targetURL).Err(err).Msg("Invalid targetURL")
+	var err error
+	if *harPath != "" {
+		replay, err = loadHAR(*harPath)
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Failed to load HAR file")
+		}
+		if *targetURL == "" {
+			*targetURL = replay.entries[0].URL
+		}
+		log.Info().Timestamp().Str("har", *harPath).Int("requests", len(replay.entries)).Msg("Loaded HAR file")
+	}
+	if len(scenarioSteps) > 0 {
+		if *harPath != "" || *accessLog != "" || *fromCurl != "" || *methodMix != "" {
+			log.Fatal().Timestamp().Msg("the scenario config section cannot be combined with har, access_log, from_curl or method_mix")
+		}
+		replay, err = newScenario(scenarioSteps)
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Invalid scenario")
+		}
+		if *targetURL == "" {
+			*targetURL = replay.entries[0].URL
+		}
+		if *vus == 0 && slices.ContainsFunc(scenarioSteps, func(s scenarioStep) bool { return len(s.Extract) > 0 }) {
+			log.Fatal().Timestamp().Msg("extract in scenario steps requires -vus")
+		}
 	}
 
-	allowedHTTPMethods := []string{fasthttp.MethodGet, fasthttp.MethodPost, fasthttp.MethodPut, fasthttp.MethodPatch, fasthttp.MethodDelete, fasthttp.MethodHead, fasthttp.MethodOptions, fasthttp.MethodConnect, fasthttp.MethodTrace}
+	target, err := url.Parse(*targetURL)
+	if err != nil {
+		log.Fatal().Err(err).Timestamp().Str("url", *targetURL).Err(err).Msg("Invalid targetURL")
+	}
 
 	switch {
 	case *targetURL == "":
 		log.Fatal().Timestamp().Msg("targetURL is required")
 	case *delayBetweenRequests < 0:
 		log.Fatal().Timestamp().Msg("delayBetweenRequests must be non-negative")
+	case *delayJitter < 0:
+		log.Fatal().Timestamp().Msg("delay_jitter must be non-negative")
+	case *workload != "open" && *workload != "closed":
+		log.Fatal().Timestamp().Msg("workload must be open or closed")
+	case *workload == "open" && delayPacer == nil:
+		log.Fatal().Timestamp().Msg("open workload requires -delay or -delay_dist to schedule arrivals")
+	case *workload == "open" && *vus > 0:
+		log.Fatal().Timestamp().Msg("open workload cannot be combined with vus")
+	case *vus < 0:
+		log.Fatal().Timestamp().Msg("vus must be non-negative")
 	case *maxGoroutines < 1:
 		log.Fatal().Timestamp().Msg("maxGoroutines must be at least 1")
+	case *totalRequests < 0:
+		log.Fatal().Timestamp().Msg("requests must be non-negative")
+	case *warmup < 0:
+		log.Fatal().Timestamp().Msg("warmup must be non-negative")
+	case *connectTimeout <= 0:
+		log.Fatal().Timestamp().Msg("connect_timeout must be positive")
+	case *tlsTimeout < 0 || *readTimeout < 0 || *writeTimeout < 0:
+		log.Fatal().Timestamp().Msg("tls_timeout, read_timeout and write_timeout must be non-negative")
+	case *summaryFormat != "" && *summaryFormat != "text" && *summaryFormat != "json":
+		log.Fatal().Timestamp().Str("summary_format", *summaryFormat).Msg("summary_format must be text or json")
+	case *intervalOut != "" && *intervalLength <= 0:
+		log.Fatal().Timestamp().Msg("interval must be positive")
+	case *timeseriesFormat != "json" && *timeseriesFormat != "csv":
+		log.Fatal().Timestamp().Msg("timeseries_format must be json or csv")
+	case *resultsFormat != "ndjson" && *resultsFormat != "csv":
+		log.Fatal().Timestamp().Msg("results_format must be ndjson or csv")
+	case *auto && (*delayBetweenRequests != 0 || delayPacer != nil || *replayTiming):
+		log.Fatal().Timestamp().Msg("auto cannot be combined with delay, delay_dist or replay_timing")
+	case *auto && *autoStartRPS < 1:
+		log.Fatal().Timestamp().Msg("auto_start_rps must be at least 1")
+	case *auto && *autoStepDuration < time.Second:
+		log.Fatal().Timestamp().Msg("auto_step must be at least 1s")
+	case stageRPS > 0 && (delayPacer != nil || *replayTiming):
+		log.Fatal().Timestamp().Msg("stage rps cannot be combined with delay_dist or replay_timing")
+	case *abortWindow < time.Second:
+		log.Fatal().Timestamp().Msg("abort_window must be at least 1s")
+	case *rollingWindow < time.Second:
+		log.Fatal().Timestamp().Msg("rolling_window must be at least 1s")
+	case *maxConnsPerHost < 0:
+		log.Fatal().Timestamp().Msg("max_conns_per_host must be non-negative")
+	case *maxIdleConnDuration < 0:
+		log.Fatal().Timestamp().Msg("max_idle_conn_duration must be non-negative")
+	case *readBufferSize < 0 || *writeBufferSize < 0:
+		log.Fatal().Timestamp().Msg("buffer sizes must be non-negative")
+	case *ipVersion != "4" && *ipVersion != "6" && *ipVersion != "any":
+		log.Fatal().Timestamp().Msg("ip_version must be 4, 6 or any")
+	case *failoverThreshold < 1:
+		log.Fatal().Timestamp().Msg("failover_threshold must be at least 1")
+	case *fromCurl == "-" && *controlStdin:
+		log.Fatal().Timestamp().Msg("from_curl cannot read stdin with control_stdin")
+	case *fromCurl != "" && replay != nil:
+		log.Fatal().Timestamp().Msg("from_curl cannot be combined with har")
+	case *fromCurl != "" && *accessLog != "":
+		log.Fatal().Timestamp().Msg("from_curl cannot be combined with access_log")
+	case *harPath != "" && *accessLog != "":
+		log.Fatal().Timestamp().Msg("har and access_log cannot be combined")
+	case *replayTiming && *harPath == "" && *accessLog == "":
+		log.Fatal().Timestamp().Msg("replay_timing requires -har or -access_log")
+	case *replayTiming && (*delayBetweenRequests != 0 || delayPacer != nil):
+		log.Fatal().Timestamp().Msg("replay_timing cannot be combined with delay or delay_dist")
+	case *replaySpeed <= 0:
+		log.Fatal().Timestamp().Msg("replay_speed must be positive")
+	case *followRedirects && *maxRedirects < 1:
+		log.Fatal().Timestamp().Msg("max_redirects must be at least 1")
+	case *probeURL != "" && *probeInterval < time.Second:
+		log.Fatal().Timestamp().Msg("probe_interval must be at least 1s")
+	case *baselineRequests < 0:
+		log.Fatal().Timestamp().Msg("baseline_requests must be non-negative")
+	case *retries < 0:
+		log.Fatal().Timestamp().Msg("retries must be non-negative")
+	case *retryBackoff < 0:
+		log.Fatal().Timestamp().Msg("retry_backoff must be non-negative")
+	case *proxyCacheTTL <= 0:
+		log.Fatal().Timestamp().Msg("proxy_cache_ttl must be positive")
+	case *controlAddr != "" && *controlTokenFile == "":
+		log.Fatal().Timestamp().Msg("control_addr requires -control_token_file")
+	case (*saveValidProxies != "" || *saveInvalidProxies != "") && *proxyList == "":
+		log.Fatal().Timestamp().Msg("save_valid_proxies and save_invalid_proxies require -proxy_list")
+	case *drainTimeout < 0:
+		log.Fatal().Timestamp().Msg("drain_timeout must be non-negative")
+	case *sloTarget < 0 || *sloTarget >= 100:
+		log.Fatal().Timestamp().Msg("slo_target must be between 0 and 100")
+	case *sloLatency < 0:
+		log.Fatal().Timestamp().Msg("slo_latency must be non-negative")
+	case len(*extractRules) > 0 && *primeURL == "":
+		log.Fatal().Timestamp().Msg("extract requires -prime_url")
+	case *oauthTokenURL != "" && *awsSign:
+		log.Fatal().Timestamp().Msg("oauth_token_url cannot be combined with aws_sign")
+	case *oauthRefreshBefore < 0:
+		log.Fatal().Timestamp().Msg("oauth_refresh_before must be non-negative")
+	case *validateSample <= 0 || *validateSample > 1:
+		log.Fatal().Timestamp().Msg("validate_sample must be greater than 0 and at most 1")
+	case *validateSchema != "" && target.Scheme != "http" && target.Scheme != "https":
+		log.Fatal().Timestamp().Msg("validate_schema requires an http or https target")
+	case *sampleRate < 0 || *sampleRate > 1:
+		log.Fatal().Timestamp().Msg("sample_rate must be between 0 and 1")
+	case (*sampleRate > 0) != (*sampleOut != ""):
+		log.Fatal().Timestamp().Msg("sample_rate and sample_out must be set together")
+	case *sampleOut != "" && target.Scheme != "http" && target.Scheme != "https":
+		log.Fatal().Timestamp().Msg("sample_out is only supported for http and https targets")
 	case !slices.Contains(allowedHTTPMethods, *method):
 		log.Fatal().Timestamp().Msg("invalid HTTP method")
+	case *body != "" && (len(*formFields) > 0 || len(*formFiles) > 0):
+		log.Fatal().Timestamp().Msg("body cannot be combined with form or form_file")
+	case *methodMix != "" && *randomMethod:
+		log.Fatal().Timestamp().Msg("method_mix cannot be combined with random_method")
+	case *methodMix != "" && (*harPath != "" || *accessLog != ""):
+		log.Fatal().Timestamp().Msg("method_mix cannot be combined with har or access_log")
+	case *methodMix == "" && len(methodRequests) > 0:
+		log.Fatal().Timestamp().Msg("the methods config section requires -method_mix")
+	}
+
+	if *methodMix != "" {
+		mix, err = parseMethodMix(*methodMix)
+		if err != nil {
+			log.Fatal().Timestamp().Err(err).Msg("Invalid method_mix")
+		}
+		for name := range methodRequests {
+			if !slices.Contains(mix.methods, name) {
+				log.Fatal().Timestamp().Str("method", name).Msg("The methods config section has a method that is not in method_mix")
+			}
+		}
+	}
+
+	if *accessLog != "" {
+		var skipped int
+		replay, skipped, err = loadAccessLog(*accessLog, target)
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Failed to load access log")
+		}
+		log.Info().Timestamp().Str("access_log", *accessLog).Int("requests", len(replay.entries)).Int("skipped_lines", skipped).Msg("Loaded access log")
+	}
+	if replay != nil {
+		replay.setSpeed(*replaySpeed)
+	}
+
+	if *retries > 0 {
+		retry, err = newRetryPolicy(*retries, *retryBackoff, *retryOnStatus)
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Str("retry_on_status", *retryOnStatus).Msg("Invalid retry_on_status")
+		}
+		if rotator != nil {
+			retry.client = rotator.GetClient()
+			configureClient(retry.client)
+		}
+	}
+
+	if *sampleOut != "" {
+		sampler, err = newRequestSampler(*sampleOut, *sampleRate)
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Str("sample_out", *sampleOut).Msg("Failed to open sample file")
+		}
+		defer sampler.close()
+	}
+
+	for _, rule := range *extractRules {
+		x, err := parseExtractor(rule)
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Invalid extract")
+		}
+		extractors = append(extractors, x)
+	}
+	if _, err := parseTemplate(*body); err != nil {
+		log.Fatal().Err(err).Timestamp().Msg("Invalid body")
+	}
+	if len(*formFields) > 0 || len(*formFiles) > 0 {
+		form, err = newMultipartForm(*formFields, *formFiles)
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Invalid form")
+		}
+		methodSet := false
+		flag.Visit(func(f *flag.Flag) { methodSet = methodSet || f.Name == "method" })
+		if !methodSet {
+			// like curl -F
+			*method = fasthttp.MethodPost
+		}
+	}
+	if *compression != "" {
+		if _, err := parseCompression(*compression); err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Invalid compression")
+		}
+	}
+	if *hookPlugin != "" {
+		if target.Scheme != "http" && target.Scheme != "https" {
+			log.Fatal().Timestamp().Msg("hook requires an http or https target")
+		}
+		hooks, err = hook.Load(*hookPlugin, *hookArgs)
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Str("hook", *hookPlugin).Msg("Failed to load hook plugin")
+		}
+		log.Info().Timestamp().Str("hook", *hookPlugin).Msg("Loaded hook plugin")
+	}
+	if *validateSchema != "" {
+		responseSchema, err = schema.Load(*validateSchema)
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Invalid response schema")
+		}
+	}
+	if *awsSign || *hmacHeader != "" || *oauthTokenURL != "" {
+		if target.Scheme != "http" && target.Scheme != "https" {
+			log.Fatal().Timestamp().Msg("aws_sign, hmac_header and oauth_token_url require an http or https target")
+		}
+		if signers, err = newSigners(target.Hostname()); err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Invalid request signing")
+		}
+	}
+	engine, err = newEngine(target)
+	if err != nil {
+		log.Fatal().Err(err).Timestamp().Str("url", *targetURL).Msg("Invalid targetURL")
+	}
+	if *dataFile != "" {
+		feeder, err = feederpkg.Load(*dataFile)
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Failed to load data file")
+		}
+		log.Info().Timestamp().Str("data", *dataFile).Int("rows", feeder.Len()).Msg("Loaded data file")
+	}
+	if err := checkDataColumns(); err != nil {
+		log.Fatal().Err(err).Timestamp().Msg("Invalid data placeholder")
+	}
+	if err := checkExtractNames(); err != nil {
+		log.Fatal().Err(err).Timestamp().Msg("Invalid extract placeholder")
+	}
+	if targetBlocklist, err = newBlocklist(*blockPrivate, *blockCIDRs, *blockDomains); err != nil {
+		log.Fatal().Err(err).Timestamp().Msg("Invalid blocklist")
+	}
+	if err := checkScope(); err != nil {
+		log.Fatal().Err(err).Timestamp().Msg("Target out of scope")
+	}
+	if targetBlocklist != nil && *proxyList != "" {
+		log.Warn().Timestamp().Msg("The blocklist is only checked at startup with proxy_list, redirects and placeholder hosts are not checked")
+	}
+	if err := confirmTargets(); err != nil {
+		log.Fatal().Err(err).Timestamp().Msg("Target not confirmed")
+	}
+	var oauthLifetime time.Duration
+	if oauth != nil {
+		if oauthLifetime, err = oauth.refresh(); err != nil {
+			log.Fatal().Err(err).Timestamp().Str("oauth_token_url", *oauthTokenURL).Msg("Failed to fetch OAuth2 token")
+		}
+		log.Info().Timestamp().Dur("expires_in", oauthLifetime).Msg("Fetched OAuth2 token")
+	}
+	if *primeURL != "" {
+		if err := prime(*primeURL); err != nil {
+			log.Fatal().Err(err).Timestamp().Str("prime_url", *primeURL).Msg("Priming request failed")
+		}
+		log.Info().Timestamp().Str("prime_url", *primeURL).Int("values", len(extracted)).Int("cookies", len(primeCookies)).Msg("Sent priming request")
+	}
+	if *dryRun {
+		dryCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err := sendDryRun(dryCtx, target)
+		stop()
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Dry run request failed")
+		}
+		return
+	}
+	var wrapDial func(fasthttp.DialFunc) fasthttp.DialFunc
+	if *timingBreakdown && (target.Scheme == "http" || target.Scheme == "https") {
+		var tlsConfig *tls.Config
+		if target.Scheme == "https" {
+			tlsConfig = client.TLSConfig
+		}
+		port := target.Port()
+		if port == "" {
+			port = "443"
+		}
+		client.Dial = tracingDial(client.Dial, rotator == nil && failoverDialer == nil, tlsConfig, port)
+		wrapDial = func(dial fasthttp.DialFunc) fasthttp.DialFunc {
+			return tracingDial(dial, false, tlsConfig, port)
+		}
+		if retry != nil && retry.client != nil {
+			retry.client.Dial = wrapDial(retry.client.Dial)
+		}
+	} else if target.Scheme == "https" {
+		port := cmp.Or(target.Port(), "443")
+		wrapDial = func(dial fasthttp.DialFunc) fasthttp.DialFunc {
+			return handshakingDial(dial, client.TLSConfig, port)
+		}
+		client.Dial = wrapDial(client.Dial)
+		if retry != nil && retry.client != nil {
+			retry.client.Dial = wrapDial(retry.client.Dial)
+		}
+	}
+
+	var users []*virtualUser
+	if *vus > 0 {
+		users = newVirtualUsers(*maxGoroutines, wrapDial)
+		// without -vus, all users run until a stage sets their number
+		activeUsers = newActiveVUs(cmp.Or(initialVUs, len(users)))
 	}
 
 	sem := make(chan struct{}, *maxGoroutines)
+	tickets := make(chan ticket)
 	respChan := make(chan *Result, *maxGoroutines)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
+	reqCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	if oauth != nil {
+		// refreshed until the run returns, since draining requests may
+		// still be retried and teardown steps are signed too
+		tokenCtx, stopRefresh := context.WithCancel(context.Background())
+		defer stopRefresh()
+		go oauth.run(tokenCtx, oauthLifetime)
+	}
+
+	stats := &runStats{errorTypes: newNamedStats(), generator: newGeneratorMonitor()}
+	if *sloTarget != 0 {
+		stats.budget = newErrorBudget(*sloTarget, *sloLatency)
+	}
+	if replay != nil {
+		stats.endpoints = newEndpointStats()
+	}
+	if stats.slos, err = newServiceLevels(sloConfigs); err != nil {
+		log.Fatal().Timestamp().Err(err).Msg("Invalid slos")
+	}
+	if *auto {
+		if len(stageConfigs) > 0 {
+			log.Fatal().Timestamp().Msg("auto cannot be combined with stages")
+		}
+		maxErrorRate, err := parseErrorRate(*autoMaxErrorRate)
+		if err != nil {
+			log.Fatal().Timestamp().Err(err).Msg("Invalid auto_max_error_rate")
+		}
+		stats.auto = newAutoSearch(maxErrorRate, *autoMaxP99, *autoStepDuration)
+	}
+	if *abortOnErrorRate != "" {
+		stats.breaker, err = newCircuitBreaker(*abortOnErrorRate, *abortWindow, *abortMinRequests)
+		if err != nil {
+			log.Fatal().Timestamp().Err(err).Msg("Invalid abort_on_error_rate")
+		}
+	}
+	if delayPacer != nil || *replayTiming || *baselineRequests > 0 || *summaryFormat != "" {
+		stats.latency = metrics.NewHistogram()
+	}
+	if delayPacer != nil || *replayTiming {
+		stats.corrected = metrics.NewHistogram()
+	}
+	runFailed := false
+	defer func() {
+		if runFailed {
+			os.Exit(1)
+		}
+	}()
+	if len(stageConfigs) > 0 || len(thresholdConfigs) > 0 {
+		stats.stages, err = newStagePlan(stageConfigs, thresholdConfigs)
+		if err != nil {
+			log.Fatal().Timestamp().Err(err).Msg("Invalid stages or thresholds")
+		}
+		if *executionTime == 0 {
+			*executionTime = stats.stages.duration()
+		}
+	}
+	inflight := &sync.WaitGroup{}
+	loopDone := make(chan struct{})
+	stopAggregating := make(chan struct{})
+	aggregated := make(chan struct{})
 
-	var sentRequestCount, errCount, totalDuration int64
-	executionTimer := time.NewTimer(*executionTime)
-	startedAt := time.Now()
-	wg := &sync.WaitGroup{}
+	events.subscribe(crashes.keep)
+	if *eventsOut != "" {
+		sink, closeSink, err := newEventFileSink(*eventsOut)
+		if err != nil {
+			log.Fatal().Timestamp().Err(err).Str("events_out", *eventsOut).Msg("Failed to open events file")
+		}
+		defer closeSink()
+		events.subscribe(sink)
+	}
 
-	log.Info().Timestamp().Str("url", *targetURL).Msg("Sending requests to target")
+	if *phasesOut != "" || *traceMarker {
+		phases, err = newPhaseRecorder(*traceMarker)
+		if err != nil {
+			log.Fatal().Timestamp().Err(err).Msg("Failed to open trace marker")
+		}
+	}
+
+	runInfo = newRunMetadata(time.Now())
+	if *manifestOut != "" {
+		if err := writeManifest(*manifestOut, runInfo); err != nil {
+			log.Fatal().Timestamp().Err(err).Str("manifest_out", *manifestOut).Msg("Failed to write manifest")
+		}
+	}
+
+	if *baselineRequests > 0 {
+		setPhase("baseline")
+		stats.baseline, err = measureBaseline(ctx, *baselineRequests)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Fatal().Timestamp().Err(err).Str("url", *targetURL).Msg("Target failed the health pre-check")
+		}
+		b := stats.baseline
+		evt := log.Info()
+		if b.Failures > 0 {
+			evt = log.Warn()
+		}
+		evt.Timestamp().Int("requests", b.Requests).Int("failures", b.Failures).Dur("p50", b.Latency.P50).Dur("p90", b.Latency.P90).Dur("max", b.Latency.Max).Msg("Measured baseline latency")
+	}
+
+	log.Info().Timestamp().Str("url", *targetURL).Str("run_id", runInfo.RunID).Int64("seed", *seed).Msg("Sending requests to target")
+	if *startingTimeoutSeconds > 0 {
+		setPhase("countdown")
+	}
 	for i := *startingTimeoutSeconds; i > 0; i-- {
 		log.Info().Timestamp().Msg(fmt.Sprintf("Starting execution in %d second(s)", i))
-		time.Sleep(time.Second)
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			log.Info().Timestamp().Msg("Interrupted before the run started")
+			return
+		}
+	}
+
+	// exec_time, warm-up and the statistics all count from here, after the
+	// countdown
+	measureFrom := time.Now().Add(*warmup)
+	timingFrom = measureFrom
+	if *executionTime != 0 {
+		// cancel still ends the run early, as it cancels the parent
+		stats.deadline = measureFrom.Add(*executionTime)
+		var stopAtDeadline context.CancelFunc
+		ctx, stopAtDeadline = context.WithDeadline(ctx, stats.deadline)
+		defer stopAtDeadline()
+	}
+	events.emit(eventRunStarted, map[string]any{"run": runInfo, "url": *targetURL, "max_goroutines": *maxGoroutines, "warmup": warmup.String(), "exec_time": executionTime.String(), "requests": *totalRequests})
+	if *warmup > 0 {
+		log.Info().Timestamp().Dur("warmup", *warmup).Msg("Warming up, requests are not counted until warm-up ends")
+		setPhase("warmup")
+		time.AfterFunc(*warmup, func() {
+			if ctx.Err() != nil {
+				return
+			}
+			if stats.stages != nil {
+				setPhaseAt("stage:"+stats.stages.stages[0].name, measureFrom)
+			} else {
+				setPhaseAt("running", measureFrom)
+			}
+		})
+	} else if stats.stages == nil {
+		setPhase("running")
+	}
+	if stats.stages != nil {
+		stats.stages.start(measureFrom)
+		// applies the load of the first stage before any request is sent,
+		// including those of warm-up
+		stats.stages.advance(time.Now())
+		go stats.stages.watch(ctx, cancel)
+	}
+	if stats.breaker != nil {
+		go stats.breaker.watch(ctx, cancel)
+	}
+	if stats.auto != nil {
+		go stats.auto.run(ctx, cancel, *autoStartRPS, measureFrom)
+	}
+	go stats.generator.run(ctx)
+
+	var probe *healthProbe
+	if *probeURL != "" {
+		probe = newHealthProbe(*probeURL, *probeInterval, *requestTimeout)
+		go probe.run(ctx)
+		log.Info().Timestamp().Str("probe_url", *probeURL).Dur("probe_interval", *probeInterval).Msg("Polling health probe")
+	}
+
+	if *timeseriesOut != "" {
+		stats.series = newTimeSeries(measureFrom, stats.budget, probe)
+	}
+	if len(variants) > 0 {
+		stats.rolling = metrics.NewRolling(*rollingWindow)
+		variantRolling = stats.rolling
+	}
+
+	var statusWriter *statusFileWriter
+	if *statusFile != "" {
+		statusWriter = newStatusFileWriter(ctx, *statusFile, stats, measureFrom)
+		go statusWriter.run()
+	}
+	if *intervalOut != "" {
+		stats.intervals, err = newIntervalWriter(ctx, *intervalOut, *intervalLength, stats, measureFrom)
+		if err != nil {
+			log.Fatal().Timestamp().Err(err).Str("interval_out", *intervalOut).Msg("Failed to open interval output")
+		}
+		go stats.intervals.run()
+	}
+	if *resultsOut != "" {
+		stats.results, err = newResultWriter(*resultsOut, *resultsFormat)
+		if err != nil {
+			log.Fatal().Timestamp().Err(err).Str("results_out", *resultsOut).Msg("Failed to open results output")
+		}
+	}
+
+	if *controlAddr != "" {
+		token, err := readControlToken(*controlTokenFile)
+		if err != nil {
+			log.Fatal().Timestamp().Err(err).Msg("Failed to read control token")
+		}
+		server := newControlServer(ctx, *controlAddr, token, stats, measureFrom)
+		if err := server.start(); err != nil {
+			log.Fatal().Timestamp().Err(err).Str("control_addr", *controlAddr).Msg("Failed to start control API")
+		}
+		defer server.stop()
+		log.Info().Timestamp().Str("control_addr", server.server.Addr).Msg("Control API listening")
+	}
+	if *controlStdin || *controlSocket != "" {
+		con := &console{ctx: ctx, stats: stats, measureFrom: measureFrom, users: len(users)}
+		if *controlStdin {
+			go con.serve(os.Stdin, os.Stderr)
+		}
+		if *controlSocket != "" {
+			ln, err := net.Listen("unix", *controlSocket)
+			if err != nil {
+				log.Fatal().Timestamp().Err(err).Str("control_socket", *controlSocket).Msg("Failed to listen on control socket")
+			}
+			defer ln.Close()
+			go con.accept(ln)
+			log.Info().Timestamp().Str("control_socket", *controlSocket).Msg("Control socket listening")
+		}
 	}
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
 	go func() {
 		for {
 			select {
+			case <-hup:
+				reportProgress(stats, measureFrom, "SIGHUP")
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
-			default:
-				if limiter != nil {
-					log.Debug().Timestamp().Err(limiter.Wait(ctx)).Send()
+	go func() {
+		defer close(aggregated)
+		aggregate(respChan, stopAggregating, stats, cancel)
+	}()
+	for _, vu := range users {
+		go vu.run(reqCtx, tickets, respChan, inflight)
+	}
+
+	// the dispatch loop only blocks on the pacing, the limiter and free
+	// slots, all of which give up once ctx is cancelled
+	go func() {
+		defer close(loopDone)
+		defer crashes.handlePanic("dispatch", func(error) { cancel() })
+		// intended is the time the current request was scheduled for, if the
+		// launches follow a schedule
+		var intended time.Time
+		var err error
+		launch := func() {
+			t := ticket{warm: time.Now().Before(measureFrom), intended: intended}
+			if !t.warm {
+				atomic.AddInt64(&stats.attempted, 1)
+			}
+			inflight.Add(1)
+			go sendRequest(reqCtx, sem, respChan, inflight, t)
+		}
+		for ctx.Err() == nil {
+			resumed := control.pausedChan()
+			if resumed != nil || (*totalRequests > 0 && atomic.LoadInt64(&stats.attempted) >= *totalRequests) {
+				select {
+				case <-resumed:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			if limiter != nil {
+				log.Debug().Timestamp().Err(limiter.Wait(ctx)).Send()
+			}
+			if delayPacer != nil {
+				if intended, err = delayPacer.wait(ctx); err != nil {
+					return
 				}
+			} else if *replayTiming {
+				if intended, err = replay.wait(ctx); err != nil {
+					return
+				}
+			} else if *delayJitter > 0 {
 				select {
-				case sem <- struct{}{}:
-					go sendRequest(ctx, sem, respChan, *requestTimeout, allowedHTTPMethods)
+				case <-time.After(time.Duration(rng.Int64N(int64(*delayJitter)))):
 				case <-ctx.Done():
 					return
 				}
-
-			case res := <-respChan:
-				wg.Add(1)
-				go processResponse(res, &errCount, &sentRequestCount, &totalDuration, wg)
-
-			case <-executionTimer.C:
-				if *executionTime != 0 {
-					log.Debug().Timestamp().Msg("ExecutionTime reached, shutting down...")
-					cancel()
+			}
+			if users != nil {
+				t := ticket{warm: time.Now().Before(measureFrom), intended: intended}
+				inflight.Add(1)
+				select {
+				case tickets <- t:
+					if !t.warm {
+						atomic.AddInt64(&stats.attempted, 1)
+					}
+				case <-ctx.Done():
+					inflight.Done()
+					return
 				}
-
+				continue
+			}
+			if *workload == "open" {
+				select {
+				case sem <- struct{}{}:
+					launch()
+				default:
+					// the arrival is missed rather than delaying the schedule
+					if !time.Now().Before(measureFrom) {
+						atomic.AddInt64(&stats.dropped, 1)
+					}
+				}
+				continue
+			}
+			select {
+			case sem <- struct{}{}:
+				launch()
 			case <-ctx.Done():
 				return
 			}
@@ -164,24 +1013,376 @@ func main() {
 	}()
 
 	<-ctx.Done()
-	wg.Wait()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Debug().Timestamp().Msg("ExecutionTime reached, shutting down...")
+	}
+	setPhase("draining")
+	<-loopDone
+
+	inflightDone := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(inflightDone)
+	}()
+	drainTimer := time.NewTimer(*drainTimeout)
+
+	select {
+	case <-inflightDone:
+	case <-drainTimer.C:
+		log.Warn().Timestamp().Dur("drain_timeout", *drainTimeout).Msg("Drain timeout reached, dropping in-flight requests")
+	}
+	close(stopAggregating)
+	<-aggregated
+	cancelRequests()
+	if *timingBreakdown {
+		// finishes the last exchange on every keep-alive connection
+		client.CloseIdleConnections()
+	}
+
+	runDuration := time.Since(measureFrom)
+	summary := stats.snapshot(runDuration)
+	if statusWriter != nil {
+		statusWriter.stop(summary)
+	}
+	if stats.intervals != nil {
+		stats.intervals.stop()
+	}
+	if stats.results != nil {
+		if err := stats.results.close(); err != nil {
+			log.Error().Timestamp().Err(err).Str("results_out", *resultsOut).Msg("Failed to write results")
+		}
+	}
+
+	log.Info().Timestamp().Int64("sent_requests", summary.SentRequests).Int64("errors", summary.Errors).Float64("average_request_duration", summary.AverageRequestDuration).Float64("requests_per_second", summary.RequestsPerSecond).Int64("bytes_received", summary.BytesReceived).Float64("average_response_size", summary.AverageResponseSize).Float64("throughput_mb_per_second", summary.ThroughputMBps).Msg("Network throughput testing finished")
+	ended := map[string]any{"sent_requests": summary.SentRequests, "errors": summary.Errors, "average_request_duration": summary.AverageRequestDuration, "requests_per_second": summary.RequestsPerSecond, "bytes_received": summary.BytesReceived, "throughput_mb_per_second": summary.ThroughputMBps}
+	if summary.ErrorBudget != nil {
+		ended["error_budget"] = summary.ErrorBudget
+	}
+	if summary.SLOs != nil {
+		ended["slos"] = summary.SLOs
+	}
+	ended["attempted_requests"] = summary.AttemptedRequests
+	ended["recorded_requests"] = summary.RecordedRequests
+	ended["unsent_requests"] = summary.UnsentRequests
+	ended["completed_requests"] = summary.CompletedRequests
+	if summary.InFlightRequests > 0 {
+		ended["abandoned_requests"] = summary.InFlightRequests
+	}
+	if summary.DroppedArrivals > 0 {
+		ended["dropped_arrivals"] = summary.DroppedArrivals
+	}
+	if summary.Latency != nil {
+		ended["latency"] = summary.Latency
+	}
+	if summary.CorrectedLatency != nil {
+		ended["corrected_latency"] = summary.CorrectedLatency
+	}
+	if summary.Baseline != nil {
+		ended["baseline"] = summary.Baseline
+	}
+	if *compression != "" {
+		ended["bytes_decompressed"] = summary.BytesDecompressed
+	}
+	events.emit(eventRunEnded, ended)
+
+	log.Info().Timestamp().Int64("attempted_requests", summary.AttemptedRequests).Int64("recorded_requests", summary.RecordedRequests).Int64("unsent_requests", summary.UnsentRequests).Int64("completed_requests", summary.CompletedRequests).Msg("Request accounting")
+	if summary.InFlightRequests > 0 {
+		log.Warn().Timestamp().Int64("abandoned_requests", summary.InFlightRequests).Dur("drain_timeout", *drainTimeout).Msg("Requests still in flight at shutdown were not counted")
+	}
+
+	if summary.DroppedArrivals > 0 {
+		log.Warn().Timestamp().Int64("dropped_arrivals", summary.DroppedArrivals).Int("max_goroutines", *maxGoroutines).Msg("Open workload dropped arrivals because max_goroutines requests were in flight")
+	}
+
+	if l, c := summary.Latency, summary.CorrectedLatency; c != nil {
+		log.Info().Timestamp().Dur("p50", l.P50).Dur("p90", l.P90).Dur("p99", l.P99).Dur("max", l.Max).Dur("corrected_p50", c.P50).Dur("corrected_p90", c.P90).Dur("corrected_p99", c.P99).Dur("corrected_max", c.Max).Msg("Latency percentiles")
+	}
+
+	if b, l := summary.Baseline, summary.Latency; b != nil && b.Latency.P50 > 0 {
+		log.Info().Timestamp().Dur("baseline_p50", b.Latency.P50).Dur("p50", l.P50).Float64("p50_ratio", float64(l.P50)/float64(b.Latency.P50)).Dur("baseline_p90", b.Latency.P90).Dur("p90", l.P90).Float64("p90_ratio", float64(l.P90)/float64(b.Latency.P90)).Msg("Latency compared to baseline")
+	}
+
+	if stats.auto != nil {
+		stats.auto.report()
+	}
+
+	stats.generator.report()
+
+	if *compression != "" {
+		ratio := 0.0
+		if summary.BytesReceived > 0 {
+			ratio = float64(summary.BytesDecompressed) / float64(summary.BytesReceived)
+		}
+		log.Info().Timestamp().Int64("compressed_responses", summary.CompressedResponses).Int64("bytes_received", summary.BytesReceived).Int64("bytes_decompressed", summary.BytesDecompressed).Float64("compression_ratio", ratio).Msg("Compression summary")
+	}
 
-	var avgDuration float64
-	if sentRequestCount > 0 {
-		avgDuration = float64(totalDuration) / float64(sentRequestCount)
+	if retry != nil {
+		log.Info().Timestamp().Int64("first_attempt_failures", summary.FirstAttemptFailures).Int64("retries", summary.Retries).Int64("recovered_requests", summary.RecoveredRequests).Msg("Retry summary")
 	}
-	rps := float64(sentRequestCount) / time.Since(startedAt).Seconds()
 
-	log.Info().Timestamp().Int64("sent_requests", sentRequestCount).Int64("errors", errCount).Float64("average_request_duration", avgDuration).Float64("requests_per_second", rps).Msg("Network throughput testing finished")
+	if probe != nil {
+		ps := probe.summary(measureFrom)
+		evt := log.Info()
+		if ps.failures > 0 {
+			evt = log.Warn().Dur("first_failure_after", ps.firstFailure)
+		}
+		evt.Timestamp().Str("probe_url", *probeURL).Int("probes", ps.probes).Int("failures", ps.failures).Dur("average_latency", ps.avgLatency).Dur("max_latency", ps.maxLatency).Msg("Health probe summary")
+	}
+
+	if summary.ErrorBudget != nil {
+		log.Info().Timestamp().Float64("slo_target", *sloTarget).Dur("slo_latency", *sloLatency).Int64("bad_requests", summary.ErrorBudget.BadRequests).Float64("burn_rate", summary.ErrorBudget.BurnRate).Float64("budget_remaining", summary.ErrorBudget.BudgetRemaining).Msg("Error budget summary")
+	}
+	for _, slo := range summary.SLOs {
+		evt := log.Info()
+		if !slo.Met {
+			evt = log.Warn()
+		}
+		evt.Timestamp().Str("slo", slo.Name).Float64("target", slo.Target).Float64("compliance", slo.Compliance).Bool("met", slo.Met).Int64("requests", slo.Requests).Int64("bad_requests", slo.BadRequests).Float64("burn_rate", slo.BurnRate).Float64("budget_remaining", slo.BudgetRemaining).Msg("SLO summary")
+	}
+
+	if stats.stages != nil {
+		stats.stages.finish(time.Now())
+		runFailed = stats.stages.report()
+	}
+	if stats.breaker != nil && stats.breaker.tripped.Load() {
+		runFailed = true
+	}
+
+	if stats.series != nil {
+		if err := writeTimeSeries(stats.series, *timeseriesOut, *timeseriesFormat); err != nil {
+			log.Error().Timestamp().Err(err).Str("timeseries_out", *timeseriesOut).Msg("Failed to write time series")
+		}
+	}
+
+	if teardown != nil && len(teardown.Steps) > 0 {
+		setPhase("teardown")
+		teardownCtx, stopTeardown := signal.NotifyContext(context.Background(), os.Interrupt)
+		runTeardown(teardownCtx, teardown.Steps, time.Duration(teardown.Delay), *requestTimeout)
+		stopTeardown()
+	}
+
+	phases.finish()
+	if *phasesOut != "" {
+		if err := phases.write(*phasesOut); err != nil {
+			log.Error().Timestamp().Err(err).Str("phases_out", *phasesOut).Msg("Failed to write phases")
+		}
+	}
+
+	if v4, v6 := addressFamilies.totals(); v4+v6 > 0 {
+		log.Info().Timestamp().Int64("ipv4_connections", v4).Int64("ipv6_connections", v6).Msg("Address families used")
+	}
+
+	if failoverDialer != nil {
+		log.Info().Timestamp().Int64("failovers", failoverDialer.Failovers()).Msg("DNS failover summary")
+	}
+
+	commandStats.each(func(command string, count int64, avgDuration float64) {
+		log.Info().Timestamp().Str("command", command).Int64("count", count).Float64("average_duration", avgDuration).Msg("Command latency")
+	})
+	variantStats.each(func(variant string, count int64, avgDuration float64) {
+		log.Info().Timestamp().Str("variant", variant).Int64("count", count).Float64("average_duration", avgDuration).Msg("Variant usage")
+	})
+	methodStats.each(func(method string, count int64, avgDuration float64) {
+		log.Info().Timestamp().Str("method", method).Int64("count", count).Float64("average_duration", avgDuration).Msg("Method usage")
+	})
+	if stats.endpoints != nil {
+		for _, ep := range stats.endpoints.summaries() {
+			log.Info().Timestamp().Str("endpoint", ep.Endpoint).Int64("requests", ep.Requests).Int64("errors", ep.Errors).Int64("non_2xx", ep.Non2xx).Dur("p50", ep.Latency.P50).Dur("p99", ep.Latency.P99).Msg("Endpoint statistics")
+		}
+	}
+	stats.errorTypes.each(func(class string, count int64, avgDuration float64) {
+		log.Info().Timestamp().Str("type", class).Int64("count", count).Float64("average_duration", avgDuration).Msg("Error breakdown")
+	})
+	phaseStats.each(func(phase string, count int64, avgDuration float64) {
+		log.Info().Timestamp().Str("phase", phase).Int64("count", count).Float64("average_duration", avgDuration).Msg("Request phase timing")
+	})
+	redirectStats.each(func(hop string, count int64, avgDuration float64) {
+		log.Info().Timestamp().Str("hop", hop).Int64("count", count).Float64("average_duration", avgDuration).Msg("Redirect hop latency")
+	})
+	if n := crashes.count(); n > 0 {
+		log.Warn().Timestamp().Int("panics", n).Str("crash_dir", *crashDir).Msg("Recovered from panics during the run, see crash reports")
+	}
+
+	if *summaryFormat != "" {
+		sum := runSummary{Run: runInfo, URL: *targetURL, DurationSeconds: runDuration.Seconds(), Failed: runFailed, statsSnapshot: summary}
+		if err := writeSummary(os.Stdout, *summaryFormat, sum); err != nil {
+			log.Error().Timestamp().Err(err).Msg("Failed to write summary")
+		}
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// clampConcurrency raises the soft open files limit as far as the run needs
+// and the hard limit allows, then lowers max_goroutines and
+// max_conns_per_host to what the file descriptor limit and ephemeral port
+// range allow, so a run doesn't start failing with "too many open files"
+// halfway through.
+func clampConcurrency() {
+	l := limits.Detect()
+	if need := limits.OpenFilesFor(max(*maxGoroutines, *maxConnsPerHost)); l.OpenFiles > 0 && need > l.OpenFiles {
+		if err := limits.RaiseOpenFiles(need); err != nil {
+			log.Warn().Timestamp().Err(err).Uint64("open_files_limit", l.OpenFiles).Uint64("needed", need).Msg("Failed to raise the open files limit")
+		} else {
+			raised := limits.Detect()
+			log.Info().Timestamp().Uint64("from", l.OpenFiles).Uint64("to", raised.OpenFiles).Uint64("needed", need).Msg("Raised the open files limit")
+			l = raised
+		}
+	}
+	log.Debug().Timestamp().Uint64("open_files_limit", l.OpenFiles).Uint64("open_files_hard_limit", l.OpenFilesMax).Int("ephemeral_ports", l.EphemeralPorts).Msg("Detected process limits")
+	safe := l.MaxConnections()
+	if safe == 0 {
+		return
+	}
+	if *maxGoroutines > safe {
+		log.Warn().Timestamp().Int("max_goroutines", *maxGoroutines).Int("clamped_to", safe).Uint64("open_files_limit", l.OpenFiles).Uint64("open_files_hard_limit", l.OpenFilesMax).Int("ephemeral_ports", l.EphemeralPorts).Msg("max_goroutines exceeds what the file descriptor limit and port range allow, clamping (raise the hard limit, ulimit -Hn, to go higher)")
+		*maxGoroutines = safe
+	}
+	if *maxConnsPerHost > safe {
+		log.Warn().Timestamp().Int("max_conns_per_host", *maxConnsPerHost).Int("clamped_to", safe).Msg("max_conns_per_host exceeds what the file descriptor limit and port range allow, clamping")
+		*maxConnsPerHost = safe
+	}
+}
+
+func configureClient(c *fasthttp.Client) {
+	c.MaxConnsPerHost = *maxConnsPerHost
+	if c.MaxConnsPerHost == 0 {
+		c.MaxConnsPerHost = max(fasthttp.DefaultMaxConnsPerHost, *maxGoroutines)
+	}
+	c.MaxIdleConnDuration = *maxIdleConnDuration
+	c.ReadBufferSize = *readBufferSize
+	c.WriteBufferSize = *writeBufferSize
+	c.TLSConfig = targetTLS.Clone()
+	if *readTimeout > 0 {
+		c.ReadTimeout = *readTimeout
+	}
+	if *writeTimeout > 0 {
+		c.WriteTimeout = *writeTimeout
+	}
+}
+
+func writeTimeSeries(series *timeSeries, path, format string) error {
+	if path == "-" {
+		return series.write(os.Stdout, format)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := series.write(file, format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func loadConfig(path string) error {
+	values, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	// sections are removed from values below as they are decoded
+	configValues = maps.Clone(values)
+
+	var td teardownConfig
+	if ok, err := config.Section(values, "teardown", &td); err != nil {
+		return err
+	} else if ok {
+		for i := range td.Steps {
+			step := &td.Steps[i]
+			if step.URL == "" {
+				return fmt.Errorf("teardown: step %q has no url", step.label())
+			}
+			if err := step.compile(); err != nil {
+				return fmt.Errorf("teardown: step %q: %w", step.label(), err)
+			}
+		}
+		teardown = &td
+	}
+
+	if _, err := config.Section(values, "scenario", &scenarioSteps); err != nil {
+		return err
+	}
+
+	if _, err := config.Section(values, "variants", &variants); err != nil {
+		return err
+	}
+	for i := range variants {
+		if err := variants[i].compile(i); err != nil {
+			return fmt.Errorf("variants: %w", err)
+		}
+	}
+
+	var methods map[string]*requestSpec
+	if _, err := config.Section(values, "methods", &methods); err != nil {
+		return err
+	}
+	if methodRequests, err = compileMethodRequests(methods); err != nil {
+		return err
+	}
+
+	if _, err := config.Section(values, "stages", &stageConfigs); err != nil {
+		return err
+	}
+	if _, err := config.Section(values, "thresholds", &thresholdConfigs); err != nil {
+		return err
+	}
+	if _, err := config.Section(values, "slos", &sloConfigs); err != nil {
+		return err
+	}
+
+	return config.ApplyFlags(flag.CommandLine, values)
 }
 
 type Result struct {
 	status   int
 	err      error
 	duration time.Duration
+	commands []mail.Timing
+	warmup   bool
+	variant  string
+	// endpoint is the endpoint or scenario step of a replayed request.
+	endpoint string
+	// method is set if it was picked by -method_mix.
+	method string
+	// decompressed is the response size after decompression, set with
+	// -compression.
+	decompressed int64
+	compressed   bool
+	hops         []time.Duration
+	bytes        int64
+	retries      int
+	// firstFailed is set if the first attempt failed under -retries.
+	firstFailed bool
+	// received is set if a response arrived, even if a hook, extraction,
+	// decompression or schema validation failed the request afterwards.
+	received bool
+	// corrected is the latency from the time the request was scheduled for,
+	// set if launches follow a schedule.
+	corrected time.Duration
 }
 
-func sendRequest(ctx context.Context, sem <-chan struct{}, respChan chan<- *Result, requestTimeout time.Duration, allowedHTTPMethods []string) {
+var resultPool = sync.Pool{New: func() any { return new(Result) }}
+
+// acquireResult returns an empty Result from a pool. Results of the load are
+// released once they were recorded, which saves an allocation per request at
+// high rates.
+func acquireResult() *Result {
+	return resultPool.Get().(*Result)
+}
+
+func releaseResult(res *Result) {
+	*res = Result{}
+	resultPool.Put(res)
+}
+
+func sendRequest(ctx context.Context, sem <-chan struct{}, respChan chan<- *Result, inflight *sync.WaitGroup, t ticket) {
+	defer inflight.Done()
 	defer func() {
 		select {
 		case <-sem:
@@ -190,50 +1391,131 @@ func sendRequest(ctx context.Context, sem <-chan struct{}, respChan chan<- *Resu
 		}
 	}()
 
-	start := time.Now()
-	req := fasthttp.AcquireRequest()
-	req.SetRequestURI(*targetURL)
-	if *randomMethod {
-		randomHTTPMethod := allowedHTTPMethods[rand.Intn(len(allowedHTTPMethods))]
-		req.Header.SetMethod(randomHTTPMethod)
-	} else {
-		req.Header.SetMethod(*method)
-	}
+	res := doRecovered(ctx, nil)
+	t.stamp(res)
 
-	if len(userAgentList) > 0 {
-		randomUserAgent := userAgentList[rand.Intn(len(userAgentList))]
-		req.Header.SetUserAgent(randomUserAgent)
-	} else if *userAgent != "" {
-		req.Header.SetUserAgent(*userAgent)
+	select {
+	case respChan <- res:
+	case <-ctx.Done():
+		releaseResult(res)
 	}
+}
 
-	resp := fasthttp.AcquireResponse()
-	err := client.DoTimeout(req, resp, requestTimeout)
-
-	res := &Result{
-		status:   resp.StatusCode(),
-		duration: time.Since(start),
-		err:      err,
+// aggregate records results one at a time as they arrive, so that no
+// goroutine is started per response, until stop is closed. Results already
+// waiting in respChan are then recorded as well.
+func aggregate(respChan <-chan *Result, stop <-chan struct{}, stats *runStats, cancel context.CancelFunc) {
+	for {
+		select {
+		case res := <-respChan:
+			processResponse(res, stats, cancel)
+			releaseResult(res)
+		case <-stop:
+			for len(respChan) > 0 {
+				res := <-respChan
+				processResponse(res, stats, cancel)
+				releaseResult(res)
+			}
+			return
+		}
 	}
+}
 
-	fasthttp.ReleaseRequest(req)
-	fasthttp.ReleaseResponse(resp)
+func processResponse(res *Result, stats *runStats, cancel context.CancelFunc) {
+	defer crashes.handlePanic("response", func(error) {
+		// a panic while handling a successful response still counts against the run
+		if res.err == nil && !res.warmup {
+			atomic.AddInt64(&stats.errors, 1)
+			stats.errorTypes.add("panic", res.duration)
+		}
+	})
 
-	select {
-	case respChan <- res:
-	case <-ctx.Done():
+	if res.warmup {
+		log.Debug().Timestamp().Err(res.err).Int("status", res.status).Dur("duration", res.duration).Msg("Warm-up request")
+		return
 	}
-}
 
-func processResponse(res *Result, errCount, sentRequestsCount, totalDuration *int64, wg *sync.WaitGroup) {
-	defer wg.Done()
+	// counted first, so that a panic below can't keep -requests from being reached
+	if n := atomic.AddInt64(&stats.recorded, 1); *totalRequests > 0 && n == *totalRequests {
+		log.Debug().Timestamp().Msg("Request limit reached, shutting down...")
+		cancel()
+	}
 
 	if res.err != nil {
-		atomic.AddInt64(errCount, 1)
+		atomic.AddInt64(&stats.errors, 1)
+		stats.generator.recordError(res.err)
 		log.Debug().Timestamp().Err(res.err).Send()
 	}
-
-	atomic.AddInt64(sentRequestsCount, 1)
-	atomic.AddInt64(totalDuration, int64(res.duration))
+	if res.received {
+		atomic.AddInt64(&stats.completed, 1)
+	}
+	if class := errorClass(res); class != "" {
+		stats.errorTypes.add(class, res.duration)
+		if slices.Contains(unsentClasses, class) {
+			atomic.AddInt64(&stats.unsent, 1)
+		}
+	}
+	atomic.AddInt64(&stats.totalDuration, int64(res.duration))
+	if stats.latency != nil {
+		stats.latency.Record(res.duration)
+	}
+	if stats.corrected != nil {
+		stats.corrected.Record(max(res.corrected, res.duration))
+	}
+	atomic.AddInt64(&stats.bytes, res.bytes)
+	atomic.AddInt64(&stats.decompressed, res.decompressed)
+	if res.compressed {
+		atomic.AddInt64(&stats.compressed, 1)
+	}
+	if res.firstFailed {
+		atomic.AddInt64(&stats.firstFailures, 1)
+		atomic.AddInt64(&stats.retries, int64(res.retries))
+		if res.err == nil && !retry.shouldRetry(res.status, nil) {
+			atomic.AddInt64(&stats.recovered, 1)
+		}
+	}
+	if stats.series != nil {
+		stats.series.add(time.Now(), res)
+	}
+	if stats.intervals != nil {
+		stats.intervals.record(res)
+	}
+	if stats.results != nil {
+		stats.results.write(res, time.Now())
+	}
+	if stats.rolling != nil {
+		stats.rolling.Record(time.Now(), res.duration, res.err != nil)
+	}
+	if stats.stages != nil {
+		stats.stages.record(time.Now(), res)
+	}
+	if stats.breaker != nil {
+		stats.breaker.record(time.Now(), res)
+	}
+	if stats.auto != nil {
+		stats.auto.record(res)
+	}
+	if stats.budget != nil {
+		stats.budget.add(res)
+	}
+	for _, l := range stats.slos {
+		l.add(res)
+	}
+	if stats.endpoints != nil && res.endpoint != "" {
+		stats.endpoints.record(res.endpoint, res.status, res.err != nil, res.duration)
+	}
 	log.Debug().Timestamp().Int("status", res.status).Dur("duration", res.duration).Send()
+
+	for _, t := range res.commands {
+		commandStats.add(t.Command, t.Duration)
+	}
+	if res.variant != "" {
+		variantStats.add(res.variant, res.duration)
+	}
+	if res.method != "" {
+		methodStats.add(res.method, res.duration)
+	}
+	for i, d := range res.hops {
+		redirectStats.add(fmt.Sprintf("hop %d", i), d)
+	}
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"dos/internal/util"
+	"encoding/json"
+	"flag"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// runMetadata identifies a run. It is written to the manifest and attached
+// to the results, so results can be traced back to how they were produced.
+type runMetadata struct {
+	RunID      string    `json:"run_id"`
+	Seed       int64     `json:"seed"`
+	Version    string    `json:"version"`
+	Revision   string    `json:"revision,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	ConfigHash string    `json:"config_hash"`
+	Host       hostInfo  `json:"host"`
+}
+
+type hostInfo struct {
+	Hostname  string `json:"hostname"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	CPUs      int    `json:"cpus"`
+	GoVersion string `json:"go_version"`
+}
+
+// runManifest is runMetadata plus the effective configuration: every flag
+// value after the config file and adjustments such as -vus were applied,
+// and the config file with includes and references resolved.
+type runManifest struct {
+	runMetadata
+	Flags  map[string]string `json:"flags"`
+	Config map[string]any    `json:"config,omitempty"`
+}
+
+var (
+	runInfo *runMetadata
+	// configValues is the resolved -config file.
+	configValues map[string]any
+)
+
+func newRunMetadata(startedAt time.Time) *runMetadata {
+	hostname, _ := os.Hostname()
+	meta := &runMetadata{
+		// not drawn from rng, so runs repeated with -seed still get their
+		// own id
+		RunID:      newUUID(rand.Uint64(), rand.Uint64()),
+		Seed:       *seed,
+		Version:    version,
+		StartedAt:  startedAt,
+		ConfigHash: configHash(),
+		Host: hostInfo{
+			Hostname:  hostname,
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+			CPUs:      runtime.NumCPU(),
+			GoVersion: runtime.Version(),
+		},
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				meta.Revision = s.Value
+			}
+		}
+	}
+	return meta
+}
+
+func writeManifest(path string, meta *runMetadata) error {
+	m := runManifest{runMetadata: *meta, Flags: map[string]string{}, Config: configValues}
+	flag.VisitAll(func(f *flag.Flag) {
+		m.Flags[f.Name] = f.Value.String()
+	})
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, data)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// weightedMethods picks the method of every request by weight, e.g. GET:80,POST:20
+// sends four GETs for every POST.
+type weightedMethods struct {
+	methods []string
+	// cumulative holds the running sum of the weights.
+	cumulative []int
+}
+
+var (
+	mix *weightedMethods
+	// methodRequests are the overrides of the methods section of the config
+	// file, such as the body sent with POST.
+	methodRequests map[string]*requestSpec
+	methodStats    = newNamedStats()
+)
+
+func parseMethodMix(s string) (*weightedMethods, error) {
+	m := &weightedMethods{}
+	total := 0
+	for _, part := range strings.Split(s, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("%q: expected METHOD:weight", part)
+		}
+		name = strings.ToUpper(name)
+		if !slices.Contains(allowedHTTPMethods, name) {
+			return nil, fmt.Errorf("%q: invalid HTTP method", part)
+		}
+		if slices.Contains(m.methods, name) {
+			return nil, fmt.Errorf("%s is listed twice", name)
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 1 {
+			return nil, fmt.Errorf("%q: weight must be a positive integer", part)
+		}
+		total += w
+		m.methods = append(m.methods, name)
+		m.cumulative = append(m.cumulative, total)
+	}
+	return m, nil
+}
+
+func (m *weightedMethods) pick() string {
+	n := rng.IntN(m.cumulative[len(m.cumulative)-1])
+	i, _ := slices.BinarySearch(m.cumulative, n+1)
+	return m.methods[i]
+}
+
+// compileMethodRequests parses the placeholders of the methods section and
+// keys it by upper-case method.
+func compileMethodRequests(specs map[string]*requestSpec) (map[string]*requestSpec, error) {
+	compiled := make(map[string]*requestSpec, len(specs))
+	for name, spec := range specs {
+		name = strings.ToUpper(name)
+		if spec.Method != "" {
+			return nil, fmt.Errorf("methods: %s: method can't be overridden", name)
+		}
+		if err := spec.compile(); err != nil {
+			return nil, fmt.Errorf("methods: %s: %w", name, err)
+		}
+		compiled[name] = spec
+	}
+	return compiled, nil
+}
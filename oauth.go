@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// oauthRetryDelay is how long a failed token refresh waits before trying
+// again.
+const oauthRetryDelay = 5 * time.Second
+
+// oauthClient gets an access token with the OAuth2 client credentials grant
+// and sets it as the Bearer token of every request. The token is refreshed
+// before it expires, so that runs longer than its lifetime stay authorized.
+type oauthClient struct {
+	tokenURL   string
+	clientID   string
+	secret     string
+	scope      string
+	postSecret bool
+	before     time.Duration
+	timeout    time.Duration
+	client     *fasthttp.Client
+
+	// authorization is the Authorization header value, replaced on refresh
+	// while workers read it.
+	authorization atomic.Pointer[string]
+}
+
+// oauth is set up from the -oauth_* flags.
+var oauth *oauthClient
+
+func newOAuthClient(tokenURL, clientID, secretFile, scope, clientAuth string, before, timeout time.Duration) (*oauthClient, error) {
+	u, err := url.Parse(tokenURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http or https URL", tokenURL)
+	}
+	if clientID == "" {
+		return nil, errors.New("oauth_client_id is required")
+	}
+	if secretFile == "" {
+		return nil, errors.New("oauth_client_secret_file is required")
+	}
+	secret, err := os.ReadFile(secretFile)
+	if err != nil {
+		return nil, err
+	}
+	if clientAuth != "basic" && clientAuth != "post" {
+		return nil, fmt.Errorf("unknown client authentication %q (basic, post)", clientAuth)
+	}
+	return &oauthClient{
+		tokenURL:   tokenURL,
+		clientID:   clientID,
+		secret:     string(bytes.TrimRight(secret, "\r\n")),
+		scope:      scope,
+		postSecret: clientAuth == "post",
+		before:     before,
+		timeout:    timeout,
+		client:     &fasthttp.Client{TLSConfig: targetTLS.Clone(), Dial: targetDial()},
+	}, nil
+}
+
+func (o *oauthClient) sign(req *fasthttp.Request) {
+	if authorization := o.authorization.Load(); authorization != nil {
+		req.Header.Set(fasthttp.HeaderAuthorization, *authorization)
+	}
+}
+
+// refresh requests a new token and returns its lifetime, 0 if the server
+// didn't tell.
+func (o *oauthClient) refresh() (time.Duration, error) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	form := &fasthttp.Args{}
+	form.Set("grant_type", "client_credentials")
+	if o.scope != "" {
+		form.Set("scope", o.scope)
+	}
+	if o.postSecret {
+		form.Set("client_id", o.clientID)
+		form.Set("client_secret", o.secret)
+	} else {
+		// RFC 6749 section 2.3.1 form-encodes both before the basic scheme
+		credentials := url.QueryEscape(o.clientID) + ":" + url.QueryEscape(o.secret)
+		req.Header.Set(fasthttp.HeaderAuthorization, "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	req.SetRequestURI(o.tokenURL)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("application/x-www-form-urlencoded")
+	req.Header.Set(fasthttp.HeaderAccept, "application/json")
+	req.SetBody(form.QueryString())
+
+	if err := o.client.DoTimeout(req, resp, o.timeout); err != nil {
+		return 0, err
+	}
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	jsonErr := json.Unmarshal(resp.Body(), &token)
+	switch {
+	case token.Error != "":
+		return 0, fmt.Errorf("status %d: %s %s", resp.StatusCode(), token.Error, token.ErrorDescription)
+	case resp.StatusCode() != fasthttp.StatusOK:
+		return 0, fmt.Errorf("status %d", resp.StatusCode())
+	case jsonErr != nil:
+		return 0, fmt.Errorf("token response: %w", jsonErr)
+	case token.AccessToken == "":
+		return 0, errors.New("token response has no access_token")
+	}
+	authorization := "Bearer " + token.AccessToken
+	o.authorization.Store(&authorization)
+	return time.Duration(token.ExpiresIn) * time.Second, nil
+}
+
+// run refreshes the token -oauth_refresh_before it expires, at the latest
+// halfway through its lifetime, until ctx is done. A token without lifetime
+// is kept.
+func (o *oauthClient) run(ctx context.Context, lifetime time.Duration) {
+	defer crashes.handlePanic("oauth", nil)
+	for lifetime > 0 {
+		wait := max(lifetime-o.before, lifetime/2)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+		expires := time.Now().Add(lifetime - wait)
+		for {
+			var err error
+			if lifetime, err = o.refresh(); err == nil {
+				log.Info().Timestamp().Dur("expires_in", lifetime).Msg("Refreshed OAuth2 token")
+				break
+			}
+			// the old token is kept, as it may still be valid
+			log.Warn().Timestamp().Err(err).Time("expires", expires).Msg("Failed to refresh OAuth2 token")
+			select {
+			case <-time.After(oauthRetryDelay):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
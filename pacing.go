@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"dos/internal/dist"
+	"fmt"
+	"time"
+)
+
+// pacer schedules request launches on an absolute timeline whose intervals
+// are drawn from a distribution, so a slow iteration doesn't shift every
+// following launch.
+type pacer struct {
+	next     time.Time
+	interval dist.Distribution
+}
+
+// delayDistribution turns -delay_dist into a distribution. The shorthand
+// names take their parameters from -delay and -delay_jitter; anything else
+// is parsed as a full spec such as "lognormal(200ms,1.5)".
+func delayDistribution(name string, delay, jitter time.Duration) (dist.Distribution, error) {
+	switch name {
+	case "uniform":
+		return dist.Parse(fmt.Sprintf("uniform(%s,%s)", max(delay-jitter, 0), delay+jitter))
+	case "exponential":
+		return dist.Parse(fmt.Sprintf("exponential(%s)", delay))
+	case "normal":
+		return dist.Parse(fmt.Sprintf("normal(%s,%s)", delay, jitter))
+	}
+	return dist.Parse(name)
+}
+
+func newPacer(interval dist.Distribution) *pacer {
+	return &pacer{interval: interval}
+}
+
+// wait blocks until the next launch is due and returns the time it was
+// scheduled for, which is earlier than now if launches are falling behind.
+func (p *pacer) wait(ctx context.Context) (time.Time, error) {
+	now := time.Now()
+	if p.next.IsZero() {
+		p.next = now
+	}
+	if wait := p.next.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return time.Time{}, ctx.Err()
+		}
+	}
+	due := p.next
+	p.next = p.next.Add(dist.SampleDuration(p.interval, rng))
+	return due, nil
+}
+
+// ticket lets a request be launched. intended is the time the request was
+// scheduled for, if launches follow a schedule.
+type ticket struct {
+	warm     bool
+	intended time.Time
+}
+
+// stamp marks res as a warm-up request and records its latency measured from
+// the intended launch time, which includes any time the request waited for a
+// free goroutine or virtual user.
+func (t ticket) stamp(res *Result) {
+	res.warmup = t.warm
+	if !t.intended.IsZero() {
+		res.corrected = time.Since(t.intended)
+	}
+}
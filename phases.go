@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type phaseMark struct {
+	Name          string     `json:"name"`
+	Start         time.Time  `json:"start"`
+	End           *time.Time `json:"end,omitempty"`
+	StartUnixNano int64      `json:"start_unix_nano"`
+	EndUnixNano   int64      `json:"end_unix_nano,omitempty"`
+}
+
+// phaseRecorder keeps the boundaries of run phases so external profiles of
+// the target or the generator can be aligned with the load timeline. All
+// methods are no-ops on a nil recorder.
+type phaseRecorder struct {
+	mu     sync.Mutex
+	phases []phaseMark
+	marker io.WriteCloser
+}
+
+var phases *phaseRecorder
+
+func newPhaseRecorder(traceMarker bool) (*phaseRecorder, error) {
+	r := &phaseRecorder{}
+	if traceMarker {
+		marker, err := openTraceMarker()
+		if err != nil {
+			return nil, err
+		}
+		r.marker = marker
+	}
+	return r, nil
+}
+
+func (r *phaseRecorder) enterAt(name string, at time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.endCurrent(at)
+	r.phases = append(r.phases, phaseMark{Name: name, Start: at, StartUnixNano: at.UnixNano()})
+	r.mark(fmt.Sprintf("dos: phase %s start", name))
+}
+
+func (r *phaseRecorder) finish() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.endCurrent(time.Now())
+	r.mark("dos: run end")
+	if r.marker != nil {
+		r.marker.Close()
+		r.marker = nil
+	}
+}
+
+func (r *phaseRecorder) endCurrent(at time.Time) {
+	if len(r.phases) == 0 {
+		return
+	}
+	last := &r.phases[len(r.phases)-1]
+	if last.End != nil {
+		return
+	}
+	last.End = &at
+	last.EndUnixNano = at.UnixNano()
+	r.mark(fmt.Sprintf("dos: phase %s end", last.Name))
+}
+
+func (r *phaseRecorder) mark(msg string) {
+	if r.marker == nil {
+		return
+	}
+	if _, err := io.WriteString(r.marker, msg); err != nil {
+		log.Debug().Timestamp().Err(err).Msg("Failed to write trace marker")
+	}
+}
+
+func (r *phaseRecorder) write(path string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(map[string]any{"phases": r.phases}, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
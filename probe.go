@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// healthProbe polls a health or metrics URL on the target at a low, fixed
+// rate, outside of the load budget, so its degradation can be correlated with
+// the load.
+type healthProbe struct {
+	url      string
+	interval time.Duration
+	timeout  time.Duration
+	client   *fasthttp.Client
+
+	mu      sync.Mutex
+	samples []probeSample
+}
+
+type probeSample struct {
+	at      time.Time
+	status  int
+	latency time.Duration
+	err     error
+}
+
+type probeResult struct {
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func newHealthProbe(url string, interval, timeout time.Duration) *healthProbe {
+	return &healthProbe{
+		url:      url,
+		interval: interval,
+		timeout:  timeout,
+		client:   &fasthttp.Client{TLSConfig: targetTLS.Clone(), Dial: targetDial()},
+	}
+}
+
+func (p *healthProbe) run(ctx context.Context) {
+	defer crashes.handlePanic("probe", nil)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.poll()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *healthProbe) poll() {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(p.url)
+	start := time.Now()
+	err := p.client.DoTimeout(req, resp, p.timeout)
+	sample := probeSample{at: start, status: resp.StatusCode(), latency: time.Since(start), err: err}
+	if err != nil {
+		sample.status = 0
+	}
+	log.Debug().Timestamp().Err(err).Int("status", sample.status).Dur("duration", sample.latency).Msg("Health probe")
+
+	p.mu.Lock()
+	p.samples = append(p.samples, sample)
+	p.mu.Unlock()
+}
+
+// bySecond returns the last probe result of every second since start.
+func (p *healthProbe) bySecond(start time.Time) map[int]*probeResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := map[int]*probeResult{}
+	for _, s := range p.samples {
+		if s.at.Before(start) {
+			continue
+		}
+		out[int(s.at.Sub(start)/time.Second)] = &probeResult{Status: s.status, LatencyMs: durationMs(s.latency), Error: errString(s.err)}
+	}
+	return out
+}
+
+type probeSummary struct {
+	probes     int
+	failures   int
+	avgLatency time.Duration
+	maxLatency time.Duration
+	// firstFailure is the offset from start of the first failed probe, or -1.
+	firstFailure time.Duration
+}
+
+// summary aggregates all probes; a probe fails on errors and 5xx responses.
+func (p *healthProbe) summary(start time.Time) probeSummary {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sum := probeSummary{probes: len(p.samples), firstFailure: -1}
+	var total time.Duration
+	for _, s := range p.samples {
+		total += s.latency
+		sum.maxLatency = max(sum.maxLatency, s.latency)
+		if s.err != nil || s.status >= fasthttp.StatusInternalServerError {
+			sum.failures++
+			if sum.firstFailure < 0 {
+				sum.firstFailure = s.at.Sub(start)
+			}
+		}
+	}
+	if sum.probes > 0 {
+		sum.avgLatency = total / time.Duration(sum.probes)
+	}
+	return sum
+}
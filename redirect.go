@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var redirectStats = newNamedStats()
+
+// doFollowingRedirects sends req and follows up to maxRedirects redirects,
+// all within timeout. It returns the latency of every hop, starting with the
+// original request. req is modified to point at the last hop.
+func doFollowingRedirects(c *fasthttp.Client, req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration, maxRedirects int) ([]time.Duration, error) {
+	deadline := time.Now().Add(timeout)
+	var hops []time.Duration
+	for {
+		start := time.Now()
+		err := c.DoDeadline(req, resp, deadline)
+		hops = append(hops, time.Since(start))
+		if err != nil {
+			return hops, err
+		}
+
+		status := resp.StatusCode()
+		location := resp.Header.Peek(fasthttp.HeaderLocation)
+		if !fasthttp.StatusCodeIsRedirect(status) || len(location) == 0 {
+			return hops, nil
+		}
+		if len(hops) > maxRedirects {
+			return hops, fasthttp.ErrTooManyRedirects
+		}
+
+		origin := string(req.URI().Scheme()) + "://" + strings.ToLower(string(req.URI().Host()))
+		req.URI().UpdateBytes(location)
+		if string(req.URI().Scheme())+"://"+strings.ToLower(string(req.URI().Host())) != origin {
+			stripCredentials(req)
+		}
+		if redirectGuard != nil {
+			if err := redirectGuard.confirmRedirect(req); err != nil {
+				return hops, err
+			}
+		}
+		// Like browsers, switch to GET after a 303, and after a 301/302 in
+		// response to a POST. 307 and 308 keep the method and body.
+		m := string(req.Header.Method())
+		if (status == fasthttp.StatusSeeOther && m != fasthttp.MethodHead) ||
+			((status == fasthttp.StatusMovedPermanently || status == fasthttp.StatusFound) && m == fasthttp.MethodPost) {
+			req.Header.SetMethod(fasthttp.MethodGet)
+			req.ResetBody()
+			req.Header.Del(fasthttp.HeaderContentType)
+		}
+		resp.Reset()
+	}
+}
+
+// stripCredentials removes the headers that authenticate req to its host,
+// before a redirect sends it to another host or over another scheme, like
+// curl does. Signatures wouldn't be valid for the new host anyway.
+func stripCredentials(req *fasthttp.Request) {
+	for _, name := range []string{fasthttp.HeaderAuthorization, fasthttp.HeaderCookie, "X-Amz-Security-Token", "X-Amz-Date", "X-Amz-Content-Sha256"} {
+		req.Header.Del(name)
+	}
+	if *hmacHeader != "" {
+		req.Header.Del(*hmacHeader)
+	}
+}
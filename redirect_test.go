@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestRedirectStripsCredentialsAcrossHosts(t *testing.T) {
+	defer func(h string) { *hmacHeader = h }(*hmacHeader)
+	*hmacHeader = "X-Signature"
+
+	var got http.Header
+	final := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer final.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/other-host":
+			http.Redirect(w, r, final.URL+"/done", http.StatusFound)
+		case "/same-host":
+			http.Redirect(w, r, "/done", http.StatusFound)
+		default:
+			got = r.Header.Clone()
+		}
+	}))
+	defer origin.Close()
+
+	tests := []struct {
+		path string
+		kept bool
+	}{
+		{path: "/same-host", kept: true},
+		{path: "/other-host", kept: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got = nil
+			req := fasthttp.AcquireRequest()
+			resp := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseRequest(req)
+			defer fasthttp.ReleaseResponse(resp)
+			req.SetRequestURI(origin.URL + tt.path)
+			req.Header.Set("Authorization", "Bearer secret")
+			req.Header.Set("X-Amz-Security-Token", "secret")
+			req.Header.Set("X-Signature", "secret")
+			req.Header.Set("Accept", "text/plain")
+			req.Header.SetCookie("session", "secret")
+
+			hops, err := doFollowingRedirects(&fasthttp.Client{}, req, resp, 5*time.Second, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hops) != 2 || got == nil {
+				t.Fatalf("got %d hops, want 2", len(hops))
+			}
+			for _, name := range []string{"Authorization", "X-Amz-Security-Token", "X-Signature", "Cookie"} {
+				if kept := got.Get(name) != ""; kept != tt.kept {
+					t.Errorf("%s kept = %v, want %v", name, kept, tt.kept)
+				}
+			}
+			if got.Get("Accept") != "text/plain" {
+				t.Errorf("Accept = %q, want it kept", got.Get("Accept"))
+			}
+		})
+	}
+}
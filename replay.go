@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// replayLog sends recorded requests, from a HAR file or an access log, in
+// their original order, starting over after the last one.
+type replayLog struct {
+	entries []requestSpec
+	// captures are the extractors of every entry of a scenario.
+	captures [][]*extractor
+	// offsets are the start times of the entries relative to the first one.
+	offsets []time.Duration
+	// loop is the time from the first entry to its repetition.
+	loop  time.Duration
+	first time.Time
+	next  uint64
+
+	start    time.Time
+	launched int
+}
+
+// add appends an entry recorded at the given time. Entries must be added in
+// the order they were recorded.
+func (r *replayLog) add(spec requestSpec, at time.Time) {
+	if len(r.entries) == 0 {
+		r.first = at
+	}
+	r.entries = append(r.entries, spec)
+	r.offsets = append(r.offsets, max(at.Sub(r.first), 0))
+}
+
+// setSpeed scales the recorded timing, e.g. 2 replays twice as fast. The
+// log repeats after the average gap between its entries.
+func (r *replayLog) setSpeed(speed float64) {
+	for i := range r.offsets {
+		r.offsets[i] = time.Duration(float64(r.offsets[i]) / speed)
+	}
+	r.loop = 0
+	if n := len(r.offsets); n > 1 {
+		r.loop = r.offsets[n-1] + r.offsets[n-1]/time.Duration(n-1)
+	}
+}
+
+// nextEntry returns the entry to send next. It is safe for concurrent use.
+func (r *replayLog) nextEntry() *requestSpec {
+	n := atomic.AddUint64(&r.next, 1) - 1
+	return &r.entries[n%uint64(len(r.entries))]
+}
+
+// rewind makes nextEntry start over with the first entry. It must not be
+// called while requests are sent.
+func (r *replayLog) rewind() {
+	atomic.StoreUint64(&r.next, 0)
+}
+
+// entryAt returns the n-th entry to send, wrapping around the log.
+func (r *replayLog) entryAt(n int) *requestSpec {
+	return &r.entries[n%len(r.entries)]
+}
+
+// wait blocks until the next entry is due according to the recorded timing
+// and returns the time it was due. It must only be called from the dispatch
+// loop.
+func (r *replayLog) wait(ctx context.Context) (time.Time, error) {
+	now := time.Now()
+	if r.start.IsZero() {
+		r.start = now
+	}
+	cycle, i := r.launched/len(r.entries), r.launched%len(r.entries)
+	r.launched++
+	due := r.start.Add(time.Duration(cycle)*r.loop + r.offsets[i])
+	if wait := due.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return time.Time{}, ctx.Err()
+		}
+	}
+	return due, nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"dos/internal/metrics"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// reportCommand rebuilds the summary of a run from its -results_out file,
+// and optionally charts it as an HTML page, without running it again.
+func reportCommand(args []string) {
+	fs, lvl, pretty := commandFlags("report")
+	format := fs.String("summary_format", "text", "format of the summary printed to stdout (text, json)")
+	htmlOut := fs.String("html", "", "path to write an HTML page with the summary and charts of the run to")
+	configPath := fs.String("config", "", "config file whose slos section the run is checked against")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dos report [flags] <results file>\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	zerolog.SetGlobalLevel(setupLog(os.Stderr, *pretty, *lvl))
+
+	switch {
+	case fs.NArg() != 1:
+		fs.Usage()
+		os.Exit(2)
+	case *format != "text" && *format != "json":
+		log.Fatal().Timestamp().Str("summary_format", *format).Msg("summary_format must be text or json")
+	}
+	path := fs.Arg(0)
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal().Err(err).Timestamp().Msg("Failed to open results file")
+	}
+	records, err := readResults(f)
+	f.Close()
+	if err != nil {
+		log.Fatal().Err(err).Timestamp().Str("results", path).Msg("Failed to read results file")
+	}
+	if len(records) == 0 {
+		log.Fatal().Timestamp().Str("results", path).Msg("Results file has no requests")
+	}
+
+	var slos []*serviceLevel
+	if *configPath != "" {
+		slos, err = loadSLOs(*configPath)
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Str("config", *configPath).Msg("Invalid slos")
+		}
+	}
+	rep := buildReport(records, slos)
+	if err := writeSummary(os.Stdout, *format, rep.summary); err != nil {
+		log.Fatal().Err(err).Timestamp().Msg("Failed to write summary")
+	}
+	if *htmlOut != "" {
+		out, err := os.Create(*htmlOut)
+		if err == nil {
+			err = writeReportHTML(out, path, rep)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Str("html", *htmlOut).Msg("Failed to write HTML report")
+		}
+	}
+}
+
+// runReport is a run rebuilt from its results, with the summary the run
+// printed and per-second statistics for charts.
+type runReport struct {
+	summary runSummary
+	seconds []reportSecond
+}
+
+type reportSecond struct {
+	requests int64
+	errors   int64
+	p50, p99 time.Duration
+}
+
+// buildReport computes the statistics of records like the run did, and the
+// compliance with slos. The run is taken to last from the start of the first
+// request to the end of the last one, so it doesn't include the time spent
+// draining.
+func buildReport(records []resultRecord, slos []*serviceLevel) runReport {
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	start, end := records[0].Time, records[0].Time
+	for _, rec := range records {
+		start = min(start, rec.Time-ms(rec.LatencyMs).Milliseconds())
+		end = max(end, rec.Time)
+	}
+
+	var snap statsSnapshot
+	var total time.Duration
+	latency := metrics.NewHistogram()
+	endpoints := newEndpointStats()
+	snap.ErrorTypes = map[string]int64{}
+	seconds := make([]struct {
+		reportSecond
+		latency *metrics.Histogram
+	}, (end-start)/1000+1)
+	for _, rec := range records {
+		d := ms(rec.LatencyMs)
+		total += d
+		latency.Record(d)
+		if rec.Endpoint != "" {
+			endpoints.record(rec.Endpoint, rec.Status, rec.Failed, d)
+		}
+		if len(slos) > 0 {
+			res := &Result{status: rec.Status, duration: d, endpoint: rec.Endpoint}
+			if rec.Failed {
+				res.err = errors.New(rec.ErrorClass)
+			}
+			for _, l := range slos {
+				l.add(res)
+			}
+		}
+		snap.BytesReceived += rec.Bytes
+		if rec.Failed {
+			snap.Errors++
+		}
+		if rec.Status != 0 {
+			snap.CompletedRequests++
+		}
+		if rec.ErrorClass != "" {
+			snap.ErrorTypes[rec.ErrorClass]++
+			if slices.Contains(unsentClasses, rec.ErrorClass) {
+				snap.UnsentRequests++
+			}
+		}
+
+		sec := &seconds[(rec.Time-start)/1000]
+		sec.requests++
+		if rec.Failed || rec.Status >= 500 {
+			sec.errors++
+		}
+		if sec.latency == nil {
+			sec.latency = metrics.NewHistogram()
+		}
+		sec.latency.Record(d)
+	}
+
+	duration := time.Duration(end-start) * time.Millisecond
+	snap.RecordedRequests = int64(len(records))
+	snap.AttemptedRequests = snap.RecordedRequests
+	snap.SentRequests = snap.RecordedRequests - snap.UnsentRequests
+	snap.AverageRequestDuration = float64(total) / float64(snap.RecordedRequests)
+	snap.AverageResponseSize = float64(snap.BytesReceived) / float64(snap.RecordedRequests)
+	if duration > 0 {
+		snap.RequestsPerSecond = float64(snap.RecordedRequests) / duration.Seconds()
+		snap.ThroughputMBps = float64(snap.BytesReceived) / 1e6 / duration.Seconds()
+	}
+	snap.Latency = newLatencySummary(latency)
+	snap.Endpoints = endpoints.summaries()
+	snap.SLOs = sloStatuses(slos)
+	if len(snap.ErrorTypes) == 0 {
+		snap.ErrorTypes = nil
+	}
+
+	rep := runReport{summary: runSummary{DurationSeconds: duration.Seconds(), statsSnapshot: snap}}
+	for _, sec := range seconds {
+		if sec.latency != nil {
+			sec.p50, sec.p99 = sec.latency.Quantile(0.50), sec.latency.Quantile(0.99)
+		}
+		rep.seconds = append(rep.seconds, sec.reportSecond)
+	}
+	return rep
+}
+
+const chartWidth, chartHeight = 800, 200
+
+type reportChart struct {
+	Title  string
+	Max    string
+	Width  int
+	Height int
+	Lines  []reportLine
+}
+
+type reportLine struct {
+	Name   string
+	Color  string
+	Points string
+}
+
+// newChart plots one line per series over the seconds of the run, all on
+// the scale of the largest value.
+func newChart(title, unit string, names, colors []string, series ...[]float64) reportChart {
+	top := 0.0
+	for _, values := range series {
+		for _, v := range values {
+			top = max(top, v)
+		}
+	}
+	chart := reportChart{Title: title, Max: strconv.FormatFloat(math.Round(top*10)/10, 'f', -1, 64) + " " + unit, Width: chartWidth, Height: chartHeight}
+	for i, values := range series {
+		var points strings.Builder
+		for x, v := range values {
+			px := 0.0
+			if len(values) > 1 {
+				px = float64(x) / float64(len(values)-1) * chartWidth
+			}
+			py := float64(chartHeight)
+			if top > 0 {
+				py -= v / top * chartHeight
+			}
+			fmt.Fprintf(&points, "%.1f,%.1f ", px, py)
+		}
+		chart.Lines = append(chart.Lines, reportLine{Name: names[i], Color: colors[i], Points: points.String()})
+	}
+	return chart
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>dos report: {{.Source}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+svg { background: #fafafa; border: 1px solid #ccc; overflow: visible; }
+.legend span { margin-right: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Source}}</h1>
+<pre>{{.Summary}}</pre>
+{{range .Charts}}
+<h2>{{.Title}}</h2>
+<svg width="{{.Width}}" height="{{.Height}}">
+<text x="4" y="14" font-size="12">{{.Max}}</text>
+{{range .Lines}}<polyline fill="none" stroke-width="1.5" stroke="{{.Color}}" points="{{.Points}}"/>
+{{end}}</svg>
+<p class="legend">{{range .Lines}}<span style="color: {{.Color}}">&#9632; {{.Name}}</span>{{end}}</p>
+{{end}}
+<p>{{.Seconds}} seconds, one point per second.</p>
+</body>
+</html>
+`))
+
+func writeReportHTML(w io.Writer, source string, rep runReport) error {
+	var summary bytes.Buffer
+	if err := writeSummary(&summary, "text", rep.summary); err != nil {
+		return err
+	}
+
+	n := len(rep.seconds)
+	requests, errors, p50, p99 := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+	for i, sec := range rep.seconds {
+		requests[i], errors[i] = float64(sec.requests), float64(sec.errors)
+		p50[i], p99[i] = durationMs(sec.p50), durationMs(sec.p99)
+	}
+	return reportTemplate.Execute(w, map[string]any{
+		"Source":  source,
+		"Summary": summary.String(),
+		"Seconds": n,
+		"Charts": []reportChart{
+			newChart("Requests per second", "requests", []string{"requests", "errors and 5xx"}, []string{"#1f77b4", "#d62728"}, requests, errors),
+			newChart("Latency", "ms", []string{"p50", "p99"}, []string{"#2ca02c", "#ff7f0e"}, p50, p99),
+		},
+	})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// resultRecord is one request of -results_out. Time is when the result was
+// recorded, in Unix milliseconds; failed is set for failed requests, of which
+// those that got no response have no status, while error_class also covers
+// responses outside 2xx.
+type resultRecord struct {
+	Time       int64   `json:"time"`
+	LatencyMs  float64 `json:"latency_ms"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	Failed     bool    `json:"failed"`
+	ErrorClass string  `json:"error_class,omitempty"`
+	Method     string  `json:"method,omitempty"`
+	Variant    string  `json:"variant,omitempty"`
+	Endpoint   string  `json:"endpoint,omitempty"`
+}
+
+// resultColumns are the CSV columns; files written before the endpoint
+// column was added are still read.
+var resultColumns = []string{"time", "latency_ms", "status", "bytes", "failed", "error_class", "method", "variant", "endpoint"}
+
+// resultWriter writes every request outside of warm-up to -results_out, so
+// the run can be analyzed again with the report command. It is only used
+// from the goroutine recording results.
+type resultWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+	enc  *json.Encoder
+	csv  *csv.Writer
+}
+
+func newResultWriter(path, format string) (*resultWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &resultWriter{file: file, buf: bufio.NewWriterSize(file, 64<<10)}
+	if format == "csv" {
+		w.csv = csv.NewWriter(w.buf)
+		w.csv.Write(resultColumns)
+	} else {
+		w.enc = json.NewEncoder(w.buf)
+	}
+	return w, nil
+}
+
+func (w *resultWriter) write(res *Result, at time.Time) {
+	rec := resultRecord{
+		Time:       at.UnixMilli(),
+		LatencyMs:  durationMs(res.duration),
+		Bytes:      res.bytes,
+		Failed:     res.err != nil,
+		ErrorClass: errorClass(res),
+		Method:     res.method,
+		Variant:    res.variant,
+		Endpoint:   res.endpoint,
+	}
+	if res.received {
+		rec.Status = res.status
+	}
+	if w.csv != nil {
+		w.csv.Write([]string{
+			strconv.FormatInt(rec.Time, 10),
+			strconv.FormatFloat(rec.LatencyMs, 'f', 3, 64),
+			strconv.Itoa(rec.Status),
+			strconv.FormatInt(rec.Bytes, 10),
+			strconv.FormatBool(rec.Failed),
+			rec.ErrorClass,
+			rec.Method,
+			rec.Variant,
+			rec.Endpoint,
+		})
+		return
+	}
+	w.enc.Encode(rec)
+}
+
+func (w *resultWriter) close() error {
+	if w.csv != nil {
+		w.csv.Flush()
+	}
+	return errors.Join(w.buf.Flush(), w.file.Close())
+}
+
+// readResults reads a file written with -results_out in either format,
+// telling them apart by the first byte.
+func readResults(r io.Reader) ([]resultRecord, error) {
+	br := bufio.NewReader(r)
+	first, err := br.Peek(1)
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var records []resultRecord
+	if first[0] == '{' {
+		dec := json.NewDecoder(br)
+		for {
+			var rec resultRecord
+			if err := dec.Decode(&rec); err == io.EOF {
+				return records, nil
+			} else if err != nil {
+				return nil, fmt.Errorf("record %d: %w", len(records)+1, err)
+			}
+			records = append(records, rec)
+		}
+	}
+
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(header) < len(resultColumns)-1 || header[0] != resultColumns[0] {
+		return nil, errors.New("not a results file: unknown header")
+	}
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		rec, err := parseResultRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func parseResultRow(row []string) (rec resultRecord, err error) {
+	if len(row) < len(resultColumns)-1 {
+		return rec, fmt.Errorf("expected %d columns, got %d", len(resultColumns), len(row))
+	}
+	if rec.Time, err = strconv.ParseInt(row[0], 10, 64); err != nil {
+		return rec, err
+	}
+	if rec.LatencyMs, err = strconv.ParseFloat(row[1], 64); err != nil {
+		return rec, err
+	}
+	if rec.Status, err = strconv.Atoi(row[2]); err != nil {
+		return rec, err
+	}
+	if rec.Bytes, err = strconv.ParseInt(row[3], 10, 64); err != nil {
+		return rec, err
+	}
+	if rec.Failed, err = strconv.ParseBool(row[4]); err != nil {
+		return rec, err
+	}
+	rec.ErrorClass, rec.Method, rec.Variant = row[5], row[6], row[7]
+	if len(row) > 8 {
+		rec.Endpoint = row[8]
+	}
+	return rec, nil
+}
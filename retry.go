@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// retryPolicy decides whether a failed HTTP request is sent again. Retries
+// back off exponentially from backoff.
+type retryPolicy struct {
+	retries  int
+	backoff  time.Duration
+	onStatus map[int]bool
+	// client sends retries if set, so that with proxies they go out over a
+	// fresh connection through the next proxy instead of the one that failed.
+	client *fasthttp.Client
+}
+
+func newRetryPolicy(retries int, backoff time.Duration, statuses string) (*retryPolicy, error) {
+	p := &retryPolicy{retries: retries, backoff: backoff, onStatus: map[int]bool{}}
+	if statuses == "" {
+		return p, nil
+	}
+	for _, s := range strings.Split(statuses, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q", s)
+		}
+		p.onStatus[code] = true
+	}
+	return p, nil
+}
+
+func (p *retryPolicy) shouldRetry(status int, err error) bool {
+	if err != nil {
+		return true
+	}
+	return p.onStatus[status]
+}
+
+// wait sleeps before retry number n, counting from 1.
+func (p *retryPolicy) wait(ctx context.Context, n int) error {
+	t := time.NewTimer(p.backoff << (n - 1))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
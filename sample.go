@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// sampleBodyLimit is how many bytes of a request or response body a sample
+// keeps.
+const sampleBodyLimit = 4096
+
+type sampleRecord struct {
+	Time       time.Time      `json:"time"`
+	DurationMs float64        `json:"duration_ms"`
+	Variant    string         `json:"variant,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Request    sampleMessage  `json:"request"`
+	Response   *sampleMessage `json:"response,omitempty"`
+}
+
+type sampleMessage struct {
+	Method        string   `json:"method,omitempty"`
+	URL           string   `json:"url,omitempty"`
+	Status        int      `json:"status,omitempty"`
+	Headers       []string `json:"headers"`
+	Body          string   `json:"body,omitempty"`
+	BodySize      int      `json:"body_size"`
+	BodyTruncated bool     `json:"body_truncated,omitempty"`
+}
+
+// requestSampler hands the full exchange of a random fraction of requests to
+// out, which writes them to -sample_out as NDJSON, for looking at what the
+// target actually answers under load.
+type requestSampler struct {
+	rate  float64
+	out   func(sampleRecord)
+	close func() error
+}
+
+func newRequestSampler(path string, rate float64) (*requestSampler, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	enc := json.NewEncoder(file)
+	out := func(rec sampleRecord) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(rec); err != nil {
+			log.Error().Timestamp().Err(err).Str("sample_out", path).Msg("Failed to write sample")
+		}
+	}
+	return &requestSampler{rate: rate, out: out, close: file.Close}, nil
+}
+
+func (s *requestSampler) pick() bool {
+	return rng.Float64() < s.rate
+}
+
+// record passes on req and resp as they were after the last attempt and
+// redirect. resp is left out if the request failed.
+func (s *requestSampler) record(start time.Time, req *fasthttp.Request, resp *fasthttp.Response, err error, variant string) {
+	rec := sampleRecord{
+		Time:       start,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		Variant:    variant,
+		Error:      errString(err),
+		Request: sampleMessage{
+			Method: string(req.Header.Method()),
+			URL:    req.URI().String(),
+		},
+	}
+	req.Header.VisitAll(func(key, value []byte) {
+		rec.Request.Headers = append(rec.Request.Headers, sampleHeader(key, value))
+	})
+	rec.Request.setBody(req.Body())
+	if err == nil {
+		rec.Response = &sampleMessage{Status: resp.StatusCode()}
+		resp.Header.VisitAll(func(key, value []byte) {
+			rec.Response.Headers = append(rec.Response.Headers, sampleHeader(key, value))
+		})
+		rec.Response.setBody(resp.Body())
+	}
+	s.out(rec)
+}
+
+// sampleHeader formats a header for a sample, with the value of headers that
+// carry credentials, including the -hmac_header, replaced by [redacted].
+func sampleHeader(key, value []byte) string {
+	name := string(key)
+	switch strings.ToLower(name) {
+	case "authorization", "proxy-authorization", "cookie", "set-cookie", "x-amz-security-token":
+		return name + ": [redacted]"
+	}
+	if *hmacHeader != "" && strings.EqualFold(name, *hmacHeader) {
+		return name + ": [redacted]"
+	}
+	return name + ": " + string(value)
+}
+
+func (m *sampleMessage) setBody(body []byte) {
+	m.BodySize = len(body)
+	if len(body) > sampleBodyLimit {
+		body = body[:sampleBodyLimit]
+		m.BodyTruncated = true
+	}
+	m.Body = string(body)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestSampleRedactsCredentials(t *testing.T) {
+	defer func(h string) { *hmacHeader = h }(*hmacHeader)
+	*hmacHeader = "X-Signature"
+
+	var rec sampleRecord
+	s := &requestSampler{rate: 1, out: func(r sampleRecord) { rec = r }}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI("https://example.com/")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Proxy-Authorization", "Basic secret")
+	req.Header.Set("X-Amz-Security-Token", "secret")
+	req.Header.Set("x-signature", "secret")
+	req.Header.Set("Accept", "text/plain")
+	req.Header.SetCookie("session", "secret")
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	resp.Header.Set("Set-Cookie", "session=secret")
+	resp.Header.Set("X-Request-Id", "1")
+
+	s.record(time.Now(), req, resp, nil, "")
+
+	tests := []struct {
+		headers []string
+		want    string
+	}{
+		{rec.Request.Headers, "Authorization: [redacted]"},
+		{rec.Request.Headers, "Proxy-Authorization: [redacted]"},
+		{rec.Request.Headers, "X-Amz-Security-Token: [redacted]"},
+		{rec.Request.Headers, "X-Signature: [redacted]"},
+		{rec.Request.Headers, "Cookie: [redacted]"},
+		{rec.Request.Headers, "Accept: text/plain"},
+		{rec.Response.Headers, "Set-Cookie: [redacted]"},
+		{rec.Response.Headers, "X-Request-Id: 1"},
+	}
+	for _, tt := range tests {
+		if !slices.Contains(tt.headers, tt.want) {
+			t.Errorf("headers %q don't contain %q", tt.headers, tt.want)
+		}
+	}
+}
+
+func TestSampleFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "samples.ndjson")
+	s, err := newRequestSampler(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("sample file mode = %o, want 600", mode)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// errExtract marks a response a scenario step couldn't take a value out of.
+var errExtract = errors.New("extract")
+
+// scenarioStep is a request of the scenario config section. Extract maps
+// names to source:expression, as in -extract, whose values are taken from
+// the response into {{extract.<name>}} placeholders of the following steps
+// of the same virtual user.
+type scenarioStep struct {
+	requestSpec
+	Extract map[string]string `json:"extract"`
+}
+
+var scenarioSteps []scenarioStep
+
+// newScenario makes a replay log of the steps, which virtual users go
+// through in order like the requests of a HAR file.
+func newScenario(steps []scenarioStep) (*replayLog, error) {
+	r := &replayLog{}
+	for i := range steps {
+		step := &steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step-%d", i+1)
+		}
+		if step.URL == "" {
+			return nil, fmt.Errorf("scenario: step %q has no url", step.Name)
+		}
+		if err := step.compile(); err != nil {
+			return nil, fmt.Errorf("scenario: step %q: %w", step.Name, err)
+		}
+		step.endpoint = step.Name
+		var captures []*extractor
+		for name, spec := range step.Extract {
+			x, err := parseExtractor(name + "=" + spec)
+			if err != nil {
+				return nil, fmt.Errorf("scenario: step %q: %w", step.Name, err)
+			}
+			captures = append(captures, x)
+		}
+		r.add(step.requestSpec, time.Time{})
+		r.captures = append(r.captures, captures)
+	}
+	return r, nil
+}
+
+// scenarioExtracts reports whether a scenario step sets {{extract.<name>}}.
+func scenarioExtracts(name string) bool {
+	for _, step := range scenarioSteps {
+		if _, ok := step.Extract[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// capture takes the values of the n-th entry out of resp into vars.
+func (r *replayLog) capture(n int, resp *fasthttp.Response, vars map[string]string) error {
+	if len(r.captures) == 0 {
+		return nil
+	}
+	for _, x := range r.captures[n%len(r.entries)] {
+		value, err := x.extract(resp)
+		if err != nil {
+			return fmt.Errorf("%w %s: %w", errExtract, x.name, err)
+		}
+		vars[x.name] = value
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"dos/internal/util"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// verificationPath is where -verify_token is looked up on every target host.
+const verificationPath = "/.well-known/dos-verification.txt"
+
+// requestHosts returns the hosts of every URL requests of the run are sent
+// to, in lower case and without port. URLs whose host is a placeholder are
+// returned as errors, since they can't be checked before the run.
+func requestHosts() ([]string, error) {
+	urls := []string{*targetURL, *probeURL, *oauthTokenURL, *primeURL}
+	specs := func(list []requestSpec) {
+		for _, spec := range list {
+			urls = append(urls, spec.URL)
+		}
+	}
+	if replay != nil {
+		specs(replay.entries)
+	}
+	for _, v := range variants {
+		urls = append(urls, v.URL)
+	}
+	for _, spec := range methodRequests {
+		urls = append(urls, spec.URL)
+	}
+	if teardown != nil {
+		specs(teardown.Steps)
+	}
+
+	var hosts []string
+	for _, raw := range urls {
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || strings.Contains(u.Host, "{{") {
+			return nil, fmt.Errorf("host of %q can't be checked before the run", raw)
+		}
+		host := strings.ToLower(u.Hostname())
+		if host != "" && !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// confirmTargets refuses to start the run unless every host requests are sent
+// to was confirmed with -i_own_this_target, matches -target_allowlist or
+// serves -verify_token, as a guard against typos in a target. Loopback
+// hosts need no confirmation. If several ways are given, all must pass, and
+// -target_allowlist and -verify_token also apply to the hosts of redirects.
+func confirmTargets() error {
+	hosts, err := requestHosts()
+	if *targetAllowlist == "" && *verifyToken == "" {
+		if *iOwnThisTarget {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w; confirm with -i_own_this_target", err)
+		}
+		hosts = slices.DeleteFunc(hosts, isLoopbackHost)
+		if len(hosts) == 0 {
+			return nil
+		}
+		return fmt.Errorf("refusing to send requests to %s: confirm with -i_own_this_target, -target_allowlist or -verify_token", strings.Join(hosts, ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("%w against -target_allowlist or -verify_token", err)
+	}
+
+	guard := &hostGuard{verified: map[string]error{}}
+	if *targetAllowlist != "" {
+		if guard.allowed, err = util.ReadFileEntries(*targetAllowlist); err != nil {
+			return fmt.Errorf("target allowlist: %w", err)
+		}
+	}
+	target, _ := url.Parse(*targetURL)
+	if *verifyToken != "" {
+		if target.Scheme != "http" && target.Scheme != "https" {
+			return errors.New("verify_token requires an http or https target")
+		}
+		guard.verify = true
+	}
+	for _, host := range hosts {
+		hostport := host
+		if host == strings.ToLower(target.Hostname()) && target.Port() != "" {
+			hostport = net.JoinHostPort(host, target.Port())
+		}
+		if err := guard.confirm(target.Scheme, host, hostport); err != nil {
+			return err
+		}
+	}
+	redirectGuard = guard
+	return nil
+}
+
+// redirectGuard confirms the hosts of redirects during the run, nil unless
+// -target_allowlist or -verify_token is given.
+var redirectGuard *hostGuard
+
+// hostGuard checks hosts against -target_allowlist and -verify_token.
+// Verification tokens are fetched once per host.
+type hostGuard struct {
+	allowed []string
+	verify  bool
+
+	mu       sync.Mutex
+	verified map[string]error
+}
+
+// confirm checks host, whose verification file is fetched from hostport
+// over scheme.
+func (g *hostGuard) confirm(scheme, host, hostport string) error {
+	if isLoopbackHost(host) {
+		return nil
+	}
+	if g.allowed != nil && !slices.ContainsFunc(g.allowed, func(pattern string) bool { return matchHost(strings.ToLower(pattern), host) }) {
+		return fmt.Errorf("%s is not in the target allowlist %s", host, *targetAllowlist)
+	}
+	if !g.verify {
+		return nil
+	}
+	key := scheme + "://" + hostport
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	err, ok := g.verified[key]
+	if !ok {
+		err = checkVerificationToken(scheme, hostport)
+		g.verified[key] = err
+	}
+	return err
+}
+
+// confirmRedirect checks the host a redirect points req to.
+func (g *hostGuard) confirmRedirect(req *fasthttp.Request) error {
+	uri := req.URI()
+	hostport := strings.ToLower(string(uri.Host()))
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if err := g.confirm(string(uri.Scheme()), host, hostport); err != nil {
+		return fmt.Errorf("%w: redirect to unconfirmed host: %w", errOutOfScope, err)
+	}
+	return nil
+}
+
+// matchHost reports whether host matches pattern, either exactly or, for a
+// pattern like *.example.com, as a subdomain.
+func matchHost(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// checkVerificationToken fetches the verification file of host and checks
+// that one of its lines is -verify_token.
+func checkVerificationToken(scheme, host string) error {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	u := (&url.URL{Scheme: scheme, Host: host, Path: verificationPath}).String()
+	req.SetRequestURI(u)
+	c := &fasthttp.Client{TLSConfig: targetTLS.Clone(), Dial: targetDial()}
+	if err := c.DoTimeout(req, resp, *requestTimeout); err != nil {
+		return fmt.Errorf("fetch verification token from %s: %w", u, err)
+	}
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return fmt.Errorf("fetch verification token from %s: status %d", u, resp.StatusCode())
+	}
+	for _, line := range bytes.Split(resp.Body(), []byte("\n")) {
+		if string(bytes.TrimSpace(line)) == *verifyToken {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s doesn't contain the verification token", u)
+}
+
+// errOutOfScope is returned for connections to addresses on the blocklist
+// and redirects to unconfirmed hosts.
+var errOutOfScope = errors.New("out of scope")
+
+// targetBlocklist is built from -block_private, -block_cidrs and
+// -block_domains, nil if none is set.
+var targetBlocklist *blocklist
+
+// blocklist refuses hosts and addresses that must never receive requests,
+// such as internal or production infrastructure. Addresses are checked after
+// DNS resolution, so a name pointing into a blocked range is refused too.
+type blocklist struct {
+	private  bool
+	prefixes []netip.Prefix
+	domains  []string
+}
+
+// newBlocklist parses comma-separated CIDRs or addresses and domains, which
+// may be patterns like *.example.com. It returns nil if nothing is blocked.
+func newBlocklist(private bool, cidrs, domains string) (*blocklist, error) {
+	b := &blocklist{private: private}
+	for _, s := range strings.Split(cidrs, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(s)
+			if addrErr != nil {
+				return nil, fmt.Errorf("block_cidrs: %w", err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		b.prefixes = append(b.prefixes, prefix.Masked())
+	}
+	for _, s := range strings.Split(domains, ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			b.domains = append(b.domains, s)
+		}
+	}
+	if !b.private && len(b.prefixes) == 0 && len(b.domains) == 0 {
+		return nil, nil
+	}
+	return b, nil
+}
+
+// blockedHost reports why host is blocked by name, or "" if it isn't. A
+// domain blocks its subdomains too, *.example.com only the subdomains.
+func (b *blocklist) blockedHost(host string) string {
+	for _, pattern := range b.domains {
+		if matchHost(pattern, host) || !strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, "."+pattern) {
+			return "domain " + pattern
+		}
+	}
+	return ""
+}
+
+// blockedAddr reports why ip is blocked, or "" if it isn't. With
+// -block_private, private (RFC 1918 and fc00::/7) and link-local addresses,
+// which include cloud metadata endpoints, are blocked.
+func (b *blocklist) blockedAddr(ip netip.Addr) string {
+	ip = ip.Unmap()
+	if b.private && (ip.IsPrivate() || ip.IsLinkLocalUnicast()) {
+		return "private range"
+	}
+	for _, prefix := range b.prefixes {
+		if prefix.Contains(ip) {
+			return prefix.String()
+		}
+	}
+	return ""
+}
+
+// checkScope resolves every host requests of the run are sent to and refuses
+// the run if a host or one of its addresses is blocked. Hosts that are
+// placeholders are only checked when connecting.
+func checkScope() error {
+	if targetBlocklist == nil {
+		return nil
+	}
+	hosts, err := requestHosts()
+	if err != nil {
+		log.Warn().Timestamp().Err(err).Msg("Blocklist is only checked when connecting")
+	}
+	for _, host := range hosts {
+		if reason := targetBlocklist.blockedHost(host); reason != "" {
+			return fmt.Errorf("%s is blocked by %s", host, reason)
+		}
+		ips, err := net.DefaultResolver.LookupNetIP(context.Background(), lookupNetwork(), host)
+		if err != nil {
+			return fmt.Errorf("resolve %s: %w", host, err)
+		}
+		for _, ip := range ips {
+			if reason := targetBlocklist.blockedAddr(ip); reason != "" {
+				return fmt.Errorf("%s resolves to %s, which is blocked by %s", host, ip.Unmap(), reason)
+			}
+		}
+	}
+	return nil
+}
+
+// scopedDial closes connections whose remote address is blocked, which
+// catches names that resolve differently during the run and redirects to
+// hosts that weren't checked at startup.
+func scopedDial(dial fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		if targetBlocklist == nil {
+			return dial(addr)
+		}
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			if reason := targetBlocklist.blockedHost(strings.ToLower(host)); reason != "" {
+				return nil, fmt.Errorf("%w: %s is blocked by %s", errOutOfScope, host, reason)
+			}
+		}
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		if remote, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			if reason := targetBlocklist.blockedAddr(remote.AddrPort().Addr()); reason != "" {
+				conn.Close()
+				return nil, fmt.Errorf("%w: %s is blocked by %s", errOutOfScope, remote.IP, reason)
+			}
+		}
+		return conn, nil
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+		want    bool
+	}{
+		{pattern: "example.com", host: "example.com", want: true},
+		{pattern: "example.com", host: "www.example.com", want: false},
+		{pattern: "example.com", host: "badexample.com", want: false},
+		{pattern: "*.example.com", host: "www.example.com", want: true},
+		{pattern: "*.example.com", host: "a.b.example.com", want: true},
+		{pattern: "*.example.com", host: "example.com", want: false},
+		{pattern: "*.example.com", host: "badexample.com", want: false},
+		{pattern: "*.example.com", host: "example.com.evil.net", want: false},
+		{pattern: "10.0.0.1", host: "10.0.0.1", want: true},
+	}
+	for _, tt := range tests {
+		if got := matchHost(tt.pattern, tt.host); got != tt.want {
+			t.Errorf("matchHost(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestNewBlocklist(t *testing.T) {
+	tests := []struct {
+		name    string
+		private bool
+		cidrs   string
+		domains string
+		empty   bool
+		err     string
+	}{
+		{name: "nothing blocked", cidrs: " , ", domains: ",", empty: true},
+		{name: "private", private: true},
+		{name: "cidrs and addresses", cidrs: "10.1.0.0/16, 192.0.2.7,2001:db8::/32"},
+		{name: "domains", domains: "Corp.Example.com,*.prod.example.com"},
+		{name: "invalid cidr", cidrs: "10.1.0.0/33", err: "block_cidrs"},
+		{name: "invalid address", cidrs: "intranet", err: "block_cidrs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := newBlocklist(tt.private, tt.cidrs, tt.domains)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("newBlocklist() error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newBlocklist() error = %v", err)
+			}
+			if (b == nil) != tt.empty {
+				t.Errorf("newBlocklist() = %+v, want nil: %v", b, tt.empty)
+			}
+		})
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	b, err := newBlocklist(true, "203.0.113.0/24,198.51.100.7,2001:db8::/32", "corp.example.com,*.prod.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := []struct {
+		host string
+		want string
+	}{
+		{host: "corp.example.com", want: "domain corp.example.com"},
+		{host: "wiki.corp.example.com", want: "domain corp.example.com"},
+		{host: "api.prod.example.com", want: "domain *.prod.example.com"},
+		{host: "prod.example.com", want: ""},
+		{host: "notcorp.example.com", want: ""},
+		{host: "example.com", want: ""},
+	}
+	for _, tt := range hosts {
+		if got := b.blockedHost(tt.host); got != tt.want {
+			t.Errorf("blockedHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+
+	addrs := []struct {
+		addr string
+		want string
+	}{
+		{addr: "10.0.0.1", want: "private range"},
+		{addr: "172.16.5.4", want: "private range"},
+		{addr: "192.168.1.1", want: "private range"},
+		{addr: "169.254.169.254", want: "private range"},
+		{addr: "::ffff:169.254.169.254", want: "private range"},
+		{addr: "fd00::1", want: "private range"},
+		{addr: "fe80::1", want: "private range"},
+		{addr: "203.0.113.9", want: "203.0.113.0/24"},
+		{addr: "::ffff:203.0.113.9", want: "203.0.113.0/24"},
+		{addr: "198.51.100.7", want: "198.51.100.7/32"},
+		{addr: "198.51.100.8", want: ""},
+		{addr: "2001:db8::1", want: "2001:db8::/32"},
+		{addr: "93.184.216.34", want: ""},
+		{addr: "127.0.0.1", want: ""},
+	}
+	for _, tt := range addrs {
+		if got := b.blockedAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("blockedAddr(%s) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestHostGuard(t *testing.T) {
+	g := &hostGuard{allowed: []string{"example.com", "*.Staging.Example.com"}, verified: map[string]error{}}
+
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{url: "https://example.com/", ok: true},
+		{url: "https://EXAMPLE.com:8443/", ok: true},
+		{url: "https://api.staging.example.com/", ok: true},
+		{url: "https://staging.example.com/", ok: false},
+		{url: "https://www.example.com/", ok: false},
+		{url: "http://evil.net/", ok: false},
+		{url: "http://localhost:8080/", ok: true},
+		{url: "http://app.localhost/", ok: true},
+		{url: "http://127.0.0.2/", ok: true},
+		{url: "http://[::1]:8080/", ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req := fasthttp.AcquireRequest()
+			defer fasthttp.ReleaseRequest(req)
+			req.SetRequestURI(tt.url)
+			err := g.confirmRedirect(req)
+			if tt.ok {
+				if err != nil {
+					t.Errorf("confirmRedirect() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, errOutOfScope) {
+				t.Errorf("confirmRedirect() error = %v, want %v", err, errOutOfScope)
+			}
+		})
+	}
+}
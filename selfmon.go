@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"dos/internal/limits"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// cpuBoundPercent is the CPU usage from which the generator itself is
+	// considered the bottleneck, once it lasted cpuBoundSeconds.
+	cpuBoundPercent = 90
+	cpuBoundSeconds = 3
+	// openFilesWarnRatio of the open files limit is warned about.
+	openFilesWarnRatio = 0.9
+)
+
+// generatorMonitor samples the resource usage of the load generator itself
+// every second, so that a saturated client isn't mistaken for a slow target.
+type generatorMonitor struct {
+	openFilesLimit uint64
+	socketErrors   int64
+
+	mu         sync.Mutex
+	current    generatorStatus
+	peak       generatorStatus
+	cpuTotal   float64
+	samples    int
+	busy       int
+	warnedCPU  bool
+	warnedFile bool
+}
+
+// generatorStatus is the usage of the load generator. CPUPercent is relative
+// to the GOMAXPROCS cores the process can use; OpenFiles is only counted on
+// linux.
+type generatorStatus struct {
+	CPUPercent   float64 `json:"cpu_percent"`
+	HeapBytes    uint64  `json:"heap_bytes"`
+	Goroutines   int     `json:"goroutines"`
+	OpenFiles    int     `json:"open_files,omitempty"`
+	SocketErrors int64   `json:"socket_errors"`
+}
+
+func newGeneratorMonitor() *generatorMonitor {
+	return &generatorMonitor{openFilesLimit: limits.Detect().OpenFiles}
+}
+
+func (m *generatorMonitor) run(ctx context.Context) {
+	defer crashes.handlePanic("self_monitor", nil)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	lastCPU, lastAt := limits.CPUTime(), time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		cpu, at := limits.CPUTime(), time.Now()
+		m.sample(float64(cpu-lastCPU) / float64(at.Sub(lastAt)) / float64(runtime.GOMAXPROCS(0)) * 100)
+		lastCPU, lastAt = cpu, at
+	}
+}
+
+func (m *generatorMonitor) sample(cpuPercent float64) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s := generatorStatus{
+		CPUPercent: cpuPercent,
+		HeapBytes:  mem.HeapInuse,
+		Goroutines: runtime.NumGoroutine(),
+		OpenFiles:  limits.OpenFiles(),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current = s
+	m.peak.CPUPercent = max(m.peak.CPUPercent, s.CPUPercent)
+	m.peak.HeapBytes = max(m.peak.HeapBytes, s.HeapBytes)
+	m.peak.Goroutines = max(m.peak.Goroutines, s.Goroutines)
+	m.peak.OpenFiles = max(m.peak.OpenFiles, s.OpenFiles)
+	m.cpuTotal += s.CPUPercent
+	m.samples++
+
+	if s.CPUPercent >= cpuBoundPercent {
+		m.busy++
+	} else {
+		m.busy = 0
+	}
+	if m.busy >= cpuBoundSeconds && !m.warnedCPU {
+		m.warnedCPU = true
+		log.Warn().Timestamp().Float64("cpu_percent", s.CPUPercent).Int("gomaxprocs", runtime.GOMAXPROCS(0)).Msg("Load generator is CPU bound, latency and rates may reflect the client rather than the target")
+	}
+	if m.openFilesLimit > 0 && float64(s.OpenFiles) >= openFilesWarnRatio*float64(m.openFilesLimit) && !m.warnedFile {
+		m.warnedFile = true
+		log.Warn().Timestamp().Int("open_files", s.OpenFiles).Uint64("open_files_limit", m.openFilesLimit).Msg("Load generator is close to its open files limit")
+	}
+}
+
+// recordError counts err if it was caused by the generator running out of
+// sockets, ports or buffers rather than by the target.
+func (m *generatorMonitor) recordError(err error) {
+	if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) ||
+		errors.Is(err, syscall.EADDRNOTAVAIL) || errors.Is(err, syscall.ENOBUFS) {
+		atomic.AddInt64(&m.socketErrors, 1)
+	}
+}
+
+// status returns the last sample, or nil before the first one.
+func (m *generatorMonitor) status() *generatorStatus {
+	m.mu.Lock()
+	s, sampled := m.current, m.samples > 0
+	m.mu.Unlock()
+	if !sampled {
+		return nil
+	}
+	s.SocketErrors = atomic.LoadInt64(&m.socketErrors)
+	return &s
+}
+
+// report logs the peak usage of the run, and warns if requests failed on the
+// generator's own sockets.
+func (m *generatorMonitor) report() {
+	m.mu.Lock()
+	peak, avgCPU := m.peak, 0.0
+	if m.samples > 0 {
+		avgCPU = m.cpuTotal / float64(m.samples)
+	}
+	m.mu.Unlock()
+	socketErrors := atomic.LoadInt64(&m.socketErrors)
+
+	log.Info().Timestamp().Float64("average_cpu_percent", avgCPU).Float64("peak_cpu_percent", peak.CPUPercent).Uint64("peak_heap_bytes", peak.HeapBytes).Int("peak_goroutines", peak.Goroutines).Int("peak_open_files", peak.OpenFiles).Int64("socket_errors", socketErrors).Msg("Load generator usage")
+	if socketErrors > 0 {
+		log.Warn().Timestamp().Int64("socket_errors", socketErrors).Msg("Requests failed because the load generator ran out of file descriptors, ports or buffers; these errors say nothing about the target")
+	}
+}
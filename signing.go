@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"dos/internal/tmpl"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// requestSigner adds a signature to a request once it is complete, right
+// before it is sent.
+type requestSigner interface {
+	sign(req *fasthttp.Request)
+}
+
+// signers are set up from the -oauth_*, -hmac_* and -aws_* flags, in that
+// order, so that an HMAC can cover the Bearer token and an AWS signature
+// can't be invalidated by the HMAC header.
+var signers []requestSigner
+
+func newSigners(host string) ([]requestSigner, error) {
+	var list []requestSigner
+	if *oauthTokenURL != "" {
+		var err error
+		oauth, err = newOAuthClient(*oauthTokenURL, *oauthClientID, *oauthSecretFile, *oauthScope, *oauthClientAuth, *oauthRefreshBefore, *requestTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("oauth: %w", err)
+		}
+		list = append(list, oauth)
+	}
+	if *hmacHeader != "" {
+		s, err := newHMACSigner(*hmacHeader, *hmacKeyFile, *hmacAlgorithm, *hmacEncoding, *hmacMessage, *hmacPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("hmac: %w", err)
+		}
+		list = append(list, s)
+	}
+	if *awsSign {
+		s, err := newAWSSigner(host, *awsProfile, *awsRegion, *awsService)
+		if err != nil {
+			return nil, fmt.Errorf("aws_sign: %w", err)
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// hmacSigner sets a header to the HMAC of a message built from the request
+// with the {{method}}, {{path}}, {{host}}, {{body}}, {{body_sha256}} and
+// {{header.<name>}} placeholders.
+type hmacSigner struct {
+	header  string
+	key     []byte
+	hash    func() hash.Hash
+	encode  func([]byte) string
+	message *tmpl.Template
+	prefix  string
+}
+
+func newHMACSigner(header, keyFile, algorithm, encoding, message, prefix string) (*hmacSigner, error) {
+	if keyFile == "" {
+		return nil, errors.New("hmac_key_file is required")
+	}
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	s := &hmacSigner{header: header, key: bytes.TrimRight(key, "\r\n"), prefix: prefix}
+	switch algorithm {
+	case "sha1":
+		s.hash = sha1.New
+	case "sha256":
+		s.hash = sha256.New
+	case "sha512":
+		s.hash = sha512.New
+	default:
+		return nil, fmt.Errorf("unknown algorithm %q (sha1, sha256, sha512)", algorithm)
+	}
+	switch encoding {
+	case "hex":
+		s.encode = hex.EncodeToString
+	case "base64":
+		s.encode = base64.StdEncoding.EncodeToString
+	default:
+		return nil, fmt.Errorf("unknown encoding %q (hex, base64)", encoding)
+	}
+	if s.message, err = tmpl.Parse(message); err != nil {
+		return nil, err
+	}
+	for _, name := range s.message.Names() {
+		switch {
+		case name == "method", name == "path", name == "host", name == "body", name == "body_sha256":
+		case strings.HasPrefix(name, "header."):
+		default:
+			return nil, fmt.Errorf("%q: unknown placeholder {{%s}}", message, name)
+		}
+	}
+	return s, nil
+}
+
+func (s *hmacSigner) sign(req *fasthttp.Request) {
+	message := s.message.Expand(func(name string) string {
+		switch name {
+		case "method":
+			return string(req.Header.Method())
+		case "path":
+			return string(req.URI().RequestURI())
+		case "host":
+			return string(req.URI().Host())
+		case "body":
+			return string(req.Body())
+		case "body_sha256":
+			sum := sha256.Sum256(req.Body())
+			return hex.EncodeToString(sum[:])
+		}
+		return string(req.Header.Peek(strings.TrimPrefix(name, "header.")))
+	})
+	mac := hmac.New(s.hash, s.key)
+	mac.Write([]byte(message))
+	req.Header.Set(s.header, s.prefix+s.encode(mac.Sum(nil)))
+}
+
+// awsSigner signs requests with AWS Signature Version 4.
+type awsSigner struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	region       string
+	service      string
+}
+
+// awsHost matches <service>.<region>.amazonaws.com and similar endpoints,
+// with anything such as a bucket or API id before them.
+var awsHost = regexp.MustCompile(`(?:^|\.)([a-z0-9-]+)\.([a-z]{2}(?:-gov)?-[a-z]+-\d)\.(?:amazonaws\.com|on\.aws)$`)
+
+func newAWSSigner(host, profile, region, service string) (*awsSigner, error) {
+	s := &awsSigner{region: cmp.Or(region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")), service: service}
+	if m := awsHost.FindStringSubmatch(strings.ToLower(host)); m != nil {
+		s.service = cmp.Or(s.service, strings.TrimSuffix(m[1], "-url"))
+		s.region = cmp.Or(s.region, m[2])
+	}
+	if s.service == "" || s.region == "" {
+		return nil, fmt.Errorf("can't tell the service and region of %s, set -aws_service and -aws_region", host)
+	}
+
+	// like the AWS CLI, keys in the environment take precedence unless a
+	// profile is asked for
+	if profile == "" && os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+		s.accessKey, s.secretKey, s.sessionToken = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+	} else if err := s.loadProfile(cmp.Or(profile, os.Getenv("AWS_PROFILE"), "default")); err != nil {
+		return nil, err
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, errors.New("no AWS credentials found")
+	}
+	return s, nil
+}
+
+// loadProfile reads the keys of profile from the shared credentials file.
+func (s *awsSigner) loadProfile(profile string) error {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	found, section := false, ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			found = found || section == profile
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			s.accessKey = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			s.secretKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			s.sessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("profile %q not found in %s", profile, path)
+	}
+	return nil
+}
+
+func (s *awsSigner) sign(req *fasthttp.Request) {
+	s.signAt(req, time.Now())
+}
+
+func (s *awsSigner) signAt(req *fasthttp.Request, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + s.region + "/" + s.service + "/aws4_request"
+	payload := sha256.Sum256(req.Body())
+	payloadHash := hex.EncodeToString(payload[:])
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	host := string(req.Header.Host())
+	if host == "" {
+		host = string(req.URI().Host())
+	}
+	headers := map[string]string{"host": host}
+	for key, value := range req.Header.All() {
+		name := strings.ToLower(string(key))
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" {
+			headers[name] = strings.Join(strings.Fields(string(value)), " ")
+		}
+	}
+	names := slices.Sorted(maps.Keys(headers))
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := awsEscape(string(req.URI().Path()), false)
+	if s.service != "s3" {
+		path = awsEscape(path, false)
+	}
+	canonicalRequest := strings.Join([]string{
+		string(req.Header.Method()),
+		path,
+		awsCanonicalQuery(req.URI().QueryArgs()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{amzDate[:8], s.region, s.service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set(fasthttp.HeaderAuthorization, "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsCanonicalQuery sorts and escapes query arguments as SigV4 requires.
+func awsCanonicalQuery(args *fasthttp.Args) string {
+	var pairs [][2]string
+	for key, value := range args.All() {
+		pairs = append(pairs, [2]string{awsEscape(string(key), true), awsEscape(string(value), true)})
+	}
+	slices.SortFunc(pairs, func(a, b [2]string) int { return cmp.Or(strings.Compare(a[0], b[0]), strings.Compare(a[1], b[1])) })
+	var b strings.Builder
+	for i, pair := range pairs {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(pair[0] + "=" + pair[1])
+	}
+	return b.String()
+}
+
+// awsEscape percent-encodes everything but unreserved characters, and
+// slashes unless escapeSlash is set.
+func awsEscape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"dos/internal/config"
+	"dos/internal/expr"
+	"dos/internal/metrics"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	stagePending = "pending"
+	stageRunning = "running"
+	stagePassed  = "passed"
+	stageFailed  = "failed"
+	stageSkipped = "skipped"
+)
+
+// stageConfig is one stage of the run. RPS and VUs, if set, change the
+// request rate and the number of active virtual users when the stage starts;
+// otherwise those of the previous stage stay in effect.
+type stageConfig struct {
+	Name     string          `json:"name"`
+	Duration config.Duration `json:"duration"`
+	RPS      float64         `json:"rps"`
+	VUs      int             `json:"vus"`
+}
+
+// thresholdConfig is an assertion over the statistics of one stage, or of
+// the whole run if Stage is empty. Thresholds with Abort stop the run as soon
+// as they fail instead of only being reported at the end.
+type thresholdConfig struct {
+	Stage       string `json:"stage"`
+	Condition   string `json:"condition"`
+	Abort       bool   `json:"abort"`
+	MinRequests uint64 `json:"min_requests"`
+}
+
+var (
+	stageConfigs     []stageConfig
+	thresholdConfigs []thresholdConfig
+)
+
+type stage struct {
+	name     string
+	offset   time.Duration
+	duration time.Duration
+	rps      float64
+	vus      int
+	rec      *metrics.Recorder
+	status   string
+}
+
+type threshold struct {
+	thresholdConfig
+	cond   *expr.Condition
+	stage  *stage
+	failed bool
+	values map[string]float64
+}
+
+type stagePlan struct {
+	mu          sync.Mutex
+	stages      []*stage
+	thresholds  []*threshold
+	overall     *metrics.Recorder
+	measureFrom time.Time
+	endedAt     time.Time
+}
+
+func newStagePlan(stageCfgs []stageConfig, thresholdCfgs []thresholdConfig) (*stagePlan, error) {
+	p := &stagePlan{overall: metrics.NewRecorder()}
+	byName := map[string]*stage{}
+
+	var offset time.Duration
+	for i, cfg := range stageCfgs {
+		if cfg.Duration <= 0 {
+			return nil, fmt.Errorf("stages: stage %d has no duration", i+1)
+		}
+		name := cfg.Name
+		if name == "" {
+			name = fmt.Sprintf("stage-%d", i+1)
+		}
+		if byName[name] != nil {
+			return nil, fmt.Errorf("stages: duplicate stage name %q", name)
+		}
+		if cfg.RPS < 0 || cfg.VUs < 0 {
+			return nil, fmt.Errorf("stages: stage %q has a negative rps or vus", name)
+		}
+		s := &stage{name: name, offset: offset, duration: time.Duration(cfg.Duration), rps: cfg.RPS, vus: cfg.VUs, rec: metrics.NewRecorder(), status: stagePending}
+		byName[name] = s
+		p.stages = append(p.stages, s)
+		offset += s.duration
+	}
+
+	for _, cfg := range thresholdCfgs {
+		cond, err := expr.Parse(cfg.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("thresholds: %w", err)
+		}
+		if _, err := cond.Eval(metrics.Snapshot{}.Vars()); err != nil {
+			return nil, fmt.Errorf("thresholds: %q: %w", cfg.Condition, err)
+		}
+		t := &threshold{thresholdConfig: cfg, cond: cond}
+		if cfg.Stage != "" {
+			t.stage = byName[cfg.Stage]
+			if t.stage == nil {
+				return nil, fmt.Errorf("thresholds: %q refers to unknown stage %q", cfg.Condition, cfg.Stage)
+			}
+		}
+		p.thresholds = append(p.thresholds, t)
+	}
+
+	return p, nil
+}
+
+func (p *stagePlan) duration() time.Duration {
+	if len(p.stages) == 0 {
+		return 0
+	}
+	last := p.stages[len(p.stages)-1]
+	return last.offset + last.duration
+}
+
+func (p *stagePlan) start(measureFrom time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.measureFrom = measureFrom
+}
+
+// stageAt returns the stage that runs at the given time. During warm-up,
+// that is the first stage, so that warm-up runs at its load.
+func (p *stagePlan) stageAt(at time.Time) *stage {
+	elapsed := max(at.Sub(p.measureFrom), 0)
+	for _, s := range p.stages {
+		if elapsed >= s.offset && elapsed < s.offset+s.duration {
+			return s
+		}
+	}
+	return nil
+}
+
+func (p *stagePlan) record(at time.Time, res *Result) {
+	failed := res.err != nil
+	p.overall.Record(res.duration, failed)
+	if s := p.stageAt(at); s != nil {
+		s.rec.Record(res.duration, failed)
+	}
+}
+
+// watch advances stages as time passes and checks abort thresholds once a
+// second, cancelling the run when one fails.
+func (p *stagePlan) watch(ctx context.Context, cancel context.CancelFunc) {
+	defer crashes.handlePanic("stages", nil)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	lastCheck := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.advance(now)
+			if now.Sub(lastCheck) < time.Second {
+				continue
+			}
+			lastCheck = now
+			if p.checkAbort(now) {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+func (p *stagePlan) advance(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	current := p.stageAt(now)
+	for _, s := range p.stages {
+		switch {
+		case s.status == stageRunning && s != current:
+			p.finishStage(s, now)
+		case s.status == stagePending && s == current:
+			s.status = stageRunning
+			log.Info().Timestamp().Str("stage", s.name).Dur("duration", s.duration).Float64("rps", s.rps).Int("vus", s.vus).Msg("Stage started")
+			// the first stage's phase starts when warm-up ends
+			if !now.Before(p.measureFrom) {
+				setPhase("stage:" + s.name)
+			}
+			s.applyLoad()
+		}
+	}
+}
+
+// applyLoad switches to the request rate and virtual users of s.
+func (s *stage) applyLoad() {
+	if s.rps > 0 {
+		limiter.SetLimit(rate.Limit(s.rps))
+		events.emit(eventRateChanged, map[string]any{"rps": s.rps, "stage": s.name})
+	}
+	if s.vus > 0 && activeUsers != nil {
+		activeUsers.set(s.vus)
+	}
+}
+
+// stageLoad reports the highest rps and vus set by any stage.
+func stageLoad(cfgs []stageConfig) (rps float64, vus int) {
+	for _, cfg := range cfgs {
+		rps = max(rps, cfg.RPS)
+		vus = max(vus, cfg.VUs)
+	}
+	return rps, vus
+}
+
+// elapsed returns how much of s had run by now.
+func (p *stagePlan) elapsed(s *stage, now time.Time) time.Duration {
+	return min(s.duration, max(now.Sub(p.measureFrom)-s.offset, 0))
+}
+
+func (p *stagePlan) finishStage(s *stage, now time.Time) {
+	if s.status == stageRunning {
+		s.status = stagePassed
+	}
+	for _, t := range p.thresholds {
+		if t.stage == s && !p.evaluate(t, s.rec.Snapshot(p.elapsed(s, now))) {
+			s.status = stageFailed
+		}
+	}
+	log.Info().Timestamp().Str("stage", s.name).Str("status", s.status).Msg("Stage finished")
+}
+
+func (p *stagePlan) checkAbort(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, t := range p.thresholds {
+		if !t.Abort || t.failed {
+			continue
+		}
+		var snap metrics.Snapshot
+		switch {
+		case t.stage == nil:
+			snap = p.overall.Snapshot(now.Sub(p.measureFrom))
+		case t.stage.status == stageRunning:
+			snap = t.stage.rec.Snapshot(p.elapsed(t.stage, now))
+		default:
+			continue
+		}
+		if snap.Requests < t.MinRequests || snap.Requests == 0 {
+			continue
+		}
+		if !p.evaluate(t, snap) {
+			log.Error().Timestamp().Str("stage", t.Stage).Str("condition", t.Condition).Msg("Threshold breached, aborting run")
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate checks t against snap and reports whether it held. A failed
+// threshold stays failed.
+func (p *stagePlan) evaluate(t *threshold, snap metrics.Snapshot) bool {
+	if snap.Requests < t.MinRequests {
+		return !t.failed
+	}
+	vars := snap.Vars()
+	ok, err := t.cond.Eval(vars)
+	if err != nil || !ok {
+		if !t.failed {
+			t.failed = true
+			t.values = vars
+			events.emit(eventThresholdBreached, map[string]any{"stage": t.Stage, "condition": t.Condition, "abort": t.Abort})
+		}
+		return false
+	}
+	return !t.failed
+}
+
+// finish closes the running stage, marks stages that never ran as skipped
+// and evaluates whole-run thresholds.
+func (p *stagePlan) finish(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.endedAt = now
+	for _, s := range p.stages {
+		switch s.status {
+		case stageRunning:
+			p.finishStage(s, now)
+		case stagePending:
+			s.status = stageSkipped
+		}
+	}
+	for _, t := range p.thresholds {
+		if t.stage == nil {
+			p.evaluate(t, p.overall.Snapshot(now.Sub(p.measureFrom)))
+		}
+	}
+}
+
+// report logs the outcome of every stage and threshold and reports whether
+// any threshold failed.
+func (p *stagePlan) report() (failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, s := range p.stages {
+		snap := s.rec.Snapshot(p.elapsed(s, p.endedAt))
+		log.Info().Timestamp().Str("stage", s.name).Str("status", s.status).Uint64("requests", snap.Requests).Float64("error_rate", snap.ErrorRate).Float64("requests_per_second", snap.RPS).Dur("p95", snap.P95).Dur("p99", snap.P99).Msg("Stage summary")
+	}
+	for _, t := range p.thresholds {
+		evt := log.Info()
+		if t.failed {
+			evt = log.Error()
+			failed = true
+		}
+		evt = evt.Timestamp().Str("condition", t.Condition).Bool("passed", !t.failed)
+		if t.Stage != "" {
+			evt = evt.Str("stage", t.Stage)
+		}
+		for _, name := range t.cond.Names() {
+			if v, ok := t.values[name]; ok {
+				evt = evt.Float64(name, v)
+			}
+		}
+		evt.Msg("Threshold result")
+	}
+	return failed
+}
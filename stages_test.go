@@ -0,0 +1,59 @@
+package main
+
+import (
+	"dos/internal/config"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestStagesApplyLoadDuringWarmup(t *testing.T) {
+	defer func(l *rate.Limiter, a *activeVUs) { limiter, activeUsers = l, a }(limiter, activeUsers)
+	limiter = rate.NewLimiter(rate.Inf, 1)
+	activeUsers = newActiveVUs(50)
+
+	p, err := newStagePlan([]stageConfig{
+		{Name: "baseline", Duration: config.Duration(time.Minute), RPS: 10, VUs: 5},
+		{Name: "spike", Duration: config.Duration(time.Minute), RPS: 100, VUs: 50},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	warmup := 30 * time.Second
+	p.start(start.Add(warmup))
+
+	tests := []struct {
+		name  string
+		at    time.Duration
+		stage string
+		rps   float64
+		vus   int
+	}{
+		{name: "warm-up start", at: 0, stage: "baseline", rps: 10, vus: 5},
+		{name: "warm-up end", at: warmup - time.Millisecond, stage: "baseline", rps: 10, vus: 5},
+		{name: "first stage", at: warmup + 30*time.Second, stage: "baseline", rps: 10, vus: 5},
+		{name: "second stage", at: warmup + 90*time.Second, stage: "spike", rps: 100, vus: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := start.Add(tt.at)
+			if s := p.stageAt(at); s == nil || s.name != tt.stage {
+				t.Fatalf("stageAt(%v) = %v, want %s", tt.at, s, tt.stage)
+			}
+			p.advance(at)
+			if got := float64(limiter.Limit()); got != tt.rps {
+				t.Errorf("rps = %v, want %v", got, tt.rps)
+			}
+			if got := activeUsers.get(); got != tt.vus {
+				t.Errorf("vus = %d, want %d", got, tt.vus)
+			}
+		})
+	}
+
+	// warm-up doesn't shorten the first stage
+	if got := p.elapsed(p.stages[0], start.Add(warmup+30*time.Second)); got != 30*time.Second {
+		t.Errorf("elapsed = %v, want 30s", got)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"dos/internal/metrics"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type runStats struct {
+	// attempted counts the requests launched outside of warm-up, recorded
+	// those recorded with any outcome, of which unsent failed before reaching
+	// the target and completed got a response.
+	attempted     int64
+	recorded      int64
+	unsent        int64
+	completed     int64
+	errors        int64
+	totalDuration int64
+	bytes         int64
+	firstFailures int64
+	retries       int64
+	recovered     int64
+	dropped       int64
+	// deadline is when -exec_time ends the run, zero without it.
+	deadline     time.Time
+	decompressed int64
+	compressed   int64
+	// latency is only kept if launches follow a schedule or there is a
+	// baseline to compare with, corrected only in the first case.
+	latency    *metrics.Histogram
+	corrected  *metrics.Histogram
+	baseline   *baselineSummary
+	series     *timeSeries
+	intervals  *intervalWriter
+	results    *resultWriter
+	rolling    *metrics.Rolling
+	stages     *stagePlan
+	budget     *errorBudget
+	breaker    *circuitBreaker
+	auto       *autoSearch
+	generator  *generatorMonitor
+	errorTypes *namedStats
+	endpoints  *endpointStats
+	slos       []*serviceLevel
+}
+
+type statsSnapshot struct {
+	SentRequests           int64             `json:"sent_requests"`
+	RecordedRequests       int64             `json:"recorded_requests"`
+	AttemptedRequests      int64             `json:"attempted_requests"`
+	UnsentRequests         int64             `json:"unsent_requests"`
+	CompletedRequests      int64             `json:"completed_requests"`
+	InFlightRequests       int64             `json:"in_flight_requests"`
+	Errors                 int64             `json:"errors"`
+	AverageRequestDuration float64           `json:"average_request_duration"`
+	RequestsPerSecond      float64           `json:"requests_per_second"`
+	BytesReceived          int64             `json:"bytes_received"`
+	AverageResponseSize    float64           `json:"average_response_size"`
+	ThroughputMBps         float64           `json:"throughput_mb_per_second"`
+	FirstAttemptFailures   int64             `json:"first_attempt_failures,omitempty"`
+	Retries                int64             `json:"retries,omitempty"`
+	RecoveredRequests      int64             `json:"recovered_requests,omitempty"`
+	DroppedArrivals        int64             `json:"dropped_arrivals,omitempty"`
+	RemainingSeconds       float64           `json:"remaining_seconds,omitempty"`
+	BytesDecompressed      int64             `json:"bytes_decompressed,omitempty"`
+	CompressedResponses    int64             `json:"compressed_responses,omitempty"`
+	ErrorBudget            *budgetStatus     `json:"error_budget,omitempty"`
+	Latency                *latencySummary   `json:"latency,omitempty"`
+	CorrectedLatency       *latencySummary   `json:"corrected_latency,omitempty"`
+	Baseline               *baselineSummary  `json:"baseline,omitempty"`
+	Generator              *generatorStatus  `json:"generator,omitempty"`
+	ErrorTypes             map[string]int64  `json:"error_types,omitempty"`
+	Endpoints              []endpointSummary `json:"endpoints,omitempty"`
+	SLOs                   []sloStatus       `json:"slos,omitempty"`
+}
+
+func (s *runStats) snapshot(elapsed time.Duration) statsSnapshot {
+	snap := statsSnapshot{
+		RecordedRequests:     atomic.LoadInt64(&s.recorded),
+		AttemptedRequests:    atomic.LoadInt64(&s.attempted),
+		UnsentRequests:       atomic.LoadInt64(&s.unsent),
+		CompletedRequests:    atomic.LoadInt64(&s.completed),
+		Errors:               atomic.LoadInt64(&s.errors),
+		BytesReceived:        atomic.LoadInt64(&s.bytes),
+		FirstAttemptFailures: atomic.LoadInt64(&s.firstFailures),
+		Retries:              atomic.LoadInt64(&s.retries),
+		RecoveredRequests:    atomic.LoadInt64(&s.recovered),
+		DroppedArrivals:      atomic.LoadInt64(&s.dropped),
+		BytesDecompressed:    atomic.LoadInt64(&s.decompressed),
+		CompressedResponses:  atomic.LoadInt64(&s.compressed),
+	}
+	// attempted is loaded after recorded, so this can't be negative
+	snap.InFlightRequests = max(snap.AttemptedRequests-snap.RecordedRequests, 0)
+	snap.SentRequests = max(snap.RecordedRequests-snap.UnsentRequests, 0)
+	if snap.RecordedRequests > 0 {
+		snap.AverageRequestDuration = float64(atomic.LoadInt64(&s.totalDuration)) / float64(snap.RecordedRequests)
+		snap.AverageResponseSize = float64(snap.BytesReceived) / float64(snap.RecordedRequests)
+	}
+	if elapsed > 0 {
+		snap.RequestsPerSecond = float64(snap.RecordedRequests) / elapsed.Seconds()
+		snap.ThroughputMBps = float64(snap.BytesReceived) / 1e6 / elapsed.Seconds()
+	}
+	if s.budget != nil {
+		snap.ErrorBudget = s.budget.status()
+	}
+	if s.errorTypes != nil {
+		snap.ErrorTypes = s.errorTypes.counts()
+	}
+	if s.endpoints != nil {
+		snap.Endpoints = s.endpoints.summaries()
+	}
+	snap.SLOs = sloStatuses(s.slos)
+	if s.latency != nil {
+		snap.Latency = newLatencySummary(s.latency)
+	}
+	if s.corrected != nil {
+		snap.CorrectedLatency = newLatencySummary(s.corrected)
+	}
+	snap.Baseline = s.baseline
+	if !s.deadline.IsZero() {
+		snap.RemainingSeconds = max(time.Until(s.deadline), 0).Seconds()
+	}
+	if s.generator != nil {
+		snap.Generator = s.generator.status()
+	}
+	return snap
+}
+
+// latencySummary holds latency percentiles in nanoseconds.
+type latencySummary struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+func newLatencySummary(h *metrics.Histogram) *latencySummary {
+	return &latencySummary{P50: h.Quantile(0.50), P90: h.Quantile(0.90), P99: h.Quantile(0.99), Max: h.Max()}
+}
+
+type timeSeries struct {
+	mu      sync.Mutex
+	start   time.Time
+	budget  *errorBudget
+	probe   *healthProbe
+	buckets []seriesBucket
+}
+
+type seriesBucket struct {
+	Second        int           `json:"second"`
+	Requests      int64         `json:"requests"`
+	Errors        int64         `json:"errors"`
+	BytesReceived int64         `json:"bytes_received"`
+	AvgLatencyMs  float64       `json:"avg_latency_ms"`
+	MinLatencyMs  float64       `json:"min_latency_ms"`
+	MaxLatencyMs  float64       `json:"max_latency_ms"`
+	ErrorBudget   *budgetStatus `json:"error_budget,omitempty"`
+	Probe         *probeResult  `json:"probe,omitempty"`
+	bad           int64
+	totalDuration time.Duration
+	minDuration   time.Duration
+	maxDuration   time.Duration
+}
+
+// newTimeSeries returns an empty series. If budget is set, every bucket also
+// carries the burn rate of that second and the budget left at its end. If
+// probe is set, buckets carry the health probe result of that second.
+func newTimeSeries(start time.Time, budget *errorBudget, probe *healthProbe) *timeSeries {
+	return &timeSeries{start: start, budget: budget, probe: probe}
+}
+
+func (ts *timeSeries) add(at time.Time, res *Result) {
+	second := int(at.Sub(ts.start) / time.Second)
+	if second < 0 {
+		return
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for len(ts.buckets) <= second {
+		ts.buckets = append(ts.buckets, seriesBucket{Second: len(ts.buckets)})
+	}
+	b := &ts.buckets[second]
+	b.Requests++
+	if res.err != nil {
+		b.Errors++
+	}
+	b.BytesReceived += res.bytes
+	if ts.budget != nil && ts.budget.isBad(res) {
+		b.bad++
+	}
+	b.totalDuration += res.duration
+	if b.Requests == 1 || res.duration < b.minDuration {
+		b.minDuration = res.duration
+	}
+	if res.duration > b.maxDuration {
+		b.maxDuration = res.duration
+	}
+}
+
+func (ts *timeSeries) snapshot() []seriesBucket {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	var probes map[int]*probeResult
+	if ts.probe != nil {
+		probes = ts.probe.bySecond(ts.start)
+	}
+
+	out := make([]seriesBucket, len(ts.buckets))
+	var total, bad int64
+	for i, b := range ts.buckets {
+		if b.Requests > 0 {
+			b.AvgLatencyMs = durationMs(b.totalDuration) / float64(b.Requests)
+			b.MinLatencyMs = durationMs(b.minDuration)
+			b.MaxLatencyMs = durationMs(b.maxDuration)
+		}
+		if ts.budget != nil {
+			total += b.Requests
+			bad += b.bad
+			b.ErrorBudget = &budgetStatus{
+				BadRequests:     b.bad,
+				BurnRate:        ts.budget.statusOf(b.Requests, b.bad).BurnRate,
+				BudgetRemaining: ts.budget.statusOf(total, bad).BudgetRemaining,
+			}
+		}
+		b.Probe = probes[b.Second]
+		out[i] = b
+	}
+	return out
+}
+
+func (ts *timeSeries) write(w io.Writer, format string) error {
+	buckets := ts.snapshot()
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		header := []string{"second", "requests", "errors", "bytes_received", "avg_latency_ms", "min_latency_ms", "max_latency_ms"}
+		if ts.budget != nil {
+			header = append(header, "bad_requests", "burn_rate", "budget_remaining")
+		}
+		if ts.probe != nil {
+			header = append(header, "probe_status", "probe_latency_ms", "probe_error")
+		}
+		cw.Write(header)
+		for _, b := range buckets {
+			row := []string{
+				strconv.Itoa(b.Second),
+				strconv.FormatInt(b.Requests, 10),
+				strconv.FormatInt(b.Errors, 10),
+				strconv.FormatInt(b.BytesReceived, 10),
+				strconv.FormatFloat(b.AvgLatencyMs, 'f', 3, 64),
+				strconv.FormatFloat(b.MinLatencyMs, 'f', 3, 64),
+				strconv.FormatFloat(b.MaxLatencyMs, 'f', 3, 64),
+			}
+			if b.ErrorBudget != nil {
+				row = append(row,
+					strconv.FormatInt(b.ErrorBudget.BadRequests, 10),
+					strconv.FormatFloat(b.ErrorBudget.BurnRate, 'f', 3, 64),
+					strconv.FormatFloat(b.ErrorBudget.BudgetRemaining, 'f', 4, 64),
+				)
+			}
+			if ts.probe != nil {
+				if b.Probe != nil {
+					row = append(row, strconv.Itoa(b.Probe.Status), strconv.FormatFloat(b.Probe.LatencyMs, 'f', 3, 64), b.Probe.Error)
+				} else {
+					row = append(row, "", "", "")
+				}
+			}
+			cw.Write(row)
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(buckets)
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type namedStats struct {
+	mu    sync.Mutex
+	names []string
+	stats map[string]*namedStat
+}
+
+type namedStat struct {
+	count         int64
+	totalDuration time.Duration
+}
+
+func newNamedStats() *namedStats {
+	return &namedStats{stats: map[string]*namedStat{}}
+}
+
+func (n *namedStats) add(name string, d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	stat, ok := n.stats[name]
+	if !ok {
+		stat = &namedStat{}
+		n.stats[name] = stat
+		n.names = append(n.names, name)
+	}
+	stat.count++
+	stat.totalDuration += d
+}
+
+func (n *namedStats) counts() map[string]int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	out := make(map[string]int64, len(n.stats))
+	for name, stat := range n.stats {
+		out[name] = stat.count
+	}
+	return out
+}
+
+// each calls fn for every name in the order it was first seen, with the
+// average duration in nanoseconds.
+func (n *namedStats) each(fn func(name string, count int64, avgDuration float64)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, name := range n.names {
+		stat := n.stats[name]
+		fn(name, stat.count, float64(stat.totalDuration)/float64(stat.count))
+	}
+}
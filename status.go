@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"dos/internal/util"
+	"encoding/json"
+	"time"
+)
+
+type statusFileWriter struct {
+	path        string
+	stats       *runStats
+	measureFrom time.Time
+	ctx         context.Context
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+type runStatus struct {
+	Run            *runMetadata `json:"run,omitempty"`
+	Phase          string       `json:"phase"`
+	Timestamp      int64        `json:"timestamp"`
+	ElapsedSeconds float64      `json:"elapsed_seconds"`
+	statsSnapshot
+}
+
+func newStatusFileWriter(ctx context.Context, path string, stats *runStats, measureFrom time.Time) *statusFileWriter {
+	return &statusFileWriter{
+		path:        path,
+		stats:       stats,
+		measureFrom: measureFrom,
+		ctx:         ctx,
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+}
+
+func (w *statusFileWriter) run() {
+	defer close(w.stopped)
+	defer crashes.handlePanic("status_file", nil)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.write(runPhase(w.ctx, w.measureFrom), w.stats.snapshot(time.Since(w.measureFrom)))
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *statusFileWriter) stop(summary statsSnapshot) {
+	close(w.done)
+	<-w.stopped
+	w.write("finished", summary)
+}
+
+func (w *statusFileWriter) write(phase string, snap statsSnapshot) {
+	elapsed := time.Since(w.measureFrom)
+	if elapsed < 0 {
+		elapsed = 0
+		snap = statsSnapshot{}
+	}
+	data, err := json.Marshal(runStatus{
+		Run:            runInfo,
+		Phase:          phase,
+		Timestamp:      time.Now().Unix(),
+		ElapsedSeconds: elapsed.Seconds(),
+		statsSnapshot:  snap,
+	})
+	if err != nil {
+		log.Error().Timestamp().Err(err).Msg("Failed to encode status")
+		return
+	}
+	if err := util.WriteFileAtomic(w.path, data); err != nil {
+		log.Error().Timestamp().Err(err).Str("status_file", w.path).Msg("Failed to write status file")
+	}
+}
+
+func runPhase(ctx context.Context, measureFrom time.Time) string {
+	switch {
+	case ctx.Err() != nil:
+		return "draining"
+	case time.Now().Before(measureFrom):
+		return "warmup"
+	}
+	return "running"
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// runSummary is the final report printed with -summary_format.
+type runSummary struct {
+	Run             *runMetadata `json:"run,omitempty"`
+	URL             string       `json:"url,omitempty"`
+	DurationSeconds float64      `json:"duration_seconds"`
+	Failed          bool         `json:"failed"`
+	statsSnapshot
+}
+
+func writeSummary(w io.Writer, format string, sum runSummary) error {
+	if format == "json" {
+		return json.NewEncoder(w).Encode(sum)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if sum.URL != "" {
+		fmt.Fprintf(tw, "URL\t%s\n", sum.URL)
+	}
+	if sum.Run != nil {
+		fmt.Fprintf(tw, "Run\t%s\n", sum.Run.RunID)
+	}
+	fmt.Fprintf(tw, "Duration\t%s\n", time.Duration(sum.DurationSeconds*float64(time.Second)).Round(time.Millisecond))
+	errorRate := 0.0
+	if sum.RecordedRequests > 0 {
+		errorRate = float64(sum.Errors) / float64(sum.RecordedRequests) * 100
+	}
+	fmt.Fprintf(tw, "Requests\t%d (%d sent, %d completed, %d errors, %.2f%%)\n", sum.RecordedRequests, sum.SentRequests, sum.CompletedRequests, sum.Errors, errorRate)
+	fmt.Fprintf(tw, "Rate\t%.1f requests/s\n", sum.RequestsPerSecond)
+	fmt.Fprintf(tw, "Average latency\t%s\n", time.Duration(sum.AverageRequestDuration).Round(time.Microsecond))
+	if l := sum.Latency; l != nil {
+		fmt.Fprintf(tw, "Latency\tp50 %s, p90 %s, p99 %s, max %s\n", l.P50.Round(time.Microsecond), l.P90.Round(time.Microsecond), l.P99.Round(time.Microsecond), l.Max.Round(time.Microsecond))
+	}
+	fmt.Fprintf(tw, "Received\t%d bytes (%.3f MB/s)\n", sum.BytesReceived, sum.ThroughputMBps)
+	for _, class := range slices.Sorted(maps.Keys(sum.ErrorTypes)) {
+		fmt.Fprintf(tw, "Errors: %s\t%d\n", class, sum.ErrorTypes[class])
+	}
+	for _, slo := range sum.SLOs {
+		result := "met"
+		if !slo.Met {
+			result = "missed"
+		}
+		fmt.Fprintf(tw, "SLO: %s\t%.3f%% of %d requests good (target %g%%), %s, burn rate %.2f, %.0f%% of budget left\n", slo.Name, slo.Compliance, slo.Requests, slo.Target, result, slo.BurnRate, slo.BudgetRemaining*100)
+	}
+	for _, ep := range sum.Endpoints {
+		fmt.Fprintf(tw, "Endpoint: %s\t%d requests, %d errors, %d non-2xx, p50 %s, p99 %s\n", ep.Endpoint, ep.Requests, ep.Errors, ep.Non2xx, ep.Latency.P50.Round(time.Microsecond), ep.Latency.P99.Round(time.Microsecond))
+	}
+	if sum.Failed {
+		fmt.Fprintf(tw, "Result\tfailed\n")
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"dos/internal/config"
+	"dos/internal/tmpl"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/time/rate"
+)
+
+type requestSpec struct {
+	Name    string            `json:"name"`
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+
+	url     *tmpl.Template
+	headers map[string]*tmpl.Template
+	body    *tmpl.Template
+	// endpoint groups the statistics of replayed requests.
+	endpoint string
+}
+
+func (r *requestSpec) label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.method() + " " + r.URL
+}
+
+func (r *requestSpec) method() string {
+	if r.Method == "" {
+		return fasthttp.MethodGet
+	}
+	return strings.ToUpper(r.Method)
+}
+
+// compile parses the placeholders in the URL, headers and body.
+func (r *requestSpec) compile() error {
+	var err error
+	if r.url, err = parseTemplate(r.URL); err != nil {
+		return err
+	}
+	if r.body, err = parseTemplate(r.Body); err != nil {
+		return err
+	}
+	r.headers = make(map[string]*tmpl.Template, len(r.Headers))
+	for k, v := range r.Headers {
+		if r.headers[k], err = parseTemplate(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply overrides the parts of req that are set in the spec, expanding
+// placeholders with vars.
+func (r *requestSpec) apply(req *fasthttp.Request, vars *requestVars) {
+	if r.URL != "" {
+		req.SetRequestURI(r.url.Expand(vars.lookup))
+	}
+	if r.Method != "" {
+		req.Header.SetMethod(r.method())
+	}
+	for k, v := range r.headers {
+		req.Header.Set(k, v.Expand(vars.lookup))
+	}
+	if r.Body != "" {
+		req.SetBodyString(r.body.Expand(vars.lookup))
+	}
+}
+
+type teardownConfig struct {
+	Delay config.Duration `json:"delay"`
+	Steps []requestSpec   `json:"steps"`
+}
+
+var teardown *teardownConfig
+
+func runTeardown(ctx context.Context, steps []requestSpec, delay, timeout time.Duration) {
+	var limiter *rate.Limiter
+	if delay > 0 {
+		limiter = rate.NewLimiter(rate.Every(delay), 1)
+	}
+
+	log.Info().Timestamp().Int("steps", len(steps)).Msg("Running teardown")
+	stats := &runStats{}
+	startedAt := time.Now()
+
+	for i := range steps {
+		step := &steps[i]
+		if limiter != nil {
+			if err := limiter.Wait(ctx); err != nil {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		step.apply(req, &requestVars{})
+		if *userAgent != "" {
+			req.Header.SetUserAgent(*userAgent)
+		}
+		// signed like the requests of the run, so cleanup endpoints that
+		// require the same credentials accept them
+		for _, s := range signers {
+			s.sign(req)
+		}
+
+		start := time.Now()
+		err := client.DoTimeout(req, resp, timeout)
+		duration := time.Since(start)
+		if err == nil && resp.StatusCode() >= 300 {
+			err = fmt.Errorf("unexpected status %d", resp.StatusCode())
+		}
+		status := resp.StatusCode()
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+
+		stats.recorded++
+		stats.totalDuration += int64(duration)
+		if err != nil {
+			stats.errors++
+			log.Warn().Timestamp().Err(err).Str("step", step.label()).Int("status", status).Msg("Teardown step failed")
+			continue
+		}
+		log.Debug().Timestamp().Str("step", step.label()).Int("status", status).Dur("duration", duration).Send()
+	}
+
+	summary := stats.snapshot(time.Since(startedAt))
+	events.emit(eventTeardownEnded, map[string]any{"requests": summary.RecordedRequests, "errors": summary.Errors, "skipped": len(steps) - int(summary.RecordedRequests)})
+	log.Info().Timestamp().Int64("requests", summary.RecordedRequests).Int64("errors", summary.Errors).Float64("average_request_duration", summary.AverageRequestDuration).Int("skipped", len(steps)-int(summary.RecordedRequests)).Msg("Teardown finished")
+}
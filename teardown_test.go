@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+type headerSigner struct{ name, value string }
+
+func (s headerSigner) sign(req *fasthttp.Request) { req.Header.Set(s.name, s.value) }
+
+func TestTeardownSignsSteps(t *testing.T) {
+	defer func(c *fasthttp.Client, s []requestSigner) { client, signers = c, s }(client, signers)
+	client = &fasthttp.Client{}
+	signers = []requestSigner{headerSigner{"Authorization", "Bearer token"}, headerSigner{"X-Signature", "signed"}}
+
+	var got []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Clone())
+	}))
+	defer srv.Close()
+
+	steps := []requestSpec{
+		{Method: "DELETE", URL: srv.URL + "/items"},
+		{Method: "POST", URL: srv.URL + "/reindex"},
+	}
+	for i := range steps {
+		if err := steps[i].compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runTeardown(context.Background(), steps, 0, 5*time.Second)
+
+	if len(got) != len(steps) {
+		t.Fatalf("got %d requests, want %d", len(got), len(steps))
+	}
+	for i, h := range got {
+		if h.Get("Authorization") != "Bearer token" || h.Get("X-Signature") != "signed" {
+			t.Errorf("step %d headers = %v, want them signed", i+1, h)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	feederpkg "dos/internal/feeder"
+	"dos/internal/tmpl"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const dataPrefix = "data."
+
+var (
+	requestSeq int64
+	// feeder supplies {{data.<column>}} placeholders from -data.
+	feeder *feederpkg.Feeder
+	// templates are all parsed templates, for checkDataColumns.
+	templates []*tmpl.Template
+
+	// templateFuncs generate the values of {{name}} placeholders in request
+	// URLs, headers and bodies.
+	templateFuncs = map[string]func() string{
+		"uuid":       randomUUID,
+		"now":        func() string { return time.Now().UTC().Format(time.RFC3339Nano) },
+		"seq":        func() string { return strconv.FormatInt(atomic.AddInt64(&requestSeq, 1), 10) },
+		"rand_email": randomEmail,
+	}
+)
+
+// requestVars holds the placeholder values of one request. Each value is
+// generated on first use and then stays the same, so e.g. {{uuid}} in a
+// header and in the body of the same request match. All data placeholders of
+// a request come from the same row.
+type requestVars struct {
+	values map[string]string
+	row    map[string]string
+	// captured are the values scenario steps extracted for the virtual
+	// user, which take precedence over those of -prime_url.
+	captured map[string]string
+}
+
+func (v *requestVars) lookup(name string) string {
+	if column, ok := strings.CutPrefix(name, dataPrefix); ok {
+		if v.row == nil {
+			v.row = feeder.Next()
+		}
+		return v.row[column]
+	}
+	if key, ok := strings.CutPrefix(name, extractPrefix); ok {
+		if value, ok := v.captured[key]; ok {
+			return value
+		}
+		return extracted[key]
+	}
+	if value, ok := v.values[name]; ok {
+		return value
+	}
+	if v.values == nil {
+		v.values = map[string]string{}
+	}
+	value := templateFuncs[name]()
+	v.values[name] = value
+	return value
+}
+
+// parseTemplate parses s and checks that every placeholder is known. Data
+// columns and extracted values are checked later by checkDataColumns and
+// checkExtractNames, once all flags are handled.
+func parseTemplate(s string) (*tmpl.Template, error) {
+	t, err := tmpl.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range t.Names() {
+		if templateFuncs[name] == nil && !strings.HasPrefix(name, dataPrefix) && !strings.HasPrefix(name, extractPrefix) {
+			return nil, fmt.Errorf("%q: unknown placeholder {{%s}}", s, name)
+		}
+	}
+	templates = append(templates, t)
+	return t, nil
+}
+
+// checkDataColumns reports data placeholders used without -data or naming a
+// column the data file doesn't have.
+func checkDataColumns() error {
+	for _, t := range templates {
+		for _, name := range t.Names() {
+			column, ok := strings.CutPrefix(name, dataPrefix)
+			if !ok {
+				continue
+			}
+			if feeder == nil {
+				return fmt.Errorf("%q: {{%s}} requires -data", t, name)
+			}
+			if !feeder.HasColumn(column) {
+				return fmt.Errorf("%q: data file has no column %q", t, column)
+			}
+		}
+	}
+	return nil
+}
+
+func randomUUID() string {
+	return newUUID(rng.Uint64(), rng.Uint64())
+}
+
+// newUUID formats 128 random bits as a version 4 UUID.
+func newUUID(hi, lo uint64) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], hi)
+	binary.BigEndian.PutUint64(b[8:], lo)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func randomEmail() string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	name := make([]byte, 10)
+	for i := range name {
+		name[i] = letters[rng.IntN(len(letters))]
+	}
+	return "user-" + string(name) + "@example.com"
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	phaseStats = newNamedStats()
+	// timingFrom excludes warm-up exchanges from phaseStats.
+	timingFrom time.Time
+)
+
+// tracingDial wraps dial so that every connection reports how long DNS
+// resolution, the TCP connect and the TLS handshake took, and every
+// request/response exchange on it the time to first byte and the body
+// transfer. If resolve is false the host is resolved by dial itself (or a
+// proxy) and DNS is not reported separately. If tlsConfig is set, the
+// handshake for connections to tlsPort is done here instead of by fasthttp;
+// connections to other ports, such as redirects to plain http, are left as is.
+func tracingDial(dial fasthttp.DialFunc, resolve bool, tlsConfig *tls.Config, tlsPort string) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		conn := &timedConn{}
+
+		addrs := []string{addr}
+		if resolve && net.ParseIP(host) == nil {
+			start := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), *requestTimeout)
+			ips, err := net.DefaultResolver.LookupIP(ctx, lookupNetwork(), host)
+			cancel()
+			conn.dns = time.Since(start)
+			if err != nil {
+				return nil, err
+			}
+			addrs = addrs[:0]
+			for _, ip := range ips {
+				addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+			}
+		}
+
+		start := time.Now()
+		for _, a := range addrs {
+			if conn.Conn, err = dial(a); err == nil {
+				break
+			}
+		}
+		conn.connect = time.Since(start)
+		if err != nil {
+			return nil, err
+		}
+
+		conn.fresh = true
+		if tlsConfig != nil && port == tlsPort {
+			start := time.Now()
+			tlsConn, err := tlsHandshake(conn.Conn, tlsConfig, host)
+			conn.tls = time.Since(start)
+			if err != nil {
+				return nil, err
+			}
+			conn.Conn = tlsConn
+			return &timedTLSConn{conn}, nil
+		}
+		return conn, nil
+	}
+}
+
+// timedConn splits the traffic on a connection into exchanges: an exchange
+// starts with the first write after reading a response and ends with the
+// next such write or the connection closing.
+type timedConn struct {
+	net.Conn
+	dns     time.Duration
+	connect time.Duration
+	tls     time.Duration
+
+	mu        sync.Mutex
+	fresh     bool
+	reading   bool
+	wroteAt   time.Time
+	firstRead time.Time
+	lastRead  time.Time
+}
+
+// timedTLSConn makes fasthttp treat the connection as TLS already.
+type timedTLSConn struct {
+	*timedConn
+}
+
+func (c *timedTLSConn) Handshake() error {
+	return c.Conn.(*tls.Conn).Handshake()
+}
+
+func (c *timedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.mu.Lock()
+	if c.reading {
+		c.finish()
+	}
+	c.wroteAt = time.Now()
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *timedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		now := time.Now()
+		c.mu.Lock()
+		if !c.reading && !c.wroteAt.IsZero() {
+			c.reading = true
+			c.firstRead = now
+		}
+		c.lastRead = now
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+func (c *timedConn) Close() error {
+	c.mu.Lock()
+	if c.reading {
+		c.finish()
+	}
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+// finish records the exchange that just ended. c.mu must be held.
+func (c *timedConn) finish() {
+	c.reading = false
+	if c.wroteAt.Before(timingFrom) {
+		c.fresh = false
+		return
+	}
+
+	ttfb := c.firstRead.Sub(c.wroteAt)
+	transfer := c.lastRead.Sub(c.firstRead)
+	evt := log.Debug().Timestamp().Str("conn", fmt.Sprintf("%p", c))
+	if c.fresh {
+		if c.dns > 0 {
+			phaseStats.add("dns", c.dns)
+			evt = evt.Dur("dns", c.dns)
+		}
+		phaseStats.add("connect", c.connect)
+		evt = evt.Dur("connect", c.connect)
+		if c.tls > 0 {
+			phaseStats.add("tls", c.tls)
+			evt = evt.Dur("tls", c.tls)
+		}
+		c.fresh = false
+	}
+	phaseStats.add("ttfb", ttfb)
+	phaseStats.add("transfer", transfer)
+	evt.Dur("ttfb", ttfb).Dur("transfer", transfer).Msg("Request timing")
+}
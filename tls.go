@@ -0,0 +1,161 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	targetTLS = &tls.Config{}
+
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+// loadTLSConfig builds the TLS configuration used for the target from the
+// -insecure, -cert, -key, -ca, -tls_min_version, -tls_max_version and
+// -ciphers flags.
+func loadTLSConfig() error {
+	cfg := &tls.Config{InsecureSkipVerify: *insecure}
+
+	if (*certFile == "") != (*keyFile == "") {
+		return errors.New("cert and key must be set together")
+	}
+	if *certFile != "" {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			return err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if *caFile != "" {
+		data, err := os.ReadFile(*caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("%s: no PEM certificates found", *caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	var err error
+	if cfg.MinVersion, err = parseTLSVersion(*tlsMinVersion); err != nil {
+		return fmt.Errorf("tls_min_version: %w", err)
+	}
+	if cfg.MaxVersion, err = parseTLSVersion(*tlsMaxVersion); err != nil {
+		return fmt.Errorf("tls_max_version: %w", err)
+	}
+	if cfg.MinVersion != 0 && cfg.MaxVersion != 0 && cfg.MinVersion > cfg.MaxVersion {
+		return errors.New("tls_min_version is higher than tls_max_version")
+	}
+	if *ciphers != "" {
+		if cfg.CipherSuites, err = parseCipherSuites(*ciphers); err != nil {
+			return fmt.Errorf("ciphers: %w", err)
+		}
+	}
+
+	targetTLS = cfg
+	return nil
+}
+
+// targetTLSConfig returns a copy of the target TLS configuration for
+// serverName.
+func targetTLSConfig(serverName string) *tls.Config {
+	cfg := targetTLS.Clone()
+	cfg.ServerName = serverName
+	return cfg
+}
+
+// tlsHandshake does the TLS handshake on conn within -tls_timeout, or
+// -request_timeout if unset, and closes conn if it fails. A timeout is
+// reported as fasthttp.ErrTLSHandshakeTimeout.
+func tlsHandshake(conn net.Conn, cfg *tls.Config, host string) (*tls.Conn, error) {
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	tlsConn := tls.Client(conn, cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), cmp.Or(*tlsTimeout, *requestTimeout))
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fasthttp.ErrTLSHandshakeTimeout
+		}
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// handshakingDial does the TLS handshake for connections to tlsPort itself,
+// so that it is bound by -tls_timeout. fasthttp only bounds it by the write
+// timeout, which direct connections don't have, so a target that accepts
+// connections but never answers the handshake would stall requests forever.
+func handshakingDial(dial fasthttp.DialFunc, tlsConfig *tls.Config, tlsPort string) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		host, port, _ := net.SplitHostPort(addr)
+		if port != tlsPort {
+			return conn, nil
+		}
+		tlsConn, err := tlsHandshake(conn, tlsConfig, host)
+		if err != nil {
+			return nil, err
+		}
+		// fasthttp treats connections with a Handshake method as TLS already
+		return tlsConn, nil
+	}
+}
+
+func parseTLSVersion(s string) (uint16, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q (1.0, 1.1, 1.2, 1.3)", s)
+	}
+	return v, nil
+}
+
+// parseCipherSuites resolves a comma-separated list of cipher suite names as
+// printed by Go, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. TLS 1.3 suites
+// are rejected because Go doesn't allow configuring them.
+func parseCipherSuites(s string) ([]uint16, error) {
+	known := map[string]*tls.CipherSuite{}
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		suite, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		if len(suite.SupportedVersions) == 1 && suite.SupportedVersions[0] == tls.VersionTLS13 {
+			return nil, fmt.Errorf("%s is a TLS 1.3 suite, which can't be configured", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var traceMarkerPaths = []string{
+	"/sys/kernel/tracing/trace_marker",
+	"/sys/kernel/debug/tracing/trace_marker",
+}
+
+// openTraceMarker opens the ftrace marker file, whose writes show up in
+// perf and trace-cmd recordings.
+func openTraceMarker() (io.WriteCloser, error) {
+	var errs []error
+	for _, path := range traceMarkerPaths {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err == nil {
+			return f, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+func openTraceMarker() (io.WriteCloser, error) {
+	return nil, errors.New("trace markers are only supported on linux and windows")
+}
@@ -0,0 +1,82 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"syscall"
+	"unsafe"
+)
+
+// etwProvider is the ETW provider trace markers are written to as strings,
+// {bb34f482-86e8-4ee6-b9f2-d88eb8df125d}. Enable it in a recording, e.g.
+// with logman or WPR, to see the markers next to the system events.
+var etwProvider = syscall.GUID{
+	Data1: 0xbb34f482,
+	Data2: 0x86e8,
+	Data3: 0x4ee6,
+	Data4: [8]byte{0xb9, 0xf2, 0xd8, 0x8e, 0xb8, 0xdf, 0x12, 0x5d},
+}
+
+var (
+	advapi32             = syscall.NewLazyDLL("advapi32.dll")
+	procEventRegister    = advapi32.NewProc("EventRegister")
+	procEventUnregister  = advapi32.NewProc("EventUnregister")
+	procEventWriteString = advapi32.NewProc("EventWriteString")
+)
+
+// etwMarker writes every marker as an ETW string event.
+type etwMarker struct {
+	handle uint64
+}
+
+// openTraceMarker registers the ETW provider. Events are only recorded
+// while a trace session has it enabled.
+func openTraceMarker() (io.WriteCloser, error) {
+	if err := procEventRegister.Find(); err != nil {
+		return nil, err
+	}
+	m := &etwMarker{}
+	r, _, _ := procEventRegister.Call(uintptr(unsafe.Pointer(&etwProvider)), 0, 0, uintptr(unsafe.Pointer(&m.handle)))
+	if r != 0 {
+		return nil, fmt.Errorf("EventRegister: %w", syscall.Errno(r))
+	}
+	return m, nil
+}
+
+func (m *etwMarker) Write(p []byte) (int, error) {
+	s, err := syscall.UTF16PtrFromString(string(p))
+	if err != nil {
+		return 0, err
+	}
+	// level and keyword 0 let every session that enabled the provider
+	// record the event
+	args := append(m.handleArgs(), 0)
+	args = append(args, uint64Args(0)...)
+	args = append(args, uintptr(unsafe.Pointer(s)))
+	if r, _, _ := procEventWriteString.Call(args...); r != 0 {
+		return 0, fmt.Errorf("EventWriteString: %w", syscall.Errno(r))
+	}
+	return len(p), nil
+}
+
+func (m *etwMarker) Close() error {
+	if r, _, _ := procEventUnregister.Call(m.handleArgs()...); r != 0 {
+		return fmt.Errorf("EventUnregister: %w", syscall.Errno(r))
+	}
+	return nil
+}
+
+func (m *etwMarker) handleArgs() []uintptr {
+	return uint64Args(m.handle)
+}
+
+// uint64Args passes a 64-bit argument, which takes two arguments on 32-bit
+// platforms.
+func uint64Args(v uint64) []uintptr {
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		return []uintptr{uintptr(v)}
+	}
+	return []uintptr{uintptr(v), uintptr(v >> 32)}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"cmp"
+	"dos/internal/proxy"
+	"dos/internal/util"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// validateProxiesCommand checks every proxy of a list and prints the ones
+// that pass to stdout, fastest first, without sending any load. The log goes
+// to stderr so the output can be used as a proxy list.
+func validateProxiesCommand(args []string) {
+	fs, lvl, pretty := commandFlags("validate-proxies")
+	list := fs.String("proxy_list", "", "path to file with list of proxies")
+	timeout := fs.Duration("timeout", time.Second*5, "timeout of every check of a proxy")
+	concurrency := fs.Int("concurrency", 100, "number of proxies checked at once")
+	probeURL := fs.String("probe_url", "", "URL requested through every proxy that accepted a connection; any response passes")
+	validOut := fs.String("valid_out", "", "path to write the valid proxies to, fastest first")
+	invalidOut := fs.String("invalid_out", "", "path to write the invalid proxies to")
+	resultsOut := fs.String("results_out", "", "path to write every proxy with its result, latency and error to as CSV")
+	cachePath := fs.String("cache", "", "path to a file caching validation results, so that only proxies whose result expired are checked again")
+	cacheTTL := fs.Duration("cache_ttl", time.Hour, "how long a cached validation result is used")
+	fs.Parse(args)
+	zerolog.SetGlobalLevel(setupLog(os.Stderr, *pretty, *lvl))
+
+	switch {
+	case *list == "":
+		log.Fatal().Timestamp().Msg("proxy_list is required")
+	case *timeout <= 0:
+		log.Fatal().Timestamp().Msg("timeout must be positive")
+	case *concurrency < 1:
+		log.Fatal().Timestamp().Msg("concurrency must be at least 1")
+	case *cacheTTL <= 0:
+		log.Fatal().Timestamp().Msg("cache_ttl must be positive")
+	}
+	proxies, err := util.ReadFileEntries(*list)
+	if err != nil {
+		log.Fatal().Err(err).Timestamp().Msg("Failed to read proxy list")
+	}
+
+	log.Info().Timestamp().Int("proxies-count", len(proxies)).Bool("probe", *probeURL != "").Msg("Validating proxy list")
+	opts := proxy.Options{Timeout: *timeout, Concurrency: *concurrency, ProbeURL: *probeURL}
+	var checks []proxy.Check
+	if *cachePath != "" {
+		cache, err := proxy.LoadCache(*cachePath, *cacheTTL)
+		if err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Failed to read proxy cache")
+		}
+		var cached int
+		checks, cached = cache.Validate(proxies, opts)
+		log.Info().Timestamp().Int("cached", cached).Msg("Used cached validation results")
+		if err := cache.Save(); err != nil {
+			log.Warn().Err(err).Timestamp().Msg("Failed to save proxy cache")
+		}
+	} else {
+		checks = proxy.Validate(proxies, opts)
+	}
+	var valid, invalid []proxy.Check
+	for _, c := range checks {
+		if c.Valid() {
+			valid = append(valid, c)
+		} else {
+			invalid = append(invalid, c)
+			log.Debug().Timestamp().Err(c.Err).Str("proxy", c.Proxy).Msg("Proxy failed validation")
+		}
+	}
+	slices.SortStableFunc(valid, func(a, b proxy.Check) int { return cmp.Compare(a.Latency, b.Latency) })
+	log.Info().Timestamp().Str("valid-proxies", fmt.Sprintf("%d/%d", len(valid), len(proxies))).Msg("Validated proxy list")
+
+	for _, c := range valid {
+		fmt.Println(c.Proxy)
+	}
+	if *validOut != "" {
+		if err := saveProxies(*validOut, checkedProxies(valid)); err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Failed to write valid proxies")
+		}
+	}
+	if *invalidOut != "" {
+		if err := saveProxies(*invalidOut, checkedProxies(invalid)); err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Failed to write invalid proxies")
+		}
+	}
+	if *resultsOut != "" {
+		if err := writeProxyResults(*resultsOut, checks); err != nil {
+			log.Fatal().Err(err).Timestamp().Msg("Failed to write proxy results")
+		}
+	}
+}
+
+// saveProxies writes a proxy list, one per line, so that a later run can use
+// it as its -proxy_list. The file is replaced atomically, so it may be the
+// list being validated.
+func saveProxies(path string, proxies []string) error {
+	var b strings.Builder
+	for _, p := range proxies {
+		b.WriteString(p + "\n")
+	}
+	return util.WriteFileAtomic(path, []byte(b.String()))
+}
+
+func checkedProxies(checks []proxy.Check) []string {
+	proxies := make([]string, len(checks))
+	for i, c := range checks {
+		proxies[i] = c.Proxy
+	}
+	return proxies
+}
+
+// writeProxyResults writes a CSV row per proxy in the order of the list.
+// latency_ms is empty for proxies that failed.
+func writeProxyResults(path string, checks []proxy.Check) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cw := csv.NewWriter(f)
+	cw.Write([]string{"proxy", "valid", "latency_ms", "error"})
+	for _, c := range checks {
+		latency := ""
+		if c.Valid() {
+			latency = strconv.FormatFloat(durationMs(c.Latency), 'f', 3, 64)
+		}
+		cw.Write([]string{c.Proxy, strconv.FormatBool(c.Valid()), latency, errString(c.Err)})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"dos/internal/expr"
+	"dos/internal/metrics"
+	"fmt"
+)
+
+// requestVariant replaces parts of the default request while its condition
+// over the rolling statistics holds. A variant without a condition always
+// matches and acts as a fallback.
+type requestVariant struct {
+	requestSpec
+	When string `json:"when"`
+
+	condition *expr.Condition
+}
+
+var (
+	variants       []requestVariant
+	variantRolling *metrics.Rolling
+	variantStats   = newNamedStats()
+)
+
+func (v *requestVariant) compile(index int) error {
+	if v.Name == "" {
+		v.Name = fmt.Sprintf("variant-%d", index+1)
+	}
+	if err := v.requestSpec.compile(); err != nil {
+		return fmt.Errorf("variant %q: %w", v.Name, err)
+	}
+	if v.When == "" {
+		return nil
+	}
+	cond, err := expr.Parse(v.When)
+	if err != nil {
+		return fmt.Errorf("variant %q: %w", v.Name, err)
+	}
+	if _, err := cond.Eval(metrics.Snapshot{}.Vars()); err != nil {
+		return fmt.Errorf("variant %q: %w", v.Name, err)
+	}
+	v.condition = cond
+	return nil
+}
+
+// pickVariant returns the first variant whose condition matches the current
+// rolling statistics, or nil to send the default request.
+func pickVariant() *requestVariant {
+	if len(variants) == 0 || variantRolling == nil {
+		return nil
+	}
+	vars := variantRolling.Snapshot().Vars()
+	for i := range variants {
+		v := &variants[i]
+		if v.condition == nil {
+			return v
+		}
+		if ok, _ := v.condition.Eval(vars); ok {
+			return v
+		}
+	}
+	return nil
+}
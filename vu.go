@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// virtualUser is a simulated user that sends its requests one after another
+// with its own connections, cookies, proxy and position in -har, -access_log
+// or scenario requests, and the values its scenario steps extracted.
+type virtualUser struct {
+	id       int
+	client   *fasthttp.Client
+	cookies  cookieJar
+	position int
+	vars     map[string]string
+}
+
+// newVirtualUsers creates n virtual users. With proxies, every user is
+// assigned one proxy, round-robin; wrapDial, if set, wraps the dial of those
+// proxy clients.
+func newVirtualUsers(n int, wrapDial func(fasthttp.DialFunc) fasthttp.DialFunc) []*virtualUser {
+	users := make([]*virtualUser, n)
+	for i := range users {
+		c := &fasthttp.Client{Dial: client.Dial}
+		if rotator != nil {
+			c = rotator.ClientFor(i)
+			if wrapDial != nil {
+				c.Dial = wrapDial(c.Dial)
+			}
+		}
+		configureClient(c)
+		users[i] = &virtualUser{id: i + 1, client: c, cookies: cookieJar{}, vars: map[string]string{}}
+	}
+	return users
+}
+
+// run sends a request for every ticket taken from the dispatch loop until ctx
+// is cancelled. While the user is inactive it takes no tickets.
+func (vu *virtualUser) run(ctx context.Context, tickets <-chan ticket, respChan chan<- *Result, inflight *sync.WaitGroup) {
+	defer crashes.handlePanic("vu", nil)
+	for {
+		if !activeUsers.wait(ctx, vu.id) {
+			return
+		}
+		select {
+		case t := <-tickets:
+			res := doRecovered(ctx, vu)
+			t.stamp(res)
+			select {
+			case respChan <- res:
+			case <-ctx.Done():
+				releaseResult(res)
+			}
+			inflight.Done()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// activeVUs is the number of virtual users that send requests, so stages and
+// the console can change it during the run. Users with higher ids wait.
+type activeVUs struct {
+	mu      sync.Mutex
+	n       int
+	changed chan struct{}
+}
+
+var activeUsers *activeVUs
+
+func newActiveVUs(n int) *activeVUs {
+	return &activeVUs{n: n, changed: make(chan struct{})}
+}
+
+func (a *activeVUs) get() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.n
+}
+
+func (a *activeVUs) set(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.n = n
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+// wait blocks until user id is active. It returns false if ctx is cancelled
+// first.
+func (a *activeVUs) wait(ctx context.Context, id int) bool {
+	for {
+		a.mu.Lock()
+		n, changed := a.n, a.changed
+		a.mu.Unlock()
+		if id <= n {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// cookieJar keeps the cookies the target set for a virtual user. Domain and
+// path attributes are ignored, since a run targets a single site.
+type cookieJar map[string]string
+
+func (j cookieJar) apply(req *fasthttp.Request) {
+	for name, value := range j {
+		req.Header.SetCookie(name, value)
+	}
+}
+
+func (j cookieJar) update(resp *fasthttp.Response) {
+	now := time.Now()
+	resp.Header.VisitAllCookie(func(_, value []byte) {
+		c := fasthttp.AcquireCookie()
+		defer fasthttp.ReleaseCookie(c)
+		if c.ParseBytes(value) != nil {
+			return
+		}
+		expire := c.Expire()
+		if c.MaxAge() < 0 || (!expire.Equal(fasthttp.CookieExpireUnlimited) && expire.Before(now)) {
+			delete(j, string(c.Key()))
+			return
+		}
+		j[string(c.Key())] = string(c.Value())
+	})
+}